@@ -0,0 +1,214 @@
+package assembler
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Expr は、μAsm のオペランドとなる式を表すインターフェース
+// Register, Immediate, LabelRef, UnaryExpr, BinaryExpr のいずれかです。
+type Expr interface {
+	String() string
+	exprNode()
+}
+
+// Register は、レジスタ (変数) を表す構造体
+type Register struct {
+	Name string
+}
+
+// Immediate は、整数の即値を表す構造体
+type Immediate struct {
+	Value int
+}
+
+// LabelRef は、ジャンプ先のラベルへの参照を表す構造体
+type LabelRef struct {
+	Name string
+}
+
+// UnaryExpr は、単項演算 (-x など) を表す構造体
+type UnaryExpr struct {
+	Op      string
+	Operand Expr
+}
+
+// BinaryExpr は、二項演算を表す構造体
+// Op は "==" や "!=" のように正規化されています ("=" は "==", "\=" は "!=" になります)。
+type BinaryExpr struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+func (Register) exprNode()   {}
+func (Immediate) exprNode()  {}
+func (LabelRef) exprNode()   {}
+func (UnaryExpr) exprNode()  {}
+func (BinaryExpr) exprNode() {}
+
+func (r Register) String() string  { return r.Name }
+func (i Immediate) String() string { return strconv.Itoa(i.Value) }
+func (l LabelRef) String() string  { return l.Name }
+
+func (u UnaryExpr) String() string {
+	return u.Op + formatSubExpr(u.Operand)
+}
+
+func (b BinaryExpr) String() string {
+	op := b.Op
+	if op == "%" {
+		op = "mod" // % は .muasm ではコメントの開始になるため
+	}
+	return fmt.Sprintf("%s %s %s", formatSubExpr(b.Left), op, formatSubExpr(b.Right))
+}
+
+// formatSubExpr は、部分式が演算を含む場合に括弧で囲んで文字列にします。
+func formatSubExpr(e Expr) string {
+	switch e.(type) {
+	case BinaryExpr, UnaryExpr:
+		return "(" + e.String() + ")"
+	default:
+		return e.String()
+	}
+}
+
+// Stmt は、オペランドを型付きの式に変換した μAsm の命令を表すインターフェース
+// Skip, Assign, CondAssign, Load, Store, Jmp, Beqz, Spbarr と、実行器だけの命令 Mov, Add のいずれかです。
+type Stmt interface {
+	String() string
+	stmtNode()
+}
+
+// Skip は、何もしない命令 (skip) を表す構造体
+type Skip struct{}
+
+// Assign は、代入命令 (x <- e) を表す構造体
+type Assign struct {
+	Dest  Register
+	Value Expr
+}
+
+// CondAssign は、条件付き代入命令 (cmov c, x <- e) を表す構造体
+// Cond が 0 以外に評価された場合のみ Dest に Value を代入します。
+type CondAssign struct {
+	Cond  Expr
+	Dest  Register
+	Value Expr
+}
+
+// Load は、メモリ読み取り命令 (load x, e) を表す構造体
+type Load struct {
+	Dest Register
+	Addr Expr
+}
+
+// Store は、メモリ書き込み命令 (store x, e) を表す構造体
+type Store struct {
+	Src  Register
+	Addr Expr
+}
+
+// Jmp は、無条件ジャンプ命令 (jmp e) を表す構造体
+type Jmp struct {
+	Target Expr
+}
+
+// Beqz は、条件分岐命令 (beqz x, l) を表す構造体
+type Beqz struct {
+	Cond   Register
+	Target Expr
+}
+
+// Spbarr は、投機実行バリア命令 (spbarr) を表す構造体
+type Spbarr struct{}
+
+// Mov は、実行器の従来の代入命令 (mov x, e) を表す構造体
+// Assign と異なり、代入先のレジスタへのストアを観測として記録します。
+type Mov struct {
+	Dest Register
+	Src  Expr
+}
+
+// Add は、実行器の従来の加算命令 (add x, a, b) を表す構造体
+// Mov と同様に、代入先のレジスタへのストアを観測として記録します。
+type Add struct {
+	Dest  Register
+	Left  Expr
+	Right Expr
+}
+
+func (Skip) stmtNode()       {}
+func (Assign) stmtNode()     {}
+func (CondAssign) stmtNode() {}
+func (Load) stmtNode()       {}
+func (Store) stmtNode()      {}
+func (Jmp) stmtNode()        {}
+func (Beqz) stmtNode()       {}
+func (Spbarr) stmtNode()     {}
+func (Mov) stmtNode()        {}
+func (Add) stmtNode()        {}
+
+func (Skip) String() string         { return "skip" }
+func (s Assign) String() string     { return fmt.Sprintf("%s <- %s", s.Dest, s.Value) }
+func (s CondAssign) String() string { return fmt.Sprintf("cmov %s, %s <- %s", s.Cond, s.Dest, s.Value) }
+func (s Load) String() string       { return fmt.Sprintf("load %s, %s", s.Dest, s.Addr) }
+func (s Store) String() string      { return fmt.Sprintf("store %s, %s", s.Src, s.Addr) }
+func (s Jmp) String() string        { return fmt.Sprintf("jmp %s", s.Target) }
+func (s Beqz) String() string       { return fmt.Sprintf("beqz %s, %s", s.Cond, s.Target) }
+func (Spbarr) String() string       { return "spbarr" }
+func (s Mov) String() string        { return fmt.Sprintf("mov %s, %s", s.Dest, s.Src) }
+func (s Add) String() string        { return fmt.Sprintf("add %s, %s, %s", s.Dest, s.Left, s.Right) }
+
+// Encode は、Decode の逆に Stmt を OpCode に変換します。オペランドは各式の String で表します。
+func Encode(stmt Stmt) OpCode {
+	var exprs []Expr
+	switch s := stmt.(type) {
+	case Assign:
+		exprs = []Expr{s.Dest, s.Value}
+	case CondAssign:
+		exprs = []Expr{s.Cond, s.Dest, s.Value}
+	case Load:
+		exprs = []Expr{s.Dest, s.Addr}
+	case Store:
+		exprs = []Expr{s.Src, s.Addr}
+	case Jmp:
+		exprs = []Expr{s.Target}
+	case Beqz:
+		exprs = []Expr{s.Cond, s.Target}
+	case Mov:
+		exprs = []Expr{s.Dest, s.Src}
+	case Add:
+		exprs = []Expr{s.Dest, s.Left, s.Right}
+	}
+	var operands []string
+	for _, expr := range exprs {
+		operands = append(operands, expr.String())
+	}
+	return OpCode{Mnemonic: Mnemonic(stmt), Operands: operands}
+}
+
+// Mnemonic は、Stmt のニーモニックを返します。
+func Mnemonic(stmt Stmt) string {
+	switch stmt.(type) {
+	case Assign:
+		return "<-"
+	case CondAssign:
+		return "cmov"
+	case Load:
+		return "load"
+	case Store:
+		return "store"
+	case Jmp:
+		return "jmp"
+	case Beqz:
+		return "beqz"
+	case Spbarr:
+		return "spbarr"
+	case Mov:
+		return "mov"
+	case Add:
+		return "add"
+	}
+	return "skip"
+}
@@ -0,0 +1,194 @@
+package assembler_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/taisii/go-project/assembler"
+)
+
+func TestParseExpr(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected assembler.Expr
+	}{
+		{
+			name:     "即値",
+			input:    "42",
+			expected: assembler.Immediate{Value: 42},
+		},
+		{
+			name:     "負の即値",
+			input:    "-3",
+			expected: assembler.Immediate{Value: -3},
+		},
+		{
+			name:     "レジスタ",
+			input:    "x_1",
+			expected: assembler.Register{Name: "x_1"},
+		},
+		{
+			name:  "乗算は加算より強く結合する",
+			input: "a + b * 2",
+			expected: assembler.BinaryExpr{Op: "+",
+				Left:  assembler.Register{Name: "a"},
+				Right: assembler.BinaryExpr{Op: "*", Left: assembler.Register{Name: "b"}, Right: assembler.Immediate{Value: 2}},
+			},
+		},
+		{
+			name:  "減算は左結合",
+			input: "a - b - c",
+			expected: assembler.BinaryExpr{Op: "-",
+				Left:  assembler.BinaryExpr{Op: "-", Left: assembler.Register{Name: "a"}, Right: assembler.Register{Name: "b"}},
+				Right: assembler.Register{Name: "c"},
+			},
+		},
+		{
+			name:  "比較演算子の正規化",
+			input: "x=0",
+			expected: assembler.BinaryExpr{Op: "==",
+				Left:  assembler.Register{Name: "x"},
+				Right: assembler.Immediate{Value: 0},
+			},
+		},
+		{
+			name:  "括弧と単項マイナス",
+			input: "-(a mod 4) < b",
+			expected: assembler.BinaryExpr{Op: "<",
+				Left: assembler.UnaryExpr{Op: "-",
+					Operand: assembler.BinaryExpr{Op: "%", Left: assembler.Register{Name: "a"}, Right: assembler.Immediate{Value: 4}},
+				},
+				Right: assembler.Register{Name: "b"},
+			},
+		},
+		{
+			name:  "論理演算子はビット演算より弱く結合する",
+			input: "!a && b | c",
+			expected: assembler.BinaryExpr{Op: "&&",
+				Left:  assembler.UnaryExpr{Op: "!", Operand: assembler.Register{Name: "a"}},
+				Right: assembler.BinaryExpr{Op: "|", Left: assembler.Register{Name: "b"}, Right: assembler.Register{Name: "c"}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := assembler.ParseExpr(tc.input)
+			if err != nil {
+				t.Fatalf("ParseExprエラー: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("式が異なります。got: %#v, want: %#v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	testCases := []struct {
+		input  string
+		offset int
+	}{
+		{input: "", offset: 0},
+		{input: "a +", offset: 3},
+		{input: "(a + 1", offset: 0},
+		{input: "a b", offset: 2},
+		{input: "a @ b", offset: 2},
+		{input: "a % 3", offset: 2}, // 剰余は mod で書く
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			_, err := assembler.ParseExpr(tc.input)
+			var exprErr *assembler.ExprError
+			if !errors.As(err, &exprErr) {
+				t.Fatalf("expected ExprError, but got %v", err)
+			}
+			if exprErr.Offset != tc.offset {
+				t.Errorf("エラー位置が異なります。got: %d, want: %d (%s)", exprErr.Offset, tc.offset, exprErr.Message)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	testCases := []struct {
+		op       assembler.OpCode
+		expected assembler.Stmt
+	}{
+		{
+			op:       assembler.OpCode{Mnemonic: "<-", Operands: []string{"x", "x+1"}},
+			expected: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "+", Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 1}}},
+		},
+		{
+			op:       assembler.OpCode{Mnemonic: "cmov", Operands: []string{"c", "x", "y"}},
+			expected: assembler.CondAssign{Cond: assembler.Register{Name: "c"}, Dest: assembler.Register{Name: "x"}, Value: assembler.Register{Name: "y"}},
+		},
+		{
+			op:       assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "10+y"}},
+			expected: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.BinaryExpr{Op: "+", Left: assembler.Immediate{Value: 10}, Right: assembler.Register{Name: "y"}}},
+		},
+		{
+			op:       assembler.OpCode{Mnemonic: "store", Operands: []string{"y", "w"}},
+			expected: assembler.Store{Src: assembler.Register{Name: "y"}, Addr: assembler.Register{Name: "w"}},
+		},
+		{
+			op:       assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "Loop"}},
+			expected: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "Loop"}},
+		},
+		{
+			op:       assembler.OpCode{Mnemonic: "jmp", Operands: []string{"3"}},
+			expected: assembler.Jmp{Target: assembler.Immediate{Value: 3}},
+		},
+		{
+			op:       assembler.OpCode{Mnemonic: "spbarr"},
+			expected: assembler.Spbarr{},
+		},
+		{
+			op:       assembler.OpCode{Mnemonic: "skip"},
+			expected: assembler.Skip{},
+		},
+		{
+			op:       assembler.OpCode{Mnemonic: "mov", Operands: []string{"y", "x*2"}},
+			expected: assembler.Mov{Dest: assembler.Register{Name: "y"}, Src: assembler.BinaryExpr{Op: "*", Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 2}}},
+		},
+		{
+			op:       assembler.OpCode{Mnemonic: "add", Operands: []string{"z", "x", "1"}},
+			expected: assembler.Add{Dest: assembler.Register{Name: "z"}, Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 1}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.op.Mnemonic, func(t *testing.T) {
+			got, err := assembler.Decode(tc.op)
+			if err != nil {
+				t.Fatalf("Decodeエラー: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("命令が異なります。got: %#v, want: %#v", got, tc.expected)
+			}
+
+			// Encode した OpCode を Decode し直すと同じ Stmt になる
+			again, err := assembler.Decode(assembler.Encode(got))
+			if err != nil {
+				t.Fatalf("Encode した命令の Decode エラー: %v", err)
+			}
+			if !reflect.DeepEqual(again, got) {
+				t.Errorf("Encode した命令が異なります。got: %#v, want: %#v", again, got)
+			}
+		})
+	}
+}
+
+func TestStmtString(t *testing.T) {
+	stmt, err := assembler.Decode(assembler.OpCode{Mnemonic: "cmov", Operands: []string{"c=0", "x", "(a+b)*2"}})
+	if err != nil {
+		t.Fatalf("Decodeエラー: %v", err)
+	}
+	want := "cmov c == 0, x <- (a + b) * 2"
+	if stmt.String() != want {
+		t.Errorf("文字列表現が異なります。got: %q, want: %q", stmt.String(), want)
+	}
+}
@@ -0,0 +1,130 @@
+package assembler
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DecodeError は、命令を Stmt に変換できなかったことを表す構造体
+type DecodeError struct {
+	Operand int    // 不正なオペランドの位置 (0 始まり、命令全体の問題の場合は -1)
+	Offset  int    // オペランド内のエラー位置 (バイト単位)
+	Message string // エラーの内容
+}
+
+func (e *DecodeError) Error() string {
+	return e.Message
+}
+
+// operandCounts は、ニーモニックごとのオペランド数を表します。
+var operandCounts = map[string]int{
+	"<-":     2,
+	"cmov":   3,
+	"load":   2,
+	"store":  2,
+	"beqz":   2,
+	"jmp":    1,
+	"spbarr": 0,
+	"skip":   0,
+	"mov":    2,
+	"add":    3,
+}
+
+// Decode は、OpCode のオペランドを解析して型付きの Stmt に変換します。
+// ジャンプ先のオペランドが識別子のみの場合は LabelRef として扱います。
+func Decode(op OpCode) (Stmt, error) {
+	expected, ok := operandCounts[op.Mnemonic]
+	if !ok {
+		return nil, &DecodeError{Operand: -1, Message: fmt.Sprintf("unknown instruction %q", op.Mnemonic)}
+	}
+	if len(op.Operands) != expected {
+		return nil, &DecodeError{Operand: -1, Message: fmt.Sprintf("%s requires %d operands, got %d", op.Mnemonic, expected, len(op.Operands))}
+	}
+
+	exprs := make([]Expr, len(op.Operands))
+	for i, operand := range op.Operands {
+		expr, err := ParseExpr(operand)
+		if err != nil {
+			var exprErr *ExprError
+			if !errors.As(err, &exprErr) {
+				return nil, &DecodeError{Operand: i, Message: err.Error()}
+			}
+			return nil, &DecodeError{Operand: i, Offset: exprErr.Offset, Message: exprErr.Message}
+		}
+		exprs[i] = expr
+	}
+
+	switch op.Mnemonic {
+	case "<-":
+		dest, err := register(op, exprs, 0, "invalid assignment target %q")
+		if err != nil {
+			return nil, err
+		}
+		return Assign{Dest: dest, Value: exprs[1]}, nil
+	case "cmov":
+		dest, err := register(op, exprs, 1, "invalid assignment target %q")
+		if err != nil {
+			return nil, err
+		}
+		return CondAssign{Cond: exprs[0], Dest: dest, Value: exprs[2]}, nil
+	case "load":
+		dest, err := register(op, exprs, 0, "load destination must be a register, got %q")
+		if err != nil {
+			return nil, err
+		}
+		return Load{Dest: dest, Addr: exprs[1]}, nil
+	case "store":
+		src, err := register(op, exprs, 0, "store source must be a register, got %q")
+		if err != nil {
+			return nil, err
+		}
+		return Store{Src: src, Addr: exprs[1]}, nil
+	case "jmp":
+		return Jmp{Target: jumpTarget(exprs[0])}, nil
+	case "beqz":
+		cond, err := register(op, exprs, 0, "beqz condition must be a register, got %q")
+		if err != nil {
+			return nil, err
+		}
+		target := jumpTarget(exprs[1])
+		switch target.(type) {
+		case LabelRef, Immediate:
+		default:
+			return nil, &DecodeError{Operand: 1, Message: fmt.Sprintf("beqz target must be a label or an address, got %q", op.Operands[1])}
+		}
+		return Beqz{Cond: cond, Target: target}, nil
+	case "spbarr":
+		return Spbarr{}, nil
+	case "mov":
+		dest, err := register(op, exprs, 0, "mov destination must be a register, got %q")
+		if err != nil {
+			return nil, err
+		}
+		return Mov{Dest: dest, Src: exprs[1]}, nil
+	case "add":
+		dest, err := register(op, exprs, 0, "add destination must be a register, got %q")
+		if err != nil {
+			return nil, err
+		}
+		return Add{Dest: dest, Left: exprs[1], Right: exprs[2]}, nil
+	default: // skip
+		return Skip{}, nil
+	}
+}
+
+// register は、i 番目のオペランドがレジスタであることを確かめて返します。
+func register(op OpCode, exprs []Expr, i int, format string) (Register, error) {
+	reg, ok := exprs[i].(Register)
+	if !ok {
+		return Register{}, &DecodeError{Operand: i, Message: fmt.Sprintf(format, op.Operands[i])}
+	}
+	return reg, nil
+}
+
+// jumpTarget は、識別子のみのジャンプ先を LabelRef に変換します。
+func jumpTarget(expr Expr) Expr {
+	if reg, ok := expr.(Register); ok {
+		return LabelRef{Name: reg.Name}
+	}
+	return expr
+}
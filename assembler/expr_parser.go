@@ -0,0 +1,209 @@
+package assembler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ExprError は、式の構文エラーを表す構造体
+type ExprError struct {
+	Offset  int // 式の文字列内のエラー位置 (バイト単位)
+	Message string
+}
+
+func (e *ExprError) Error() string {
+	return e.Message
+}
+
+// binaryPrecedence は、二項演算子の優先順位を表します (大きいほど強く結合し、すべて左結合)。
+// 比較演算子の扱いを除き C 言語の優先順位に合わせています。
+// "%" は mod を正規化した演算子です。.muasm では % がコメントの開始になるため、式に % は書けません。
+var binaryPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"|":  3,
+	"^":  4,
+	"&":  5,
+	"==": 6, "!=": 6, "<": 6, "<=": 6, ">": 6, ">=": 6,
+	"<<": 7, ">>": 7,
+	"+": 8, "-": 8,
+	"*": 9, "/": 9, "%": 9,
+}
+
+// operatorAliases は、μAsm の表記を正規化した演算子に対応付けます。
+var operatorAliases = map[string]string{
+	"=":   "==",
+	"\\=": "!=",
+	"=<":  "<=",
+	"mod": "%",
+	"xor": "^",
+	"/\\": "&",
+	"\\/": "|",
+}
+
+// exprToken は、式の字句を表す構造体
+type exprToken struct {
+	text   string
+	offset int
+}
+
+// ParseExpr は、μAsm の式の文字列を Expr に変換します。
+// 識別子はすべて Register として扱います。
+func ParseExpr(input string) (Expr, error) {
+	tokens, err := tokenizeExpr(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens, end: len(input)}
+	if len(tokens) == 0 {
+		return nil, &ExprError{Offset: 0, Message: "empty expression"}
+	}
+	expr, err := p.parseBinary(1)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		tok := p.tokens[p.pos]
+		return nil, &ExprError{Offset: tok.offset, Message: fmt.Sprintf("unexpected token %q", tok.text)}
+	}
+	return expr, nil
+}
+
+// tokenizeExpr は、式の文字列を字句に分割します。
+func tokenizeExpr(input string) ([]exprToken, error) {
+	tokens := make([]exprToken, 0)
+	for i := 0; i < len(input); {
+		r := rune(input[i])
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(input) && unicode.IsDigit(rune(input[i])) {
+				i++
+			}
+			tokens = append(tokens, exprToken{text: input[start:i], offset: start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(input) && (unicode.IsLetter(rune(input[i])) || unicode.IsDigit(rune(input[i])) || input[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, exprToken{text: input[start:i], offset: start})
+		default:
+			// 長い演算子から順に照合する
+			matched := ""
+			for _, op := range []string{"<<", ">>", "<=", ">=", "==", "!=", "=<", "\\=", "/\\", "\\/", "&&", "||", "+", "-", "*", "/", "<", ">", "=", "&", "|", "^", "(", ")", "~", "!"} {
+				if strings.HasPrefix(input[i:], op) {
+					matched = op
+					break
+				}
+			}
+			if matched == "" && input[i] == '%' {
+				return nil, &ExprError{Offset: i, Message: "% starts a comment; use mod for the remainder"}
+			}
+			if matched == "" {
+				return nil, &ExprError{Offset: i, Message: fmt.Sprintf("unexpected character %q", input[i])}
+			}
+			tokens = append(tokens, exprToken{text: matched, offset: i})
+			i += len(matched)
+		}
+	}
+	return tokens, nil
+}
+
+// exprParser は、優先順位法による式のパーサー
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+	end    int // 入力の長さ (末尾でのエラー位置に使う)
+}
+
+// operator は、現在の字句が二項演算子であれば正規化した演算子を返します。
+func (p *exprParser) operator() (string, bool) {
+	if p.pos >= len(p.tokens) {
+		return "", false
+	}
+	op := p.tokens[p.pos].text
+	if alias, ok := operatorAliases[op]; ok {
+		op = alias
+	}
+	_, ok := binaryPrecedence[op]
+	return op, ok
+}
+
+// parseBinary は、優先順位が minPrec 以上の二項演算からなる式を解析します。
+func (p *exprParser) parseBinary(minPrec int) (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.operator()
+		if !ok || binaryPrecedence[op] < minPrec {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseBinary(binaryPrecedence[op] + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = BinaryExpr{Op: op, Left: left, Right: right}
+	}
+}
+
+// parseUnary は、単項演算子の付いた式を解析します。
+func (p *exprParser) parseUnary() (Expr, error) {
+	if p.pos < len(p.tokens) && isUnaryOperator(p.tokens[p.pos].text) {
+		op := p.tokens[p.pos].text
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		// 負の即値はそのまま即値にする
+		if imm, ok := operand.(Immediate); ok && op == "-" {
+			return Immediate{Value: -imm.Value}, nil
+		}
+		return UnaryExpr{Op: op, Operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+// isUnaryOperator は、前置の単項演算子 (-, ~, !) かどうかを返します。
+func isUnaryOperator(token string) bool {
+	return token == "-" || token == "~" || token == "!"
+}
+
+// parsePrimary は、即値、識別子、括弧で囲まれた式を解析します。
+func (p *exprParser) parsePrimary() (Expr, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, &ExprError{Offset: p.end, Message: "unexpected end of expression"}
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+
+	switch {
+	case tok.text == "(":
+		expr, err := p.parseBinary(1)
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].text != ")" {
+			return nil, &ExprError{Offset: tok.offset, Message: "mismatched parentheses"}
+		}
+		p.pos++
+		return expr, nil
+	case unicode.IsDigit(rune(tok.text[0])):
+		value, err := strconv.Atoi(tok.text)
+		if err != nil {
+			return nil, &ExprError{Offset: tok.offset, Message: fmt.Sprintf("invalid number %q", tok.text)}
+		}
+		return Immediate{Value: value}, nil
+	case isIdentifier(tok.text) && tok.text != "mod" && tok.text != "xor":
+		return Register{Name: tok.text}, nil
+	default:
+		return nil, &ExprError{Offset: tok.offset, Message: fmt.Sprintf("unexpected token %q", tok.text)}
+	}
+}
@@ -28,20 +28,7 @@ func GenerateAsm(assembler *Assembler) (string, error) {
 		}
 
 		// 命令の出力
-		if instruction.OpCode.Mnemonic == "<-" && len(instruction.OpCode.Operands) == 2 {
-			sb.WriteString(instruction.OpCode.Operands[0])
-			sb.WriteString(" <- ")
-			sb.WriteString(instruction.OpCode.Operands[1])
-		} else {
-			sb.WriteString(instruction.OpCode.Mnemonic)
-			if len(instruction.OpCode.Operands) > 0 {
-				operands := strings.Join(instruction.OpCode.Operands, ", ")
-				if operands != "" {
-					sb.WriteString(" ")
-					sb.WriteString(operands)
-				}
-			}
-		}
+		sb.WriteString(sourceText(instruction.Op()))
 		sb.WriteString("\n")
 	}
 
@@ -74,3 +61,18 @@ func GenerateAsm(assembler *Assembler) (string, error) {
 
 	return sb.String(), nil
 }
+
+// sourceText は、命令をアセンブリファイルの一行の表記に変換します。
+func sourceText(op OpCode) string {
+	switch {
+	case op.Mnemonic == "<-" && len(op.Operands) == 2:
+		return op.Operands[0] + " <- " + op.Operands[1]
+	case op.Mnemonic == "cmov" && len(op.Operands) == 3:
+		return "cmov " + op.Operands[0] + ", " + op.Operands[1] + " <- " + op.Operands[2]
+	}
+	operands := strings.Join(op.Operands, ", ")
+	if operands == "" { // spbarrのようなオペランドが空文字列の場合に対応
+		return op.Mnemonic
+	}
+	return op.Mnemonic + " " + operands
+}
@@ -17,9 +17,9 @@ func TestGenerateAsm(t *testing.T) {
 			name: "基本的な命令とラベル",
 			input: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "SET", Operands: []string{"R1", "10"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "JMP", Operands: []string{"loop"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "HALT", Operands: []string{}}},
+					{Addr: 0, Stmt: assembler.Assign{Dest: assembler.Register{Name: "R1"}, Value: assembler.Immediate{Value: 10}}},
+					{Addr: 1, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "loop"}}},
+					{Addr: 2, Stmt: assembler.Skip{}},
 				},
 				Labels: map[string]int{
 					"start": 0,
@@ -27,10 +27,10 @@ func TestGenerateAsm(t *testing.T) {
 				},
 			},
 			want: `start:
-SET R1, 10
-JMP loop
+R1 <- 10
+jmp loop
 loop:
-HALT
+skip
 `,
 			wantErr: false,
 		},
@@ -38,8 +38,8 @@ HALT
 			name: "代入命令",
 			input: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "<-", Operands: []string{"x", "R1"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "<-", Operands: []string{"R2", "x"}}},
+					{Addr: 0, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.Register{Name: "R1"}}},
+					{Addr: 1, Stmt: assembler.Assign{Dest: assembler.Register{Name: "R2"}, Value: assembler.Register{Name: "x"}}},
 				},
 				Labels: map[string]int{},
 			},
@@ -52,13 +52,13 @@ R2 <- x
 			name: "オペランドなしの命令",
 			input: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "NOP", Operands: []string{}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "RET", Operands: []string{}}},
+					{Addr: 0, Stmt: assembler.Skip{}},
+					{Addr: 1, Stmt: assembler.Spbarr{}},
 				},
 				Labels: map[string]int{},
 			},
-			want: `NOP
-RET
+			want: `skip
+spbarr
 `,
 			wantErr: false,
 		},
@@ -66,9 +66,9 @@ RET
 			name: "複数のラベル",
 			input: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "SET", Operands: []string{"R1", "0"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "JMP", Operands: []string{"middle"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "HALT", Operands: []string{}}},
+					{Addr: 0, Stmt: assembler.Assign{Dest: assembler.Register{Name: "R1"}, Value: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "middle"}}},
+					{Addr: 2, Stmt: assembler.Skip{}},
 				},
 				Labels: map[string]int{
 					"start":  0,
@@ -76,10 +76,10 @@ RET
 				},
 			},
 			want: `start:
-SET R1, 0
-JMP middle
+R1 <- 0
+jmp middle
 middle:
-HALT
+skip
 `,
 			wantErr: false,
 		},
@@ -87,16 +87,16 @@ HALT
 			name: "Loop expander",
 			input: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "add", Operands: []string{"x", "1"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "LoopStart_0"}}},
-					{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"programEnd"}}},
-					{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "add", Operands: []string{"x", "1"}}},
-					{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "LoopStart_1"}}},
-					{Addr: 6, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"programEnd"}}},
-					{Addr: 7, OpCode: assembler.OpCode{Mnemonic: "add", Operands: []string{"x", "1"}}},
-					{Addr: 8, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "LoopStart_2"}}},
-					{Addr: 9, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"programEnd"}}},
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "+", Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 2, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "LoopStart_0"}}},
+					{Addr: 3, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
+					{Addr: 4, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "+", Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 5, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "LoopStart_1"}}},
+					{Addr: 6, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
+					{Addr: 7, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "+", Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 8, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "LoopStart_2"}}},
+					{Addr: 9, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
 				},
 				Labels: map[string]int{
 					"LoopStart":   1,
@@ -108,15 +108,15 @@ HALT
 			},
 			want: `load x, 0
 LoopStart:
-add x, 1
+x <- x + 1
 beqz x, LoopStart_0
 jmp programEnd
 LoopStart_0:
-add x, 1
+x <- x + 1
 beqz x, LoopStart_1
 jmp programEnd
 LoopStart_1:
-add x, 1
+x <- x + 1
 beqz x, LoopStart_2
 jmp programEnd
 LoopStart_2:
@@ -130,14 +130,14 @@ programEnd:
 					"End": 5,
 				},
 				Program: []assembler.Instruction{
-					{0, assembler.OpCode{"<-", []string{"x", "v<y"}}},
-					{1, assembler.OpCode{"beqz", []string{"x", "End"}}},
-					{2, assembler.OpCode{"spbarr", []string{""}}},
-					{3, assembler.OpCode{"load", []string{"v", "v"}}},
-					{4, assembler.OpCode{"load", []string{"v", "v"}}},
+					{Addr: 0, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "<", Left: assembler.Register{Name: "v"}, Right: assembler.Register{Name: "y"}}}},
+					{Addr: 1, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "End"}}},
+					{Addr: 2, Stmt: assembler.Spbarr{}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "v"}, Addr: assembler.Register{Name: "v"}}},
+					{Addr: 4, Stmt: assembler.Load{Dest: assembler.Register{Name: "v"}, Addr: assembler.Register{Name: "v"}}},
 				},
 			},
-			want: `x <- v<y
+			want: `x <- v < y
 beqz x, End
 spbarr
 load v, v
@@ -17,10 +17,11 @@ type OpCode struct {
 	Operands []string
 }
 
-// p/2に対応：アドレスと命令のペアを保持
+// Instruction は、アドレスと命令のペアを表す構造体
+// 命令の内容は Stmt だけが表します。OpCode (文字列のオペランド) は出力するときに Op で Stmt から作ります。
 type Instruction struct {
-	Addr   int
-	OpCode OpCode
+	Addr int
+	Stmt Stmt
 }
 
 // μAsmアセンブラを表す構造体
@@ -30,7 +31,12 @@ type Assembler struct {
 }
 
 func (inst Instruction) String() string {
-	return fmt.Sprintf("Addr: %d, OpCode: %s", inst.Addr, inst.OpCode.String())
+	return fmt.Sprintf("Addr: %d, OpCode: %s", inst.Addr, inst.Op().String())
+}
+
+// Op は、命令を出力用の OpCode として返します。
+func (inst Instruction) Op() OpCode {
+	return Encode(inst.Stmt)
 }
 
 // Instructionインターフェースの実装：OpCode
@@ -42,3 +48,34 @@ func (op OpCode) String() string {
 func (l Label) String() string {
 	return fmt.Sprintf("label %s", l.Name)
 }
+
+// JumpTarget は、jmp, beqz 命令のジャンプ先の式を返します。ジャンプ命令でない場合は false を返します。
+func (inst Instruction) JumpTarget() (Expr, bool) {
+	switch s := inst.Stmt.(type) {
+	case Jmp:
+		return s.Target, true
+	case Beqz:
+		return s.Target, true
+	}
+	return nil, false
+}
+
+// JumpLabel は、jmp, beqz 命令のジャンプ先がラベルの場合にその名前を返します。
+func (inst Instruction) JumpLabel() (string, bool) {
+	target, _ := inst.JumpTarget()
+	label, ok := target.(LabelRef)
+	return label.Name, ok
+}
+
+// WithJumpLabel は、jmp, beqz 命令のジャンプ先をラベル name に置き換えた命令を返します。元の命令は変更しません。
+func (inst Instruction) WithJumpLabel(name string) Instruction {
+	switch s := inst.Stmt.(type) {
+	case Jmp:
+		s.Target = LabelRef{Name: name}
+		inst.Stmt = s
+	case Beqz:
+		s.Target = LabelRef{Name: name}
+		inst.Stmt = s
+	}
+	return inst
+}
@@ -2,72 +2,231 @@ package assembler
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+// ParseError は、アセンブリファイルの構文エラーを表す構造体
+type ParseError struct {
+	File    string // ファイル名 (不明な場合は空文字列)
+	Line    int    // 行番号 (1 始まり)
+	Column  int    // 列番号 (1 始まり、文字単位)
+	Message string // エラーの内容
+}
+
+func (e *ParseError) Error() string {
+	file := e.File
+	if file == "" {
+		file = "<input>"
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", file, e.Line, e.Column, e.Message)
+}
+
 // ParseAsm はμAsmのアセンブリのファイルを読み込み、Assembler構造体に変換します。
 func ParseAsm(r io.Reader) (*Assembler, error) {
+	return ParseAsmFile("", r)
+}
+
+// ParseAsmFile は ParseAsm と同様にアセンブリを読み込みます。
+// 構文エラーは filename と行番号・列番号を含む *ParseError として返します。
+func ParseAsmFile(filename string, r io.Reader) (*Assembler, error) {
 	assembler := &Assembler{
 		Program: make([]Instruction, 0),
 		Labels:  make(map[string]int),
 	}
 	scanner := bufio.NewScanner(r)
 	addr := 0
+	lineNo := 0
+	// beqz のジャンプ先のラベルは後の行で定義できるため、ファイルの末尾で未定義のものをエラーにする
+	var branchTargets []labelUse
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "%") { // 空行またはコメント行はスキップ
+		lineNo++
+		p := &lineParser{file: filename, lineNo: lineNo, text: scanner.Text()}
+
+		// コメント (% 以降) を取り除く
+		i, err := p.commentStart()
+		if err != nil {
+			return nil, err
+		}
+		if i != -1 {
+			p.text = p.text[:i]
+		}
+		line := strings.TrimSpace(p.text)
+		if line == "" { // 空行またはコメント行はスキップ
 			continue
 		}
+		start := strings.Index(p.text, line)
+
 		if strings.HasSuffix(line, ":") { // ラベル行
-			labelName := strings.TrimSuffix(line, ":")
-			assembler.Labels[labelName] = addr
-		} else { // 命令行
-			// 代入命令の判定と分割
-			if strings.Contains(line, "<-") {
-				parts := strings.Split(line, "<-")
-				if len(parts) == 2 {
-					mnemonic := "<-"
-					operands := []string{strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])}
-					assembler.Program = append(assembler.Program, Instruction{Addr: addr, OpCode: OpCode{Mnemonic: mnemonic, Operands: operands}})
-					addr++
-					continue
-				}
+			labelName := strings.TrimSpace(strings.TrimSuffix(line, ":"))
+			if !isIdentifier(labelName) {
+				return nil, p.errorf(start, "invalid label name %q", labelName)
 			}
-
-			// spbarr
-			if strings.Contains(line, "spbarr") {
-				mnemonic := "spbarr"
-				assembler.Program = append(assembler.Program, Instruction{Addr: addr, OpCode: OpCode{
-					Mnemonic: mnemonic,
-				}})
-				addr++
-				continue
+			if _, exists := assembler.Labels[labelName]; exists {
+				return nil, p.errorf(start, "duplicate label %q", labelName)
 			}
+			assembler.Labels[labelName] = addr
+			continue
+		}
 
-			// 命令行
-			parts := strings.Fields(line)
-			if len(parts) > 1 { // ニーモニックとオペランドがあることを確認
-				mnemonic := parts[0]
-				operands := []string{parts[1]} // 初期値として最初の要素をオペランドに設定
-
-				// カンマが含まれていればカンマで分割
-				if strings.Contains(operands[0], ",") {
-					operands = strings.Split(operands[0], ",")
-					// オペランドの前後の空白を削除
-					for i := range operands {
-						operands[i] = strings.TrimSpace(operands[i])
-					}
-				}
-
-				assembler.Program = append(assembler.Program, Instruction{Addr: addr, OpCode: OpCode{Mnemonic: mnemonic, Operands: operands}})
-				addr++
+		// 命令行
+		stmt, err := p.parseInstruction(start, line)
+		if err != nil {
+			return nil, err
+		}
+		if beqz, ok := stmt.(Beqz); ok {
+			if label, ok := beqz.Target.(LabelRef); ok {
+				offset := strings.LastIndex(p.text, label.Name)
+				branchTargets = append(branchTargets, labelUse{name: label.Name, err: p.errorf(offset, "undefined label %q", label.Name)})
 			}
 		}
+		assembler.Program = append(assembler.Program, Instruction{Addr: addr, Stmt: stmt})
+		addr++
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, fmt.Errorf("アセンブリファイルのスキャン中にエラーが発生しました: %w", err)
 	}
+	for _, use := range branchTargets {
+		if _, ok := assembler.Labels[use.name]; !ok {
+			return nil, use.err
+		}
+	}
 	return assembler, nil
 }
+
+// labelUse は、ラベルを参照した位置を、未定義の場合に返すエラーとともに表す構造体
+type labelUse struct {
+	name string
+	err  *ParseError
+}
+
+// lineParser は、アセンブリファイルの一行を解析するための補助構造体
+type lineParser struct {
+	file   string
+	lineNo int
+	text   string // コメントを取り除いた行 (列番号の計算に使う)
+}
+
+// errorf は、行内のバイト位置 offset を列番号に変換して ParseError を作ります。
+func (p *lineParser) errorf(offset int, format string, args ...interface{}) *ParseError {
+	return &ParseError{
+		File:    p.file,
+		Line:    p.lineNo,
+		Column:  utf8.RuneCountInString(p.text[:offset]) + 1,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// commentStart は、行のコメントの開始位置 (コメントがない場合は -1) を返します。
+// % は行頭か、ラベルまたは完結した命令の後にある場合だけコメントの開始とみなします。
+// a%3 や a % 3 のように式の途中にある場合は、剰余演算の書き間違いとしてエラーを返します。
+func (p *lineParser) commentStart() (int, error) {
+	i := strings.Index(p.text, "%")
+	if i == -1 {
+		return -1, nil
+	}
+	if i > 0 && !unicode.IsSpace(rune(p.text[i-1])) {
+		return -1, p.errorf(i, "%% must follow whitespace to start a comment; use mod for the remainder")
+	}
+	before := strings.TrimSpace(p.text[:i])
+	if before == "" || strings.HasSuffix(before, ":") {
+		return i, nil
+	}
+	// 命令が完結していない場合のエラーは、コメントを取り除いた後の解析で報告する
+	if _, err := parseLine(before); err != nil {
+		return i, nil
+	}
+	// % を mod に置き換えても命令として読める場合は、コメントではなく剰余演算とみなす
+	if _, err := parseLine(before + " mod " + p.text[i+1:]); err == nil {
+		return -1, p.errorf(i, "%% continues the expression; use mod for the remainder, or put the comment on its own line")
+	}
+	return i, nil
+}
+
+// parseLine は、位置の情報を使わずに命令 line を解析します。
+func parseLine(line string) (Stmt, error) {
+	return (&lineParser{text: line}).parseInstruction(0, line)
+}
+
+// parseInstruction は、行内の位置 start から始まる命令 line を OpCode に分割し、Decode した Stmt を返します。
+// オペランドが不正な場合は、そのオペランドの位置をエラーとして返します。
+func (p *lineParser) parseInstruction(start int, line string) (Stmt, error) {
+	// ニーモニックを取り出す
+	mnemonicEnd := strings.IndexFunc(line, unicode.IsSpace)
+	if mnemonicEnd == -1 {
+		mnemonicEnd = len(line)
+	}
+	mnemonic := line[:mnemonicEnd]
+	arrow := strings.Index(line, "<-")
+	if arrow != -1 && mnemonic != "cmov" { // 代入命令 (x <- e)
+		mnemonic, mnemonicEnd = "<-", 0
+	}
+
+	// カンマ区切りのオペランド (代入命令では <- の左辺まで) に分割
+	body := line[mnemonicEnd:]
+	if arrow != -1 {
+		body = line[mnemonicEnd:arrow]
+	}
+	var operands []string
+	var offsets []int
+	if strings.TrimSpace(body) != "" {
+		offset := start + mnemonicEnd
+		for _, operand := range strings.Split(body, ",") {
+			trimmed := strings.TrimSpace(operand)
+			if trimmed == "" {
+				return nil, p.errorf(offset, "empty operand in %s", mnemonic)
+			}
+			operands = append(operands, trimmed)
+			offsets = append(offsets, offset+strings.Index(operand, trimmed))
+			offset += len(operand) + 1 // カンマの分を含める
+		}
+	} else if mnemonic == "<-" {
+		return nil, p.errorf(start, "missing assignment target before <-")
+	}
+
+	// <- の右辺を最後のオペランドにする
+	if arrow != -1 {
+		tail := line[arrow+2:]
+		expr := strings.TrimSpace(tail)
+		if expr == "" {
+			return nil, p.errorf(start+arrow+2, "missing expression after <-")
+		}
+		// 右辺の y<-z は y < (-z) とも読めるが、二つ目の <- は書き間違いとしてエラーにする
+		if second := strings.Index(tail, "<-"); second != -1 {
+			return nil, p.errorf(start+arrow+2+second, "unexpected second <- in assignment")
+		}
+		operands = append(operands, expr)
+		offsets = append(offsets, start+arrow+2+strings.Index(tail, expr))
+	}
+
+	opCode := OpCode{Mnemonic: mnemonic, Operands: operands}
+	stmt, err := Decode(opCode)
+	if err != nil {
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			return nil, p.errorf(start, "%s", err)
+		}
+		if decodeErr.Operand < 0 || decodeErr.Operand >= len(offsets) {
+			return nil, p.errorf(start, "%s", decodeErr.Message)
+		}
+		return nil, p.errorf(offsets[decodeErr.Operand]+decodeErr.Offset, "%s", decodeErr.Message)
+	}
+	return stmt, nil
+}
+
+// isIdentifier は、ラベル名やレジスタ名として使える識別子かどうかを返します。
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
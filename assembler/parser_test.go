@@ -1,7 +1,10 @@
 package assembler_test
 
 import (
+	"errors"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/taisii/go-project/assembler"
@@ -20,12 +23,12 @@ func TestParseAsm(t *testing.T) {
 					"Loop": 2,
 				},
 				Program: []assembler.Instruction{
-					{0, assembler.OpCode{"<-", []string{"x", "5"}}},
-					{1, assembler.OpCode{"<-", []string{"w", "0"}}},
-					{2, assembler.OpCode{"<-", []string{"w", "w+x"}}},
-					{3, assembler.OpCode{"<-", []string{"x", "x-1"}}},
-					{4, assembler.OpCode{"<-", []string{"y", "x=0"}}},
-					{5, assembler.OpCode{"beqz", []string{"y", "Loop"}}},
+					{Addr: 0, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.Immediate{Value: 5}}},
+					{Addr: 1, Stmt: assembler.Assign{Dest: assembler.Register{Name: "w"}, Value: assembler.Immediate{Value: 0}}},
+					{Addr: 2, Stmt: assembler.Assign{Dest: assembler.Register{Name: "w"}, Value: assembler.BinaryExpr{Op: "+", Left: assembler.Register{Name: "w"}, Right: assembler.Register{Name: "x"}}}},
+					{Addr: 3, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "-", Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 4, Stmt: assembler.Assign{Dest: assembler.Register{Name: "y"}, Value: assembler.BinaryExpr{Op: "==", Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 0}}}},
+					{Addr: 5, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "Loop"}}},
 				},
 			},
 		},
@@ -39,17 +42,17 @@ func TestParseAsm(t *testing.T) {
 					"End": 11,
 				},
 				Program: []assembler.Instruction{
-					{0, assembler.OpCode{"load", []string{"x", "0"}}},
-					{1, assembler.OpCode{"load", []string{"v", "1"}}},
-					{2, assembler.OpCode{"load", []string{"w", "2"}}},
-					{3, assembler.OpCode{"beqz", []string{"x", "L6"}}},
-					{4, assembler.OpCode{"load", []string{"y", "v"}}},
-					{5, assembler.OpCode{"jmp", []string{"L7"}}},
-					{6, assembler.OpCode{"store", []string{"y", "w"}}},
-					{7, assembler.OpCode{"beqz", []string{"x", "L10"}}},
-					{8, assembler.OpCode{"store", []string{"y", "w"}}},
-					{9, assembler.OpCode{"jmp", []string{"End"}}},
-					{10, assembler.OpCode{"load", []string{"y", "v"}}},
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "v"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 2, Stmt: assembler.Load{Dest: assembler.Register{Name: "w"}, Addr: assembler.Immediate{Value: 2}}},
+					{Addr: 3, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "L6"}}},
+					{Addr: 4, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Register{Name: "v"}}},
+					{Addr: 5, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "L7"}}},
+					{Addr: 6, Stmt: assembler.Store{Src: assembler.Register{Name: "y"}, Addr: assembler.Register{Name: "w"}}},
+					{Addr: 7, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "L10"}}},
+					{Addr: 8, Stmt: assembler.Store{Src: assembler.Register{Name: "y"}, Addr: assembler.Register{Name: "w"}}},
+					{Addr: 9, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "End"}}},
+					{Addr: 10, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Register{Name: "v"}}},
 				},
 			},
 		},
@@ -61,26 +64,26 @@ func TestParseAsm(t *testing.T) {
 					"L10": 5,
 				},
 				Program: []assembler.Instruction{
-					{0, assembler.OpCode{"<-", []string{"x", "in>=bound"}}},
-					{1, assembler.OpCode{"beqz", []string{"x", "L3"}}},
-					{2, assembler.OpCode{"jmp", []string{"L10"}}},
-					{3, assembler.OpCode{"load", []string{"secret", "in"}}},
-					{4, assembler.OpCode{"load", []string{"z", "secret"}}},
+					{Addr: 0, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: ">=", Left: assembler.Register{Name: "in"}, Right: assembler.Register{Name: "bound"}}}},
+					{Addr: 1, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "L3"}}},
+					{Addr: 2, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "L10"}}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "secret"}, Addr: assembler.Register{Name: "in"}}},
+					{Addr: 4, Stmt: assembler.Load{Dest: assembler.Register{Name: "z"}, Addr: assembler.Register{Name: "secret"}}},
 				},
 			},
 		},
-				{
+		{
 			filename: "../tests/test4.muasm",
 			expectedAssembly: assembler.Assembler{
 				Labels: map[string]int{
-					"End":  5,
+					"End": 5,
 				},
 				Program: []assembler.Instruction{
-					{0, assembler.OpCode{"<-", []string{"x", "v<y"}}},
-					{1, assembler.OpCode{"beqz", []string{"x", "End"}}},
-					{2, assembler.OpCode{"spbarr", []string{""}}},
-					{3, assembler.OpCode{"load", []string{"v", "v"}}},
-					{4, assembler.OpCode{"load", []string{"v", "v"}}},
+					{Addr: 0, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "<", Left: assembler.Register{Name: "v"}, Right: assembler.Register{Name: "y"}}}},
+					{Addr: 1, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "End"}}},
+					{Addr: 2, Stmt: assembler.Spbarr{}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "v"}, Addr: assembler.Register{Name: "v"}}},
+					{Addr: 4, Stmt: assembler.Load{Dest: assembler.Register{Name: "v"}, Addr: assembler.Register{Name: "v"}}},
 				},
 			},
 		},
@@ -121,10 +124,213 @@ func TestParseAsm(t *testing.T) {
 				if gotInst.Addr != wantInst.Addr {
 					t.Errorf("アドレスが異なります。index: %d, got: %d, want: %d", i, gotInst.Addr, wantInst.Addr)
 				}
-				if gotInst.OpCode.String() != wantInst.OpCode.String() {
-					t.Errorf("命令が異なります。index: %d, got: %s, want: %s", i, gotInst.OpCode.String(), wantInst.OpCode.String())
+				if diff := assembler.DiffInstructions(gotInst, wantInst); diff != "" {
+					t.Errorf("命令が異なります。index: %d, %s", i, diff)
 				}
 			}
 		})
 	}
 }
+
+func TestParseAsmOperandSpacing(t *testing.T) {
+	input := "    load x, 0   % コメント\n    store  y ,  x+1\nL:\n    beqz x,L\n"
+	got, err := assembler.ParseAsm(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseAsmエラー: %v", err)
+	}
+
+	want := []assembler.OpCode{
+		{Mnemonic: "load", Operands: []string{"x", "0"}},
+		{Mnemonic: "store", Operands: []string{"y", "x + 1"}},
+		{Mnemonic: "beqz", Operands: []string{"x", "L"}},
+	}
+	if len(got.Program) != len(want) {
+		t.Fatalf("プログラムの長さが異なります。got: %d, want: %d", len(got.Program), len(want))
+	}
+	for i, wantOp := range want {
+		if diff := assembler.DiffOpCodes(got.Program[i].Op(), wantOp); diff != "" {
+			t.Errorf("命令が異なります。index: %d, %s", i, diff)
+		}
+	}
+}
+
+func TestParseAsmCmovAndSkip(t *testing.T) {
+	input := "skip\ncmov c = 0, x <- y mod 4\n"
+	got, err := assembler.ParseAsm(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseAsmエラー: %v", err)
+	}
+
+	want := []assembler.OpCode{
+		{Mnemonic: "skip", Operands: nil},
+		{Mnemonic: "cmov", Operands: []string{"c == 0", "x", "y mod 4"}},
+	}
+	if len(got.Program) != len(want) {
+		t.Fatalf("プログラムの長さが異なります。got: %d, want: %d", len(got.Program), len(want))
+	}
+	for i, wantOp := range want {
+		if diff := assembler.DiffOpCodes(got.Program[i].Op(), wantOp); diff != "" {
+			t.Errorf("命令が異なります。index: %d, %s", i, diff)
+		}
+	}
+
+	// アセンブリに戻すと Stmt から作った表記 (= は == に正規化される) になることを確認
+	text, err := assembler.GenerateAsm(got)
+	if err != nil {
+		t.Fatalf("GenerateAsmエラー: %v", err)
+	}
+	if want := "skip\ncmov c == 0, x <- y mod 4\n"; text != want {
+		t.Errorf("生成されたアセンブリが異なります。got: %q, want: %q", text, want)
+	}
+}
+
+func TestParseAsmStmt(t *testing.T) {
+	got, err := assembler.ParseAsm(strings.NewReader("L:\n    load v, a+1\n    beqz v, L\n    jmp x\n"))
+	if err != nil {
+		t.Fatalf("parseAsmエラー: %v", err)
+	}
+
+	want := []assembler.Stmt{
+		assembler.Load{Dest: assembler.Register{Name: "v"}, Addr: assembler.BinaryExpr{Op: "+", Left: assembler.Register{Name: "a"}, Right: assembler.Immediate{Value: 1}}},
+		assembler.Beqz{Cond: assembler.Register{Name: "v"}, Target: assembler.LabelRef{Name: "L"}},
+		assembler.Jmp{Target: assembler.LabelRef{Name: "x"}},
+	}
+	if len(got.Program) != len(want) {
+		t.Fatalf("プログラムの長さが異なります。got: %d, want: %d", len(got.Program), len(want))
+	}
+	for i, wantStmt := range want {
+		if !reflect.DeepEqual(got.Program[i].Stmt, wantStmt) {
+			t.Errorf("命令が異なります。index: %d, got: %#v, want: %#v", i, got.Program[i].Stmt, wantStmt)
+		}
+	}
+}
+
+func TestInstructionJumpLabel(t *testing.T) {
+	asm, err := assembler.ParseAsm(strings.NewReader("L:\n    beqz v, L\n    load v, L\n"))
+	if err != nil {
+		t.Fatalf("parseAsmエラー: %v", err)
+	}
+	handBuilt := assembler.Instruction{Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "L"}}}
+
+	testCases := []struct {
+		name        string
+		inst        assembler.Instruction
+		wantLabel   string
+		wantOK      bool
+		wantRenamed string
+	}{
+		{name: "Parsed beqz", inst: asm.Program[0], wantLabel: "L", wantOK: true, wantRenamed: "beqz v, M"},
+		{name: "Not a jump", inst: asm.Program[1], wantOK: false},
+		{name: "Hand-built jmp", inst: handBuilt, wantLabel: "L", wantOK: true, wantRenamed: "jmp M"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			label, ok := tc.inst.JumpLabel()
+			if label != tc.wantLabel || ok != tc.wantOK {
+				t.Fatalf("ジャンプ先が異なります。got: %q %v, want: %q %v", label, ok, tc.wantLabel, tc.wantOK)
+			}
+			if !ok {
+				return
+			}
+
+			// 置き換えた命令はジャンプ先だけが変わり、元の命令は変わらない
+			renamed := tc.inst.WithJumpLabel("M")
+			if label, _ := renamed.JumpLabel(); label != "M" {
+				t.Errorf("置き換え後のジャンプ先が異なります。got: %q", label)
+			}
+			if renamed.Stmt.String() != tc.wantRenamed {
+				t.Errorf("Stmt が置き換えられていません。got: %q", renamed.Stmt.String())
+			}
+			if label, _ := tc.inst.JumpLabel(); label != "L" || tc.inst.Op().Operands[len(tc.inst.Op().Operands)-1] != "L" {
+				t.Errorf("元の命令が変更されました。got: %v", tc.inst)
+			}
+		})
+	}
+}
+
+func TestParseAsmErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected assembler.ParseError
+	}{
+		{
+			name:     "missing operands",
+			input:    "x <- 1\n    load\n",
+			expected: assembler.ParseError{File: "test.muasm", Line: 2, Column: 5, Message: "load requires 2 operands, got 0"},
+		},
+		{
+			name:     "too many operands",
+			input:    "  jmp L, M\n",
+			expected: assembler.ParseError{File: "test.muasm", Line: 1, Column: 3, Message: "jmp requires 1 operands, got 2"},
+		},
+		{
+			name:     "empty operand",
+			input:    "load x,\n",
+			expected: assembler.ParseError{File: "test.muasm", Line: 1, Column: 8, Message: "empty operand in load"},
+		},
+		{
+			name:     "unknown instruction",
+			input:    "% header\n\n  lod x, 0 % typo\n",
+			expected: assembler.ParseError{File: "test.muasm", Line: 3, Column: 3, Message: `unknown instruction "lod"`},
+		},
+		{
+			name:     "remainder written with %",
+			input:    "x <- a%3\n",
+			expected: assembler.ParseError{File: "test.muasm", Line: 1, Column: 7, Message: "% must follow whitespace to start a comment; use mod for the remainder"},
+		},
+		{
+			name:     "second assignment arrow",
+			input:    "x <- y <- z\n",
+			expected: assembler.ParseError{File: "test.muasm", Line: 1, Column: 8, Message: "unexpected second <- in assignment"},
+		},
+		{
+			name:     "remainder written with % after whitespace",
+			input:    "x <- a % 3\n",
+			expected: assembler.ParseError{File: "test.muasm", Line: 1, Column: 8, Message: "% continues the expression; use mod for the remainder, or put the comment on its own line"},
+		},
+		{
+			name:     "undefined branch label",
+			input:    "    beqz x, End\nL:\n    beqz x,  Nowhere % typo\nEnd:\n",
+			expected: assembler.ParseError{File: "test.muasm", Line: 3, Column: 14, Message: `undefined label "Nowhere"`},
+		},
+		{
+			name:     "missing expression",
+			input:    "x <-   \n",
+			expected: assembler.ParseError{File: "test.muasm", Line: 1, Column: 5, Message: "missing expression after <-"},
+		},
+		{
+			name:     "invalid expression",
+			input:    "x <- y + * 2\n",
+			expected: assembler.ParseError{File: "test.muasm", Line: 1, Column: 10, Message: `unexpected token "*"`},
+		},
+		{
+			name:     "load into expression",
+			input:    "load x+1, 0\n",
+			expected: assembler.ParseError{File: "test.muasm", Line: 1, Column: 6, Message: `load destination must be a register, got "x+1"`},
+		},
+		{
+			name:     "beqz to expression",
+			input:    "beqz x, y+1\n",
+			expected: assembler.ParseError{File: "test.muasm", Line: 1, Column: 9, Message: `beqz target must be a label or an address, got "y+1"`},
+		},
+		{
+			name:     "duplicate label",
+			input:    "L:\n  spbarr\nL:\n",
+			expected: assembler.ParseError{File: "test.muasm", Line: 3, Column: 1, Message: `duplicate label "L"`},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := assembler.ParseAsmFile("test.muasm", strings.NewReader(tc.input))
+			var parseErr *assembler.ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected ParseError, but got %v", err)
+			}
+			if *parseErr != tc.expected {
+				t.Errorf("unexpected error: got %q, want %q", parseErr.Error(), tc.expected.Error())
+			}
+		})
+	}
+}
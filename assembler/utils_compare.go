@@ -8,7 +8,7 @@ import (
 
 // CompareInstructions は、2つの Instruction を比較する関数です。
 func CompareInstructions(a, b Instruction) bool {
-	return a.Addr == b.Addr && a.OpCode.String() == b.OpCode.String()
+	return a.Addr == b.Addr && a.Op().String() == b.Op().String()
 }
 
 // diffInstructions は、2つの Instruction を比較し、差分をわかりやすく出力する関数です。
@@ -18,7 +18,7 @@ func DiffInstructions(a, b Instruction) string {
 	}
 
 	// OpCode のフィールドを再帰的に比較
-	return DiffOpCodes(a.OpCode, b.OpCode)
+	return DiffOpCodes(a.Op(), b.Op())
 }
 
 // diffOpCodes は、2つの OpCode を比較し、差分をわかりやすく出力する関数です。
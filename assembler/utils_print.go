@@ -18,8 +18,8 @@ func DumpBasic(asm *Assembler) {
 
     fmt.Println("\nProgram:")
     for _, inst := range asm.Program {
-        operands := strings.Join(inst.OpCode.Operands, ", ")
-        fmt.Printf("%d:\t%s %s\n", inst.Addr, inst.OpCode.Mnemonic, operands)
+        operands := strings.Join(inst.Op().Operands, ", ")
+        fmt.Printf("%d:\t%s %s\n", inst.Addr, inst.Op().Mnemonic, operands)
     }
 }
 
@@ -37,8 +37,8 @@ func DumpBasicString(asm *Assembler) string {
 
 	sb.WriteString("\nProgram:\n")
 	for _, inst := range asm.Program {
-		operands := strings.Join(inst.OpCode.Operands, ", ")
-		sb.WriteString(fmt.Sprintf("%d:\t%s %s\n", inst.Addr, inst.OpCode.Mnemonic, operands))
+		operands := strings.Join(inst.Op().Operands, ", ")
+		sb.WriteString(fmt.Sprintf("%d:\t%s %s\n", inst.Addr, inst.Op().Mnemonic, operands))
 	}
 
 	return sb.String()
@@ -77,20 +77,7 @@ func FormatAsm(asm *Assembler) string {
 
 		// 命令の出力 (インデント付き)
 		sb.WriteString("\t")
-		if instruction.OpCode.Mnemonic == "<-" && len(instruction.OpCode.Operands) == 2 {
-			sb.WriteString(instruction.OpCode.Operands[0])
-			sb.WriteString(" <- ")
-			sb.WriteString(instruction.OpCode.Operands[1])
-		} else {
-			sb.WriteString(instruction.OpCode.Mnemonic)
-			if len(instruction.OpCode.Operands) > 0 {
-				operands := strings.Join(instruction.OpCode.Operands, ", ")
-				if operands != "" { // spbarrのようなオペランドが空文字列の場合に対応
-					sb.WriteString(" ")
-					sb.WriteString(operands)
-				}
-			}
-		}
+		sb.WriteString(sourceText(instruction.Op()))
 		sb.WriteString("\n")
 	}
 
@@ -145,7 +132,7 @@ func DumpFormatted(asm *Assembler) {
                 fmt.Printf("%s:\n", label)
             }
         }
-        operands := strings.Join(inst.OpCode.Operands, ", ")
-        fmt.Printf("\t%d:\t%s %s\n", inst.Addr, inst.OpCode.Mnemonic, operands)
+        operands := strings.Join(inst.Op().Operands, ", ")
+        fmt.Printf("\t%d:\t%s %s\n", inst.Addr, inst.Op().Mnemonic, operands)
     }
 }
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/taisii/go-project/assembler"
+	"github.com/taisii/go-project/executor"
+	"github.com/taisii/go-project/loop_expander"
+	"github.com/taisii/go-project/report"
+)
+
+// 展開したプログラムの出力ファイルの接尾辞 (batch の入力からは除外します)
+const expandedSuffix = ".expanded.muasm"
+
+// batchAnalysis は、batch で展開後のプログラムに対して行う解析の種類
+type batchAnalysis string
+
+const (
+	analysisNone  batchAnalysis = "none"
+	analysisExec  batchAnalysis = "exec"
+	analysisSpec  batchAnalysis = "spec"
+	analysisCheck batchAnalysis = "check"
+)
+
+// batchJob は、batch のすべてのファイルで共通の設定
+type batchJob struct {
+	outputDir        string
+	unrollCount      int
+	innerUnrollCount int
+	analysis         batchAnalysis
+	json             bool
+	quiet            bool
+	exec             execFlags
+	specOptions      executor.SpecOptions
+}
+
+// batchResult は、一つの入力ファイルの処理結果
+type batchResult struct {
+	input      string
+	outputs    []string
+	loops      int
+	sizeBefore int
+	sizeAfter  int
+	paths      int
+	secure     *bool
+	undecided  bool     // check でリークは見つからなかったが、判定できなかったパスがある
+	warnings   []string // 制御フローグラフの警告
+	elapsed    time.Duration
+	err        error
+}
+
+func runBatch(args []string, _ io.Reader, stdout, stderr io.Writer) int {
+	var job batchJob
+	var ex execFlags
+	var sp specFlags
+	var analysis string
+	var workers int
+	fs := newFlagSet("batch", stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "使い方: go-project batch [オプション] <ディレクトリまたはグロブ>...")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&job.outputDir, "o", "", "出力ディレクトリ (指定しない場合は各入力ファイルと同じディレクトリ)")
+	fs.IntVar(&job.unrollCount, "n", 2, "ループ展開回数 (0 の場合は展開しない)")
+	fs.IntVar(&job.innerUnrollCount, "inner-n", 0, "ネストしたループの展開回数 (指定しない場合は -n と同じ)")
+	fs.StringVar(&analysis, "analysis", string(analysisNone), "展開後に行う解析: none, exec, spec, check")
+	fs.IntVar(&workers, "j", runtime.NumCPU(), "並列に処理するファイルの数")
+	fs.BoolVar(&job.json, "json", false, "解析結果と一覧を JSON 形式で出力する")
+	fs.BoolVar(&job.quiet, "q", false, "警告を標準エラー出力に表示しない")
+	ex.register(fs)
+	sp.register(fs)
+	// parseFlags と異なり、位置引数として入力を受け取る
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		return fail(stderr, exitUsage, errors.New("入力のディレクトリまたはグロブを指定してください"))
+	}
+	if job.unrollCount < 0 || job.innerUnrollCount < 0 {
+		return fail(stderr, exitUsage, errors.New("展開回数は正の整数である必要があります"))
+	}
+	if workers <= 0 {
+		return fail(stderr, exitUsage, errors.New("-j は正の整数である必要があります"))
+	}
+	switch batchAnalysis(analysis) {
+	case analysisNone, analysisExec, analysisSpec, analysisCheck:
+		job.analysis = batchAnalysis(analysis)
+	default:
+		return fail(stderr, exitUsage, fmt.Errorf("不明な解析です: %s (none, exec, spec, check のいずれか)", analysis))
+	}
+	opts, err := sp.options()
+	if err != nil {
+		return fail(stderr, exitUsage, err)
+	}
+	job.exec = ex
+	job.specOptions = opts
+
+	inputs, err := collectInputs(fs.Args())
+	if err != nil {
+		return fail(stderr, exitError, err)
+	}
+	if job.outputDir != "" {
+		if err := checkOutputNames(inputs); err != nil {
+			return fail(stderr, exitUsage, err)
+		}
+		if err := os.MkdirAll(job.outputDir, 0755); err != nil {
+			return fail(stderr, exitError, fmt.Errorf("出力ディレクトリの作成に失敗しました: %w", err))
+		}
+	}
+
+	results := job.runAll(inputs, workers)
+
+	var out bytes.Buffer
+	if job.json {
+		doc := report.Document{Kind: report.KindBatch, Batch: job.newBatch(results)}
+		if err := report.Write(&out, doc); err != nil {
+			return fail(stderr, exitError, fmt.Errorf("JSON の生成に失敗しました: %w", err))
+		}
+	} else {
+		job.fprintSummary(&out, results)
+	}
+	if _, err := io.Copy(stdout, &out); err != nil {
+		return fail(stderr, exitError, err)
+	}
+
+	code := exitOK
+	for _, result := range results {
+		// 警告はゴルーチンの中ではなく、入力の順にここで表示する
+		if !job.quiet {
+			for _, warning := range result.warnings {
+				fmt.Fprintf(stderr, "%s: %s\n", result.input, warning)
+			}
+		}
+		if result.err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", result.input, result.err)
+			code = exitError
+		} else if result.undecided && code == exitOK {
+			code = exitUndecided
+		} else if result.secure != nil && !*result.secure && code != exitError {
+			code = exitLeak
+		}
+	}
+	return code
+}
+
+// collectInputs は、ディレクトリ (直下の .muasm ファイル)、グロブ、ファイル名の一覧を
+// 重複のない昇順のファイル名の一覧に展開します。.muasm 以外のファイルと、展開したプログラムの出力ファイルは除外します。
+func collectInputs(patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	inputs := make([]string, 0)
+	for _, pattern := range patterns {
+		if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+			pattern = filepath.Join(pattern, "*.muasm")
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("不正なグロブです: %s: %w", pattern, err)
+		}
+		found := false
+		for _, match := range matches {
+			if filepath.Ext(match) != ".muasm" || strings.HasSuffix(match, expandedSuffix) {
+				continue
+			}
+			if info, err := os.Stat(match); err != nil || info.IsDir() {
+				continue
+			}
+			found = true
+			if !seen[match] {
+				seen[match] = true
+				inputs = append(inputs, match)
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("入力ファイルが見つかりません: %s", pattern)
+		}
+	}
+	sort.Strings(inputs)
+	return inputs, nil
+}
+
+// checkOutputNames は、出力ディレクトリに書き込む場合に、ファイル名が衝突しないことを確認します。
+func checkOutputNames(inputs []string) error {
+	seen := make(map[string]string)
+	for _, input := range inputs {
+		base := filepath.Base(input)
+		if other, ok := seen[base]; ok {
+			return fmt.Errorf("出力ファイル名が衝突します: %s と %s", other, input)
+		}
+		seen[base] = input
+	}
+	return nil
+}
+
+// runAll は、workers 個のゴルーチンで inputs を処理し、inputs と同じ順で結果を返します。
+func (job *batchJob) runAll(inputs []string, workers int) []batchResult {
+	results := make([]batchResult, len(inputs))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(inputs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i] = job.process(inputs[i])
+			}
+		}()
+	}
+	for i := range inputs {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	return results
+}
+
+// process は、一つの入力ファイルを展開、解析し、結果をファイルに書き込みます。
+func (job *batchJob) process(input string) batchResult {
+	start := time.Now()
+	result := batchResult{input: input}
+	result.err = job.processInto(&result)
+	result.elapsed = time.Since(start)
+	return result
+}
+
+func (job *batchJob) processInto(result *batchResult) error {
+	asm, err := parseProgram(result.input)
+	if err != nil {
+		return err
+	}
+	result.sizeBefore = len(asm.Program)
+	cfg, err := loop_expander.BuildControlFlowGraph(asm)
+	if err != nil {
+		return fmt.Errorf("制御フローグラフの構築に失敗しました: %w", err)
+	}
+	result.loops = len(loop_expander.DetectLoops(cfg))
+	result.warnings = cfg.Warnings
+
+	expandedAsm, err := expandProgram(asm, job.unrollCount, job.innerUnrollCount)
+	if err != nil {
+		return err
+	}
+	result.sizeAfter = len(expandedAsm.Program)
+
+	base := job.outputBase(result.input)
+	if job.unrollCount > 0 {
+		output, err := assembler.GenerateAsm(expandedAsm)
+		if err != nil {
+			return fmt.Errorf("アセンブリコードの生成に失敗しました: %w", err)
+		}
+		if err := job.write(result, base+expandedSuffix, output+"\n"); err != nil {
+			return err
+		}
+	}
+	if job.analysis == analysisNone {
+		return nil
+	}
+
+	policy, err := executor.LoadPolicyFile(result.input)
+	if err != nil {
+		return fmt.Errorf("ポリシーの読み込みに失敗しました: %w", err)
+	}
+	if policy, err = job.exec.extendPolicy(policy); err != nil {
+		return err
+	}
+	doc := report.Document{Source: result.input}
+	var text string
+	switch job.analysis {
+	case analysisExec, analysisSpec:
+		var finalConfigs []*executor.Configuration
+		if job.analysis == analysisExec {
+			finalConfigs, err = executor.RunAssembler(expandedAsm, policy.Configuration(), job.exec.steps(false))
+		} else {
+			finalConfigs, err = executor.SpecRunAssemblerWithOptions(expandedAsm, policy.Configuration(), job.exec.steps(true), job.specOptions)
+		}
+		if err != nil {
+			return fmt.Errorf("実行に失敗しました: %w", err)
+		}
+		result.paths = len(finalConfigs)
+		doc.Kind = report.KindConfigurations
+		doc.Paths = report.NewConfigurations(finalConfigs)
+		text = formatConfigurations(finalConfigs)
+	case analysisCheck:
+		sni, err := executor.CheckSNIWithOptions(expandedAsm, policy.Policy, policy.Configuration(), job.exec.steps(true), job.specOptions)
+		if err != nil {
+			return fmt.Errorf("検査に失敗しました: %w", err)
+		}
+		result.paths = sni.Paths
+		result.secure = &sni.Secure
+		result.undecided = len(sni.Leaks) == 0 && len(sni.Inconclusive) > 0
+		doc.Kind = report.KindCheck
+		doc.Paths = report.NewConfigurations(sni.Configs)
+		doc.Check = report.NewCheck(sni, sni.Configs)
+		text = formatCheck(sni)
+	}
+
+	if !job.json {
+		return job.write(result, base+"."+string(job.analysis)+".txt", text)
+	}
+	var out bytes.Buffer
+	if err := report.Write(&out, doc); err != nil {
+		return fmt.Errorf("JSON の生成に失敗しました: %w", err)
+	}
+	return job.write(result, base+"."+string(job.analysis)+".json", out.String())
+}
+
+// outputBase は、input の出力ファイル名から接尾辞を除いた部分を返します。
+func (job *batchJob) outputBase(input string) string {
+	base := strings.TrimSuffix(input, filepath.Ext(input))
+	if job.outputDir != "" {
+		base = filepath.Join(job.outputDir, filepath.Base(base))
+	}
+	return base
+}
+
+// write は、output を path に書き込み、result の出力ファイルに追加します。
+func (job *batchJob) write(result *batchResult, path, output string) error {
+	if err := os.WriteFile(path, []byte(output), 0644); err != nil {
+		return fmt.Errorf("出力ファイルへの書き込みに失敗しました: %w", err)
+	}
+	result.outputs = append(result.outputs, path)
+	return nil
+}
+
+// fprintSummary は、処理結果の一覧を表として w に出力します。
+func (job *batchJob) fprintSummary(w io.Writer, results []batchResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "File\tLoops\tBefore\tAfter\tPaths\tTime\tResult")
+	var total time.Duration
+	failed := 0
+	for _, result := range results {
+		total += result.elapsed
+		paths := "-"
+		if job.analysis != analysisNone && result.err == nil {
+			paths = fmt.Sprint(result.paths)
+		}
+		status := "ok"
+		switch {
+		case result.err != nil:
+			failed++
+			status = "error: " + firstLine(result.err.Error())
+		case result.secure != nil && *result.secure:
+			status = "secure"
+		case result.undecided:
+			status = "inconclusive"
+		case result.secure != nil:
+			status = "insecure"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\t%s\n", result.input, result.loops, result.sizeBefore, result.sizeAfter, paths, result.elapsed.Round(time.Microsecond), status)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "Files: %d, Errors: %d, Total time: %s\n", len(results), failed, total.Round(time.Microsecond))
+}
+
+// newBatch は、処理結果の一覧を report.Batch に変換します。
+func (job *batchJob) newBatch(results []batchResult) *report.Batch {
+	batch := &report.Batch{Analysis: string(job.analysis), Files: make([]report.BatchFile, 0, len(results))}
+	for _, result := range results {
+		file := report.BatchFile{
+			Source:         result.input,
+			Outputs:        append([]string{}, result.outputs...),
+			Loops:          result.loops,
+			SizeBefore:     result.sizeBefore,
+			SizeAfter:      result.sizeAfter,
+			Paths:          result.paths,
+			Secure:         result.secure,
+			ElapsedSeconds: result.elapsed.Seconds(),
+		}
+		if result.err != nil {
+			file.Error = result.err.Error()
+		}
+		batch.Files = append(batch.Files, file)
+	}
+	return batch
+}
+
+// firstLine は、s の最初の行を返します (表の一行に収めるため)。
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
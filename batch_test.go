@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/taisii/go-project/report"
+)
+
+// writeFiles は、dir に files の各ファイルを作成します。
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, source := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollectInputs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.muasm":          "",
+		"b.muasm":          "",
+		"b.expanded.muasm": "",
+		"b.check.txt":      "",
+	})
+	a := filepath.Join(dir, "a.muasm")
+	b := filepath.Join(dir, "b.muasm")
+
+	testCases := []struct {
+		Name     string
+		Patterns []string
+		Expected []string
+	}{
+		{Name: "Directory", Patterns: []string{dir}, Expected: []string{a, b}},
+		{Name: "Glob", Patterns: []string{filepath.Join(dir, "b*")}, Expected: []string{b}},
+		{Name: "Duplicates", Patterns: []string{b, dir, a}, Expected: []string{a, b}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			actual, err := collectInputs(testCase.Patterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, testCase.Expected) {
+				t.Errorf("expected %v, got %v", testCase.Expected, actual)
+			}
+		})
+	}
+
+	if _, err := collectInputs([]string{filepath.Join(dir, "*.txt")}); err == nil {
+		t.Error("expected an error for a glob without .muasm files")
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"loop.muasm":   "    x<-5\nLoop:\n    x<-x-1\n    beqz x,Loop\n",
+		"gadget.muasm": "%! public y\n    x<-v<y\n    beqz x,End\n    load v,v\n    load v,v\nEnd:\n",
+	})
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"batch", "-n", "1", "-j", "2", "-analysis", "check", dir}, strings.NewReader(""), &stdout, &stderr)
+	if code != exitLeak {
+		t.Fatalf("expected exit code %d, got %d\nstdout:\n%s\nstderr:\n%s", exitLeak, code, stdout.String(), stderr.String())
+	}
+	for _, expected := range []string{"File", "gadget.muasm", "insecure", "loop.muasm", "secure", "Files: 2, Errors: 0"} {
+		if !strings.Contains(stdout.String(), expected) {
+			t.Errorf("expected the summary to contain %q, got:\n%s", expected, stdout.String())
+		}
+	}
+	for _, name := range []string{"loop.expanded.muasm", "loop.check.txt", "gadget.expanded.muasm", "gadget.check.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s next to the input: %v", name, err)
+		}
+	}
+}
+
+func TestRunBatchOutputDirectory(t *testing.T) {
+	dir := t.TempDir()
+	outputDir := filepath.Join(t.TempDir(), "out")
+	writeFiles(t, dir, map[string]string{
+		"loop.muasm":   "    x<-5\nLoop:\n    x<-x-1\n    beqz x,Loop\n",
+		"broken.muasm": "    foo x\n",
+	})
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"batch", "-json", "-o", outputDir, "-analysis", "exec", filepath.Join(dir, "*.muasm")}, strings.NewReader(""), &stdout, &stderr)
+	if code != exitError {
+		t.Fatalf("expected exit code %d, got %d\nstderr:\n%s", exitError, code, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "broken.muasm") {
+		t.Errorf("expected the error to name broken.muasm, got %q", stderr.String())
+	}
+
+	var doc report.Document
+	if err := json.Unmarshal(stdout.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to decode %s: %v", stdout.String(), err)
+	}
+	if doc.Kind != report.KindBatch || doc.Batch == nil || len(doc.Batch.Files) != 2 {
+		t.Fatalf("unexpected summary %+v", doc)
+	}
+	broken, loop := doc.Batch.Files[0], doc.Batch.Files[1]
+	if broken.Error == "" {
+		t.Errorf("expected an error for %s", broken.Source)
+	}
+	if loop.Error != "" || loop.Loops != 1 || loop.SizeBefore != 3 || loop.SizeAfter <= loop.SizeBefore || loop.Paths != 1 {
+		t.Errorf("unexpected result %+v", loop)
+	}
+	expectedOutputs := []string{filepath.Join(outputDir, "loop.expanded.muasm"), filepath.Join(outputDir, "loop.exec.json")}
+	if !reflect.DeepEqual(loop.Outputs, expectedOutputs) {
+		t.Errorf("expected outputs %v, got %v", expectedOutputs, loop.Outputs)
+	}
+	for _, output := range expectedOutputs {
+		if _, err := os.Stat(output); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,594 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/taisii/go-project/assembler"
+	"github.com/taisii/go-project/executor"
+	"github.com/taisii/go-project/loop_expander"
+	"github.com/taisii/go-project/report"
+)
+
+// stdinName は、標準入力から読み込んだプログラムのエラーメッセージや出力での名前です。
+const stdinName = "<stdin>"
+
+// inputFlags は、すべてのサブコマンドで共通の入出力のオプション
+type inputFlags struct {
+	input            string
+	output           string
+	unrollCount      int
+	innerUnrollCount int
+	json             bool
+	quiet            bool
+
+	stdin  io.Reader // -i を指定しない場合、または - の場合の入力
+	source []byte    // 標準入力から読み込んだプログラム (ポリシーの %! の宣言を読むために保持する)
+}
+
+// register は、共通のオプションを fs に登録します。defaultUnroll は -n の既定値です (0 の場合は展開しない)。
+func (f *inputFlags) register(fs *flag.FlagSet, defaultUnroll int) {
+	fs.StringVar(&f.input, "i", "", "入力アセンブリファイル (指定しない場合、または - の場合は標準入力)")
+	fs.StringVar(&f.output, "o", "", "出力ファイル (指定しない場合は標準出力)")
+	if defaultUnroll > 0 {
+		fs.IntVar(&f.unrollCount, "n", defaultUnroll, "ループ展開回数")
+	} else {
+		fs.IntVar(&f.unrollCount, "n", 0, "実行する前のループ展開回数 (0 の場合は展開しない)")
+	}
+	fs.IntVar(&f.innerUnrollCount, "inner-n", 0, "ネストしたループの展開回数 (指定しない場合は -n と同じ)")
+	fs.BoolVar(&f.json, "json", false, "結果を JSON 形式 (report パッケージのスキーマ) で出力する")
+	fs.BoolVar(&f.quiet, "q", false, "ファイルに書き込んだことと警告を標準エラー出力に表示しない")
+}
+
+// readsStdin は、プログラムを標準入力から読み込む場合に true を返します。
+func (f *inputFlags) readsStdin() bool {
+	return f.input == "" || f.input == "-"
+}
+
+// name は、入力の名前 (ファイル名または <stdin>) を返します。
+func (f *inputFlags) name() string {
+	if f.readsStdin() {
+		return stdinName
+	}
+	return f.input
+}
+
+// validate は、オプションの値を確認します。requireUnroll が true の場合は -n が正である必要があります。
+func (f *inputFlags) validate(requireUnroll bool) error {
+	if f.unrollCount < 0 || (requireUnroll && f.unrollCount == 0) {
+		return errors.New("展開回数は正の整数である必要があります")
+	}
+	if f.innerUnrollCount < 0 {
+		return errors.New("ネストしたループの展開回数は正の整数である必要があります")
+	}
+	return nil
+}
+
+// loadProgram は、入力ファイルまたは標準入力を読み込み、-n が指定されていればループを展開します。
+// 制御フローグラフの警告は stderr に表示します。
+func (f *inputFlags) loadProgram(stderr io.Writer) (*assembler.Assembler, error) {
+	var asm *assembler.Assembler
+	var err error
+	if f.readsStdin() {
+		asm, err = f.parseStdin()
+	} else {
+		asm, err = parseProgram(f.input)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.warn(stderr, asm)
+	return expandProgram(asm, f.unrollCount, f.innerUnrollCount)
+}
+
+// warn は、asm の制御フローグラフの診断を、-q が指定されていなければ stderr に表示します。
+func (f *inputFlags) warn(stderr io.Writer, asm *assembler.Assembler) {
+	cfg, err := loop_expander.BuildControlFlowGraph(asm)
+	if err != nil {
+		// 構築に失敗した場合は、後の処理がエラーとして報告する
+		return
+	}
+	for _, warning := range cfg.Warnings {
+		f.status(stderr, "%s: %s\n", f.name(), warning)
+	}
+}
+
+// parseStdin は、標準入力のプログラムを読み込みます。
+func (f *inputFlags) parseStdin() (*assembler.Assembler, error) {
+	source, err := io.ReadAll(f.stdin)
+	if err != nil {
+		return nil, fmt.Errorf("標準入力の読み込みに失敗しました: %w", err)
+	}
+	f.source = source
+
+	asm, err := assembler.ParseAsmFile(stdinName, bytes.NewReader(source))
+	if err != nil {
+		return nil, fmt.Errorf("アセンブリコードのパースに失敗しました: %w", err)
+	}
+	return asm, nil
+}
+
+// loadPolicy は、プログラムのポリシーを読み込みます。標準入力の場合は %! の宣言だけを読みます。
+// loadProgram の後に呼び出す必要があります。
+func (f *inputFlags) loadPolicy() (*executor.PolicyFile, error) {
+	if f.readsStdin() {
+		return executor.ParsePolicyDirectives(stdinName, bytes.NewReader(f.source))
+	}
+	return executor.LoadPolicyFile(f.input)
+}
+
+// parseProgram は、path のアセンブリファイルを読み込みます。
+func parseProgram(path string) (*assembler.Assembler, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("入力ファイルのオープンに失敗しました: %w", err)
+	}
+	defer file.Close()
+
+	asm, err := assembler.ParseAsmFile(path, file)
+	if err != nil {
+		return nil, fmt.Errorf("アセンブリコードのパースに失敗しました: %w", err)
+	}
+	return asm, nil
+}
+
+// expandProgram は、asm のループを unrollCount 回展開します。unrollCount が 0 の場合は asm をそのまま返します。
+func expandProgram(asm *assembler.Assembler, unrollCount, innerUnrollCount int) (*assembler.Assembler, error) {
+	if unrollCount == 0 {
+		return asm, nil
+	}
+	expandedAsm, err := loop_expander.ExpandLoops(asm, loop_expander.ExpandOptions{
+		UnrollCount:      unrollCount,
+		InnerUnrollCount: innerUnrollCount,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ループ展開に失敗しました: %w", err)
+	}
+	return expandedAsm, nil
+}
+
+// writeJSON は、doc を JSON として -o のファイル、または標準出力に書き込みます。
+func (f *inputFlags) writeJSON(stdout, stderr io.Writer, doc report.Document, what string) error {
+	doc.Source = f.name()
+	var out bytes.Buffer
+	if err := report.Write(&out, doc); err != nil {
+		return fmt.Errorf("JSON の生成に失敗しました: %w", err)
+	}
+	return f.writeOutput(stdout, stderr, out.String(), what)
+}
+
+// writeOutput は、output を -o のファイル、または標準出力に書き込みます。
+// ファイルに書き込んだ場合は、-q が指定されていなければ what を書き込んだことを標準エラー出力に表示します
+// (標準出力をパイプにつないだ場合に出力と混ざらないようにするため)。
+func (f *inputFlags) writeOutput(stdout, stderr io.Writer, output string, what string) error {
+	if f.output == "" {
+		_, err := io.WriteString(stdout, output)
+		return err
+	}
+	if err := os.WriteFile(f.output, []byte(output), 0644); err != nil {
+		return fmt.Errorf("出力ファイルへの書き込みに失敗しました: %w", err)
+	}
+	f.status(stderr, "%sを %s に書き込みました\n", what, f.output)
+	return nil
+}
+
+// status は、-q が指定されていなければ状況のメッセージを stderr に表示します。
+func (f *inputFlags) status(stderr io.Writer, format string, args ...interface{}) {
+	if !f.quiet {
+		fmt.Fprintf(stderr, format, args...)
+	}
+}
+
+// execFlags は、exec、spec、check で共通の実行のオプション
+type execFlags struct {
+	policy   string
+	memory   string
+	maxSteps int
+}
+
+const (
+	defaultMaxSteps     = 1000   // exec の各パスの最大ステップ数
+	defaultSpecMaxSteps = 100000 // spec と check のすべてのパスを合わせた最大ステップ数
+)
+
+func (f *execFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.policy, "policy", "", "ポリシーファイル (入力ファイルの %! の宣言と .policy ファイルに追加されます)")
+	fs.StringVar(&f.memory, "memory", "", "初期化されていないメモリの扱い: strict, symbolic, zero (指定しない場合はポリシーの指定、なければ symbolic)")
+	fs.IntVar(&f.maxSteps, "max-steps", 0, fmt.Sprintf(
+		"最大ステップ数: exec では各パスのステップ数で、超えたパスは結果に含めません。spec と check ではすべてのパスを合わせたステップ数で、超えた場合はエラーになります (0 の場合は exec で %d、spec と check で %d)",
+		defaultMaxSteps, defaultSpecMaxSteps))
+}
+
+// steps は、-max-steps の値を返します。指定されていない場合は、speculative (spec と check) かどうかに応じた既定値を返します。
+func (f *execFlags) steps(speculative bool) int {
+	switch {
+	case f.maxSteps > 0:
+		return f.maxSteps
+	case speculative:
+		return defaultSpecMaxSteps
+	default:
+		return defaultMaxSteps
+	}
+}
+
+// loadPolicy は、入力のポリシーを読み込み、-policy と -memory の指定を追加します。
+func (f *execFlags) loadPolicy(in *inputFlags) (*executor.PolicyFile, error) {
+	policy, err := in.loadPolicy()
+	if err != nil {
+		return nil, fmt.Errorf("ポリシーの読み込みに失敗しました: %w", err)
+	}
+	return f.extendPolicy(policy)
+}
+
+// extendPolicy は、policy に -policy のファイルの宣言と -memory の指定を追加します。
+func (f *execFlags) extendPolicy(policy *executor.PolicyFile) (*executor.PolicyFile, error) {
+	if f.policy != "" {
+		if err := policy.LoadFile(f.policy); err != nil {
+			return nil, fmt.Errorf("ポリシーの読み込みに失敗しました: %w", err)
+		}
+	}
+	if f.memory != "" {
+		memoryPolicy, err := executor.ParseMemoryPolicy(f.memory)
+		if err != nil {
+			return nil, err
+		}
+		policy.MemoryPolicy = memoryPolicy
+	}
+	if policy.MemoryPolicy == "" {
+		policy.MemoryPolicy = executor.MemorySymbolic
+	}
+	return policy, nil
+}
+
+// specFlags は、spec と check で共通の投機実行のオプション
+type specFlags struct {
+	window            int
+	windowMode        string
+	windowCosts       string
+	semantics         string
+	storeBuffer       int
+	maxMispredictions int
+}
+
+func (f *specFlags) register(fs *flag.FlagSet) {
+	fs.IntVar(&f.window, "window", 20, "投機ウィンドウの大きさ")
+	fs.StringVar(&f.windowMode, "window-mode", string(executor.WindowNested), "入れ子の投機のウィンドウ: nested, global")
+	fs.StringVar(&f.windowCosts, "window-costs", "", "命令ごとのウィンドウのコスト (例: load=4,store=2)")
+	fs.StringVar(&f.semantics, "semantics", string(executor.SemanticsBranch), "投機のセマンティクス: branch, store-bypass, all")
+	fs.IntVar(&f.storeBuffer, "store-buffer", executor.DefaultStoreBufferSize, "ストアバイパスでバイパスできるストアの数")
+	fs.IntVar(&f.maxMispredictions, "k", 0, "各パスで誤予測する分岐の最大数 (0 の場合は制限しない)")
+}
+
+// options は、オプションを SpecOptions に変換します。
+func (f *specFlags) options() (executor.SpecOptions, error) {
+	if f.window < 0 || f.storeBuffer < 0 || f.maxMispredictions < 0 {
+		return executor.SpecOptions{}, errors.New("-window、-store-buffer、-k は 0 以上である必要があります")
+	}
+	mode, err := executor.ParseWindowMode(f.windowMode)
+	if err != nil {
+		return executor.SpecOptions{}, err
+	}
+	costs, err := executor.ParseWindowCosts(f.windowCosts)
+	if err != nil {
+		return executor.SpecOptions{}, err
+	}
+	semantics, err := executor.ParseSpecSemantics(f.semantics)
+	if err != nil {
+		return executor.SpecOptions{}, err
+	}
+	return executor.SpecOptions{
+		Window:            executor.WindowModel{Size: f.window, Mode: mode, Costs: costs},
+		Semantics:         semantics,
+		StoreBufferSize:   f.storeBuffer,
+		MaxMispredictions: f.maxMispredictions,
+	}, nil
+}
+
+// newFlagSet は、エラーを stderr に出力する FlagSet を作ります。
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// parseFlags は、args を解析します。続行できない場合は終了コードと false を返します。
+func parseFlags(fs *flag.FlagSet, args []string, stderr io.Writer) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, false
+		}
+		return exitUsage, false
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "不明な引数です: %v\n", fs.Args())
+		return exitUsage, false
+	}
+	return 0, true
+}
+
+// fail は、err を stderr に出力して code を返します。
+func fail(stderr io.Writer, code int, err error) int {
+	fmt.Fprintln(stderr, err)
+	return code
+}
+
+func runExpand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	in := inputFlags{stdin: stdin}
+	fs := newFlagSet("expand", stderr)
+	in.register(fs, 2)
+	if code, ok := parseFlags(fs, args, stderr); !ok {
+		return code
+	}
+	if err := in.validate(true); err != nil {
+		return fail(stderr, exitUsage, err)
+	}
+
+	expandedAsm, err := in.loadProgram(stderr)
+	if err != nil {
+		return fail(stderr, exitError, err)
+	}
+	if in.json {
+		doc := report.Document{Kind: report.KindProgram, Program: report.NewProgram(expandedAsm)}
+		if err := in.writeJSON(stdout, stderr, doc, "ループ展開されたアセンブリコード"); err != nil {
+			return fail(stderr, exitError, err)
+		}
+		return exitOK
+	}
+	// GenerateAsm を使用してアセンブリコードを文字列に変換
+	output, err := assembler.GenerateAsm(expandedAsm)
+	if err != nil {
+		return fail(stderr, exitError, fmt.Errorf("アセンブリコードの生成に失敗しました: %w", err))
+	}
+	if in.output == "" {
+		output += "\n"
+	}
+	if err := in.writeOutput(stdout, stderr, output, "ループ展開されたアセンブリコード"); err != nil {
+		return fail(stderr, exitError, err)
+	}
+	return exitOK
+}
+
+func runCFG(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	in := inputFlags{stdin: stdin}
+	var dot bool
+	fs := newFlagSet("cfg", stderr)
+	in.register(fs, 0)
+	fs.BoolVar(&dot, "dot", false, "DOT 形式で出力する")
+	if code, ok := parseFlags(fs, args, stderr); !ok {
+		return code
+	}
+	if err := in.validate(false); err != nil {
+		return fail(stderr, exitUsage, err)
+	}
+	if dot && in.json {
+		return fail(stderr, exitUsage, errors.New("-dot と -json は同時に指定できません"))
+	}
+
+	asm, err := in.loadProgram(stderr)
+	if err != nil {
+		return fail(stderr, exitError, err)
+	}
+	cfg, err := loop_expander.BuildControlFlowGraph(asm)
+	if err != nil {
+		return fail(stderr, exitError, fmt.Errorf("制御フローグラフの構築に失敗しました: %w", err))
+	}
+	if in.json {
+		doc := report.Document{Kind: report.KindCFG, Program: report.NewProgram(asm), CFG: report.NewCFG(cfg)}
+		if err := in.writeJSON(stdout, stderr, doc, "制御フローグラフ"); err != nil {
+			return fail(stderr, exitError, err)
+		}
+		return exitOK
+	}
+
+	var out bytes.Buffer
+	if dot {
+		out.WriteString(loop_expander.ToDOT(cfg))
+	} else {
+		loop_expander.FprintCFG(&out, cfg, asm)
+		loops := loop_expander.DetectLoops(cfg)
+		if len(loops) == 0 {
+			out.WriteString("Loops: (none)\n")
+		} else {
+			out.WriteString("Loops:\n")
+			for _, loop := range loops {
+				fmt.Fprintf(&out, "  Header: %d, Latch: %d, Blocks: %v\n", loop.Header, loop.Latch, loop.Blocks)
+			}
+		}
+	}
+	if err := in.writeOutput(stdout, stderr, out.String(), "制御フローグラフ"); err != nil {
+		return fail(stderr, exitError, err)
+	}
+	return exitOK
+}
+
+func runExec(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	in := inputFlags{stdin: stdin}
+	var ex execFlags
+	fs := newFlagSet("exec", stderr)
+	in.register(fs, 0)
+	ex.register(fs)
+	if code, ok := parseFlags(fs, args, stderr); !ok {
+		return code
+	}
+	if err := in.validate(false); err != nil {
+		return fail(stderr, exitUsage, err)
+	}
+
+	asm, err := in.loadProgram(stderr)
+	if err != nil {
+		return fail(stderr, exitError, err)
+	}
+	policy, err := ex.loadPolicy(&in)
+	if err != nil {
+		return fail(stderr, exitError, err)
+	}
+	finalConfigs, err := executor.RunAssembler(asm, policy.Configuration(), ex.steps(false))
+	if err != nil {
+		return fail(stderr, exitError, fmt.Errorf("実行に失敗しました: %w", err))
+	}
+	if err := in.writeConfigurations(stdout, stderr, finalConfigs); err != nil {
+		return fail(stderr, exitError, err)
+	}
+	return exitOK
+}
+
+func runSpec(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	in := inputFlags{stdin: stdin}
+	var ex execFlags
+	var sp specFlags
+	fs := newFlagSet("spec", stderr)
+	in.register(fs, 0)
+	ex.register(fs)
+	sp.register(fs)
+	if code, ok := parseFlags(fs, args, stderr); !ok {
+		return code
+	}
+	if err := in.validate(false); err != nil {
+		return fail(stderr, exitUsage, err)
+	}
+	opts, err := sp.options()
+	if err != nil {
+		return fail(stderr, exitUsage, err)
+	}
+
+	asm, err := in.loadProgram(stderr)
+	if err != nil {
+		return fail(stderr, exitError, err)
+	}
+	policy, err := ex.loadPolicy(&in)
+	if err != nil {
+		return fail(stderr, exitError, err)
+	}
+	finalConfigs, err := executor.SpecRunAssemblerWithOptions(asm, policy.Configuration(), ex.steps(true), opts)
+	if err != nil {
+		return fail(stderr, exitError, fmt.Errorf("投機実行に失敗しました: %w", err))
+	}
+	if err := in.writeConfigurations(stdout, stderr, finalConfigs); err != nil {
+		return fail(stderr, exitError, err)
+	}
+	return exitOK
+}
+
+func runCheck(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	in := inputFlags{stdin: stdin}
+	var ex execFlags
+	var sp specFlags
+	var cexPrefix string
+	fs := newFlagSet("check", stderr)
+	in.register(fs, 0)
+	ex.register(fs)
+	sp.register(fs)
+	fs.StringVar(&cexPrefix, "cex", "", "リークが見つかった場合に反例を書き出すファイル名の接頭辞 (prefix.muasm, prefix.run1.policy, prefix.run2.policy)")
+	if code, ok := parseFlags(fs, args, stderr); !ok {
+		return code
+	}
+	if err := in.validate(false); err != nil {
+		return fail(stderr, exitUsage, err)
+	}
+	opts, err := sp.options()
+	if err != nil {
+		return fail(stderr, exitUsage, err)
+	}
+
+	asm, err := in.loadProgram(stderr)
+	if err != nil {
+		return fail(stderr, exitError, err)
+	}
+	policy, err := ex.loadPolicy(&in)
+	if err != nil {
+		return fail(stderr, exitError, err)
+	}
+	result, err := executor.CheckSNIWithOptions(asm, policy.Policy, policy.Configuration(), ex.steps(true), opts)
+	if err != nil {
+		return fail(stderr, exitError, fmt.Errorf("検査に失敗しました: %w", err))
+	}
+
+	if in.json {
+		doc := report.Document{
+			Kind:  report.KindCheck,
+			Paths: report.NewConfigurations(result.Configs),
+			Check: report.NewCheck(result, result.Configs),
+		}
+		err = in.writeJSON(stdout, stderr, doc, "検査結果")
+	} else {
+		err = in.writeOutput(stdout, stderr, formatCheck(result), "検査結果")
+	}
+	if err != nil {
+		return fail(stderr, exitError, err)
+	}
+	if result.Secure {
+		return exitOK
+	}
+	if len(result.Leaks) == 0 {
+		return exitUndecided
+	}
+
+	if cexPrefix != "" {
+		cex, err := executor.LeakCounterexample(result.Leaks[0], policy.Policy)
+		if err != nil {
+			fmt.Fprintf(stderr, "反例の生成に失敗しました: %v\n", err)
+			return exitLeak
+		}
+		paths, err := executor.WriteCounterexample(asm, cex, policy, cexPrefix)
+		if err != nil {
+			return fail(stderr, exitError, fmt.Errorf("反例の書き込みに失敗しました: %w", err))
+		}
+		for _, path := range paths {
+			in.status(stderr, "反例を %s に書き込みました\n", path)
+		}
+	}
+	return exitLeak
+}
+
+// formatCheck は、検査結果を文字列にします。
+func formatCheck(result *executor.SNIResult) string {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "Paths: %d\n", result.Paths)
+	switch {
+	case result.Secure:
+		out.WriteString("Result: secure\n")
+		return out.String()
+	case len(result.Leaks) == 0:
+		fmt.Fprintf(&out, "Result: inconclusive (%d undecided paths)\n", len(result.Inconclusive))
+	default:
+		fmt.Fprintf(&out, "Result: insecure (%d leaking paths)\n", len(result.Leaks))
+	}
+	if len(result.Inconclusive) > 0 {
+		// ソルバーが判定できなかったパスは、リークの有無が分からない
+		fmt.Fprintf(&out, "Undecided paths: %d (the solver could not decide whether they leak)\n", len(result.Inconclusive))
+	}
+	for i, leak := range result.Leaks {
+		fmt.Fprintf(&out, "Leak %d: %s at PC %d depends on %v\n", i+1, leak.Observation.Type, leak.Observation.PC, leak.Secrets)
+		if leak.Observation.Address != nil {
+			fmt.Fprintf(&out, "  Address: %s\n", executor.FormatValue(leak.Observation.Address))
+		}
+		if leak.Observation.Value != nil {
+			fmt.Fprintf(&out, "  Value: %s\n", executor.FormatValue(leak.Observation.Value))
+		}
+	}
+	return out.String()
+}
+
+// writeConfigurations は、実行したすべてのパスの最終状態をテキストまたは JSON で出力します。
+func (f *inputFlags) writeConfigurations(stdout, stderr io.Writer, finalConfigs []*executor.Configuration) error {
+	if f.json {
+		doc := report.Document{Kind: report.KindConfigurations, Paths: report.NewConfigurations(finalConfigs)}
+		return f.writeJSON(stdout, stderr, doc, "実行結果")
+	}
+	return f.writeOutput(stdout, stderr, formatConfigurations(finalConfigs), "実行結果")
+}
+
+// formatConfigurations は、実行したすべてのパスの最終状態を文字列にします。
+func formatConfigurations(finalConfigs []*executor.Configuration) string {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "Paths: %d\n", len(finalConfigs))
+	for i, conf := range finalConfigs {
+		fmt.Fprintf(&out, "=== Path %d ===\n", i+1)
+		executor.FprintConfiguration(&out, *conf)
+	}
+	return out.String()
+}
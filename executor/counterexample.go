@@ -0,0 +1,203 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/taisii/go-project/assembler"
+)
+
+// Counterexample は、公開入力が一致するのに投機的な観測が異なる二つの具体的な初期状態を表す構造体
+type Counterexample struct {
+	Policy Policy   // 公開入力
+	Inputs [2]Model // 各実行の入力のシンボルの値 (公開入力の値は両方で同じ)
+	// Observations は、最初に異なる投機的な観測です。
+	// Index は SplitTrace が返す投機的な観測の中での位置です。
+	Observations [2]Observation
+	Index        int
+
+	cells map[string]interface{} // シンボリックなアドレスのメモリのシンボル名からアドレスの式への対応
+}
+
+// FindCounterexample は、a と b の実行パスのトレースから反例を探します。
+// AnalyzeTraces と同じ自己合成の条件 (newSelfComposition) を満たす入力をソルバーで探します。
+// 観測はロードとストアのアドレスと分岐の方向を比較し、ロードした値は比較しません。
+// 一つのパスの中で秘密が分岐の方向だけに影響する場合は、a と b に異なるパスを指定する必要があります
+// (LeakCounterexample はリークの Other を b とします)。
+func FindCounterexample(a, b *Configuration, policy Policy) (*Counterexample, error) {
+	query, err := newSelfComposition(a, b, policy)
+	if err != nil {
+		return nil, err
+	}
+	renamed := query.b
+
+	result, model := Solve(query.constraints...)
+	switch result {
+	case Unsat:
+		return nil, fmt.Errorf("no counterexample: speculative observations are equal for all inputs agreeing on public inputs")
+	case Unknown:
+		return nil, fmt.Errorf("no counterexample found within the solver limits")
+	}
+	if _, ok := query.differingObservation(model); !ok {
+		return nil, fmt.Errorf("no counterexample: no speculative observation differs under the solver's model")
+	}
+
+	// 制約に現れなかった入力は 0 とする
+	names := make(map[string]bool)
+	collectInputSymbols(a, names)
+	collectInputSymbols(renamed, names)
+	inputs := [2]Model{make(Model), make(Model)}
+	for name := range names {
+		value := model[name]
+		switch {
+		case policy.IsPublic(name):
+			inputs[0][name] = value
+			inputs[1][name] = value
+		case strings.HasSuffix(name, secondRunSuffix):
+			inputs[1][strings.TrimSuffix(name, secondRunSuffix)] = value
+		default:
+			inputs[0][name] = value
+		}
+	}
+	for name := range inputs[0] {
+		if _, ok := inputs[1][name]; !ok && !policy.IsPublic(name) {
+			inputs[1][name] = 0
+		}
+	}
+	for name := range inputs[1] {
+		if _, ok := inputs[0][name]; !ok {
+			inputs[0][name] = 0
+		}
+	}
+
+	cex := &Counterexample{Policy: policy, Inputs: inputs, cells: make(map[string]interface{})}
+	collectMemoryCells(a, cex.cells)
+	collectMemoryCells(b, cex.cells)
+	cex.Index = query.firstDifference(model)
+	cex.Observations = [2]Observation{query.difference(cex.Index, 0), query.difference(cex.Index, 1)}
+	return cex, nil
+}
+
+// LeakCounterexample は、AnalyzeTraces が報告したリークを再現する反例を、リークの Config と Other の組から求めます。
+func LeakCounterexample(leak Leak, policy Policy) (*Counterexample, error) {
+	cex, err := FindCounterexample(leak.Config, leak.Other, policy)
+	if err != nil {
+		return nil, fmt.Errorf("no counterexample found for the leak at pc %d: %w", leak.Observation.PC, err)
+	}
+	return cex, nil
+}
+
+// InitialState は、run 番目 (0 または 1) の実行の初期状態をポリシーファイルとして返します。
+// base (nil でもよい) の宣言に加えてすべての入力を具体値で初期化し、それ以外のメモリは 0 として扱います。
+func (c *Counterexample) InitialState(run int, base *PolicyFile) *PolicyFile {
+	policy := NewPolicyFile()
+	if base != nil {
+		policy.SecretRegisters = append(policy.SecretRegisters, base.SecretRegisters...)
+		policy.SecretMemory = append([]AddressRange(nil), base.SecretMemory...)
+		for name, value := range base.Registers {
+			policy.Registers[name] = value
+		}
+		for addr, value := range base.Memory {
+			policy.Memory[addr] = value
+		}
+	}
+	policy.Policy = Policy{
+		PublicRegisters: append([]string(nil), c.Policy.PublicRegisters...),
+		PublicMemory:    append([]AddressRange(nil), c.Policy.PublicMemory...),
+	}
+	policy.MemoryPolicy = MemoryZero
+
+	inputs := c.Inputs[run]
+	names := make([]string, 0, len(inputs))
+	for name := range inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// シンボリックなアドレスのセルは、具体的なアドレスのセルより優先度が低い
+	var deferred []string
+	for _, name := range names {
+		if !strings.HasPrefix(name, "mem[") {
+			policy.Registers[name] = inputs[name]
+			continue
+		}
+		if addr, ok := memorySymbolAddress(name); ok {
+			policy.Memory[addr] = inputs[name]
+			continue
+		}
+		deferred = append(deferred, name)
+	}
+	for _, name := range deferred {
+		address, ok := c.cells[name]
+		if !ok {
+			continue
+		}
+		addr, ok := evalModel(address, inputs)
+		if !ok {
+			continue
+		}
+		if _, exists := policy.Memory[addr]; !exists {
+			policy.Memory[addr] = inputs[name]
+		}
+	}
+	return policy
+}
+
+// WriteCounterexample は、反例をファイルに書き出します。
+// prefix.muasm にプログラムを、prefix.run1.policy と prefix.run2.policy に二つの実行の初期状態
+// (InitialState(run, base)) を書き込み、書き込んだファイルのパスを返します。
+func WriteCounterexample(asm *assembler.Assembler, c *Counterexample, base *PolicyFile, prefix string) ([]string, error) {
+	program, err := assembler.GenerateAsm(asm)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{prefix + ".muasm"}
+	if err := os.WriteFile(paths[0], []byte(program), 0644); err != nil {
+		return nil, err
+	}
+	for run := 0; run < 2; run++ {
+		path := fmt.Sprintf("%s.run%d%s", prefix, run+1, PolicyExtension)
+		obs := c.Observations[run]
+		header := fmt.Sprintf("%% counterexample run %d: speculative observation %d (%s at pc %d) differs\n", run+1, c.Index, obs.Type, obs.PC)
+		if err := os.WriteFile(path, []byte(header+c.InitialState(run, base).String()), 0644); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// collectMemoryCells は、シンボリックなアドレスからのロードで作られたシンボル名とアドレスの式を cells に追加します。
+func collectMemoryCells(conf *Configuration, cells map[string]interface{}) {
+	for _, obs := range conf.Trace.Observations {
+		if obs.Type != ObsTypeLoad || obs.Address == nil {
+			continue
+		}
+		if _, concrete := obs.Address.(int); concrete {
+			continue
+		}
+		name := fmt.Sprintf("mem[%s]", formatValue(obs.Address))
+		names := make(map[string]bool)
+		collectSymbols(obs.Value, names)
+		if names[name] {
+			cells[name] = obs.Address
+		}
+	}
+}
+
+// collectInputSymbols は、conf のトレースと状態に現れる入力のシンボル名を names に追加します。
+func collectInputSymbols(conf *Configuration, names map[string]bool) {
+	collectSymbols(conf.Trace.PathCond, names)
+	for _, obs := range conf.Trace.Observations {
+		collectSymbols(obs.Address, names)
+		collectSymbols(obs.Value, names)
+	}
+	for _, value := range conf.Registers {
+		collectSymbols(value, names)
+	}
+	for _, value := range conf.Memory {
+		collectSymbols(value, names)
+	}
+}
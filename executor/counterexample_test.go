@@ -0,0 +1,232 @@
+package executor_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/taisii/go-project/assembler"
+	"github.com/taisii/go-project/executor"
+)
+
+// runPolicyFile は、反例として書き出した path の初期状態で asm を投機実行し、最終状態を一つ返します。
+func runPolicyFile(t *testing.T, asm *assembler.Assembler, path string) *executor.Configuration {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := executor.ParsePolicy(path, strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", path, err)
+	}
+	finalConfigs, err := executor.SpecRunAssembler(asm, state.Configuration(), 100, 10)
+	if err != nil {
+		t.Fatalf("failed to run %s: %v", path, err)
+	}
+	if len(finalConfigs) != 1 {
+		t.Fatalf("expected a single concrete path for %s, got %d", path, len(finalConfigs))
+	}
+	return finalConfigs[0]
+}
+
+// sameObservations は、攻撃者が観測できる部分 (ロードとストアのアドレス、分岐の方向) が等しいかを返します。
+func sameObservations(a, b []executor.Observation) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].PC != b[i].PC || a[i].Type != b[i].Type {
+			return false
+		}
+		switch a[i].Type {
+		case executor.ObsTypeLoad, executor.ObsTypeStore:
+			if !reflect.DeepEqual(a[i].Address, b[i].Address) {
+				return false
+			}
+		case executor.ObsTypePC:
+			// 具体的な実行なので式をそのまま比較する (方向の演算子も比べる)
+			if !reflect.DeepEqual(a[i].Value, b[i].Value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestLeakCounterexample(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Source string
+		Policy string // ポリシーファイル
+	}{
+		{
+			Name:   "Spectre v1 gadget",
+			Source: "x <- idx < size\nbeqz x, End\nload v, a1 + idx\nload w, a2 + v\nEnd:\n",
+			Policy: "public idx, size\ninit a1 = 100\ninit a2 = 200\n",
+		},
+		{
+			Name:   "Secret register branch under misprediction",
+			Source: "beqz c, End\nbeqz k, End\nEnd:\n",
+			Policy: "public c\n",
+		},
+		{
+			Name:   "Secret memory loaded under misprediction",
+			Source: "beqz c, End\nload s, 5\nbeqz s, End\nEnd:\n",
+			Policy: "public c\n",
+		},
+		{
+			Name:   "Secret memory at a symbolic address",
+			Source: "beqz c, End\nload s, i\nload t, s + 64\nEnd:\n",
+			Policy: "public c, i\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			asm, err := assembler.ParseAsm(strings.NewReader(testCase.Source))
+			if err != nil {
+				t.Fatalf("failed to parse program: %v", err)
+			}
+			policy, err := executor.ParsePolicy("", strings.NewReader(testCase.Policy))
+			if err != nil {
+				t.Fatalf("failed to parse policy: %v", err)
+			}
+			result, err := executor.CheckSNI(asm, policy.Policy, policy.Configuration(), 100, 10)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Secure {
+				t.Fatalf("expected a leak")
+			}
+
+			cex, err := executor.LeakCounterexample(result.Leaks[0], policy.Policy)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for name, value := range cex.Inputs[0] {
+				if policy.Policy.IsPublic(name) && cex.Inputs[1][name] != value {
+					t.Errorf("public input %s differs: %d and %d", name, value, cex.Inputs[1][name])
+				}
+			}
+
+			for name, value := range cex.Inputs[0] {
+				if _, ok := cex.Inputs[1][name]; !ok {
+					t.Errorf("input %s (%d) is missing in run 2", name, value)
+				}
+			}
+
+			// 書き出した初期状態で実行し直すと、非投機的な観測は一致し投機的な観測は異なる
+			paths, err := executor.WriteCounterexample(asm, cex, policy, filepath.Join(t.TempDir(), "leak"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			runs := []*executor.Configuration{runPolicyFile(t, asm, paths[1]), runPolicyFile(t, asm, paths[2])}
+			nonSpec1, spec1 := executor.SplitTrace(runs[0].Trace)
+			nonSpec2, spec2 := executor.SplitTrace(runs[1].Trace)
+			if !sameObservations(nonSpec1, nonSpec2) {
+				t.Errorf("non-speculative observations differ:\n%s", executor.FormatTraceDifferences(runs[0].Trace, runs[1].Trace))
+			}
+			if sameObservations(spec1, spec2) {
+				t.Errorf("speculative observations are equal: %+v", spec1)
+			}
+		})
+	}
+}
+
+func TestFindCounterexampleSecure(t *testing.T) {
+	asm, err := assembler.ParseAsm(strings.NewReader("beqz c, End\nspbarr\nload s, 5\nbeqz s, End\nEnd:\n"))
+	if err != nil {
+		t.Fatalf("failed to parse program: %v", err)
+	}
+	policy := executor.Policy{PublicRegisters: []string{"c"}}
+	finalConfigs, err := executor.SpecRunAssembler(asm, &executor.Configuration{MemoryPolicy: executor.MemorySymbolic}, 100, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, conf := range finalConfigs {
+		if _, err := executor.FindCounterexample(conf, conf, policy); err == nil {
+			t.Errorf("expected no counterexample for %+v", conf.Trace.Observations)
+		}
+	}
+}
+
+func TestFindCounterexampleDivergingPaths(t *testing.T) {
+	// 非投機的な観測の数が異なるパスは投機なしで区別できる
+	asm, err := assembler.ParseAsm(strings.NewReader("beqz c, End\nload s, 5\nEnd:\n"))
+	if err != nil {
+		t.Fatalf("failed to parse program: %v", err)
+	}
+	finalConfigs, err := executor.SpecRunAssembler(asm, &executor.Configuration{MemoryPolicy: executor.MemorySymbolic}, 100, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(finalConfigs) != 2 {
+		t.Fatalf("expected 2 paths, got %d", len(finalConfigs))
+	}
+	_, err = executor.FindCounterexample(finalConfigs[0], finalConfigs[1], executor.Policy{})
+	if err == nil || !strings.Contains(err.Error(), "paths differ without speculation") {
+		t.Errorf("expected paths to differ without speculation, got %v", err)
+	}
+}
+
+func TestWriteCounterexample(t *testing.T) {
+	source := "beqz c, End\nload s, 5\nbeqz s, End\nEnd:\n"
+	asm, err := assembler.ParseAsm(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("failed to parse program: %v", err)
+	}
+	policy := executor.Policy{PublicRegisters: []string{"c"}}
+	result, err := executor.CheckSNI(asm, policy, nil, 100, 10)
+	if err != nil || result.Secure {
+		t.Fatalf("expected a leak, got %v", err)
+	}
+	cex, err := executor.LeakCounterexample(result.Leaks[0], policy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	prefix := filepath.Join(t.TempDir(), "leak")
+	paths, err := executor.WriteCounterexample(asm, cex, nil, prefix)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{prefix + ".muasm", prefix + ".run1.policy", prefix + ".run2.policy"}
+	if strings.Join(paths, " ") != strings.Join(expected, " ") {
+		t.Fatalf("expected %v, got %v", expected, paths)
+	}
+
+	file, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	written, err := assembler.ParseAsmFile(paths[0], file)
+	if err != nil {
+		t.Fatalf("failed to parse the written program: %v", err)
+	}
+
+	var memories []interface{}
+	for _, path := range paths[1:] {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state, err := executor.ParsePolicy(path, strings.NewReader(string(data)))
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", path, err)
+		}
+		if state.MemoryPolicy != executor.MemoryZero {
+			t.Errorf("expected memory zero in %s, got %q", path, state.MemoryPolicy)
+		}
+		if _, err := executor.SpecRunAssembler(written, state.Configuration(), 100, 10); err != nil {
+			t.Errorf("failed to run %s: %v", path, err)
+		}
+		memories = append(memories, state.Memory[5])
+	}
+	if memories[0] == memories[1] {
+		t.Errorf("expected the secret mem[5] to differ, got %v in both runs", memories[0])
+	}
+}
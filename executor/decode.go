@@ -0,0 +1,95 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/taisii/go-project/assembler"
+)
+
+// DecodeInstruction decodes op into the typed statement executed by step and passed to a SpeculationModel.
+// Label jump targets are evaluated as registers, since op carries no label table.
+func DecodeInstruction(op assembler.OpCode) (assembler.Stmt, error) {
+	stmt, err := assembler.Decode(op)
+	if err != nil {
+		return nil, fmt.Errorf("invalid instruction %s: %w", op, err)
+	}
+	return resolveLabels(stmt, nil)
+}
+
+// decodeProgram decodes a whole program once so that operands are not re-parsed at every step.
+func decodeProgram(program []assembler.OpCode) ([]assembler.Stmt, error) {
+	decoded := make([]assembler.Stmt, len(program))
+	for i, op := range program {
+		stmt, err := DecodeInstruction(op)
+		if err != nil {
+			return nil, fmt.Errorf("instruction %d: %w", i, err)
+		}
+		decoded[i] = stmt
+	}
+	return decoded, nil
+}
+
+// decodeAssembler replaces the label jump targets of an assembled program with their addresses.
+// Instruction addresses must be contiguous from 0 so that the PC can index the program directly.
+func decodeAssembler(asm *assembler.Assembler) ([]assembler.Stmt, error) {
+	decoded := make([]assembler.Stmt, len(asm.Program))
+	for i, inst := range asm.Program {
+		if inst.Addr != i {
+			return nil, fmt.Errorf("instruction %d has address %d; addresses must be contiguous from 0", i, inst.Addr)
+		}
+		stmt, err := resolveLabels(inst.Stmt, asm.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("instruction %d: %w", i, err)
+		}
+		decoded[i] = stmt
+	}
+	return decoded, nil
+}
+
+// resolveLabels replaces a label jump target of stmt with its address in labels.
+// A beqz target must be a defined label when labels is given; an undefined jmp target is evaluated as a register (jmp x).
+func resolveLabels(stmt assembler.Stmt, labels map[string]int) (assembler.Stmt, error) {
+	switch s := stmt.(type) {
+	case assembler.Jmp:
+		if label, ok := s.Target.(assembler.LabelRef); ok {
+			s.Target = labelAddress(label, labels)
+		}
+		return s, nil
+	case assembler.Beqz:
+		if label, ok := s.Target.(assembler.LabelRef); ok {
+			if _, defined := labels[label.Name]; labels != nil && !defined {
+				return nil, fmt.Errorf("undefined label %q", label.Name)
+			}
+			s.Target = labelAddress(label, labels)
+		}
+		return s, nil
+	case nil:
+		return nil, fmt.Errorf("instruction has no statement")
+	}
+	return stmt, nil
+}
+
+// labelAddress returns the address of label as an immediate, or the label as a register if it is not in labels.
+func labelAddress(label assembler.LabelRef, labels map[string]int) assembler.Expr {
+	if addr, ok := labels[label.Name]; ok {
+		return assembler.Immediate{Value: addr}
+	}
+	return assembler.Register{Name: label.Name}
+}
+
+// unaryOp returns the SymbolicExpr operator of an assembler unary operator ("-" becomes "neg").
+func unaryOp(op string) string {
+	if op == "-" {
+		return "neg"
+	}
+	return op
+}
+
+// jumpAddress converts an evaluated jump target into a program address.
+func jumpAddress(target interface{}) (int, error) {
+	address, ok := target.(int)
+	if !ok {
+		return 0, fmt.Errorf("jump target must be a concrete address, got %s", formatValue(target))
+	}
+	return address, nil
+}
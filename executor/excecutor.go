@@ -5,6 +5,27 @@ import (
 )
 
 func ExecuteProgram(program []assembler.OpCode, configuration *Configuration, maxSteps int) ([]*Configuration, error) {
+	// オペランドは実行前に一度だけ解析する
+	decoded, err := decodeProgram(program)
+	if err != nil {
+		return nil, err
+	}
+	return executeDecoded(decoded, configuration, maxSteps)
+}
+
+// RunAssembler は、ラベルをアドレスに解決してから asm を ExecuteProgram と同様に実行します。
+// ループ展開で追加される programEnd のようにプログラム末尾を指すラベルは実行終了になります。
+func RunAssembler(asm *assembler.Assembler, configuration *Configuration, maxSteps int) ([]*Configuration, error) {
+	decoded, err := decodeAssembler(asm)
+	if err != nil {
+		return nil, err
+	}
+	return executeDecoded(decoded, configuration, maxSteps)
+}
+
+// executeDecoded は、解析済みのプログラムを幅優先で実行します。
+// maxSteps は各パスのステップ数の上限で、上限に達したパスは結果に含めません。
+func executeDecoded(decoded []assembler.Stmt, configuration *Configuration, maxSteps int) ([]*Configuration, error) {
 	// キューに初期状態を追加（各パスごとに個別のステップカウントを保持）
 	queue := []*Configuration{configuration}
 	completedConfigs := []*Configuration{} // 完了したすべての状態を収集
@@ -20,22 +41,26 @@ func ExecuteProgram(program []assembler.OpCode, configuration *Configuration, ma
 		}
 
 		// プログラム終了時に最終状態を収集
-		if current.PC >= len(program) {
+		if current.PC >= len(decoded) {
 			completedConfigs = append(completedConfigs, current)
 			continue
 		}
 
 		// 現在の命令を取得
-		inst := program[current.PC]
+		inst := decoded[current.PC]
 
 		// 命令を実行し、新しい状態を取得
-		newConfigs, err := Step(inst, current)
+		newConfigs, err := step(inst, current)
 		if err != nil {
 			return nil, err
 		}
 
 		// 新しい状態に対してステップカウントをインクリメントし、キューに追加
+		// シンボリックな分岐で分かれた場合は、パス条件が充足不能な状態を取り除く
 		for _, newConfig := range newConfigs {
+			if len(newConfigs) > 1 && !isFeasible(newConfig.Trace.PathCond) {
+				continue
+			}
 			newConfig.StepCount = current.StepCount + 1 // 現在のステップ数を引き継ぎ＋1
 			queue = append(queue, newConfig)
 		}
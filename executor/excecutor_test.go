@@ -1,10 +1,12 @@
 package executor_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/taisii/go-project/assembler"
 	"github.com/taisii/go-project/executor"
+	"github.com/taisii/go-project/loop_expander"
 )
 
 func TestExecute(t *testing.T) {
@@ -218,8 +220,256 @@ func TestExecute(t *testing.T) {
 			},
 			ExpectError: false,
 		},
+		{
+			Name: "Assignment Loop", // tests/test1.muasm のラベルをアドレスに置き換えたもの
+			Program: []assembler.OpCode{
+				{Mnemonic: "<-", Operands: []string{"x", "2"}},
+				{Mnemonic: "<-", Operands: []string{"w", "0"}},
+				{Mnemonic: "<-", Operands: []string{"w", "w+x"}},
+				{Mnemonic: "<-", Operands: []string{"x", "x-1"}},
+				{Mnemonic: "<-", Operands: []string{"y", "x=0"}},
+				{Mnemonic: "beqz", Operands: []string{"y", "2"}},
+			},
+			InitialConfig: &executor.Configuration{
+				Registers: map[string]interface{}{},
+			},
+			MaxSteps: 20,
+			ExpectedConfigs: []executor.Configuration{
+				{
+					PC:        6,
+					StepCount: 10,
+					Registers: map[string]interface{}{
+						"x": 0,
+						"w": 3,
+						"y": 1,
+					},
+					Memory: map[int]interface{}{},
+					Trace: executor.Trace{
+						Observations: []executor.Observation{
+							{PC: 5, Type: executor.ObsTypePC, Value: executor.SymbolicExpr{Op: "==", Operands: []interface{}{0, 0}}},
+							{PC: 5, Type: executor.ObsTypePC, Value: executor.SymbolicExpr{Op: "!=", Operands: []interface{}{1, 0}}},
+						},
+						PathCond: executor.SymbolicExpr{
+							Op: "&&",
+							Operands: []interface{}{
+								executor.SymbolicExpr{Op: "==", Operands: []interface{}{0, 0}},
+								executor.SymbolicExpr{Op: "!=", Operands: []interface{}{1, 0}},
+							},
+						},
+					},
+				},
+			},
+			ExpectError: false,
+		},
+		{
+			Name: "Load after store to symbolic address",
+			Program: []assembler.OpCode{
+				{Mnemonic: "store", Operands: []string{"v", "x"}},
+				{Mnemonic: "store", Operands: []string{"w", "3"}},
+				{Mnemonic: "load", Operands: []string{"y", "3"}},
+				{Mnemonic: "load", Operands: []string{"z", "4"}},
+			},
+			InitialConfig: &executor.Configuration{
+				Registers: map[string]interface{}{"v": 1, "w": 2},
+				Memory:    map[int]interface{}{4: 9},
+			},
+			MaxSteps: 10,
+			ExpectedConfigs: []executor.Configuration{
+				{
+					PC:        4,
+					StepCount: 4,
+					Registers: map[string]interface{}{
+						"v": 1,
+						"w": 2,
+						"y": 2, // 後から具体的なアドレスに書き込んだ値が優先される
+						"z": executor.SymbolicExpr{Op: "ite", Operands: []interface{}{
+							executor.SymbolicExpr{Op: "==", Operands: []interface{}{4, executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"x"}}}},
+							1,
+							9,
+						}},
+					},
+					Memory: map[int]interface{}{4: 9},
+					Writes: []executor.MemoryWrite{
+						{Address: executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"x"}}, Value: 1},
+						{Address: 3, Value: 2},
+					},
+					Trace: executor.Trace{
+						Observations: []executor.Observation{
+							{PC: 0, Type: executor.ObsTypeStore, Address: executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"x"}}, Value: 1},
+							{PC: 1, Type: executor.ObsTypeStore, Address: 3, Value: 2},
+							{PC: 2, Type: executor.ObsTypeLoad, Address: 3, Value: 2},
+							{PC: 3, Type: executor.ObsTypeLoad, Address: 4, Value: executor.SymbolicExpr{Op: "ite", Operands: []interface{}{
+								executor.SymbolicExpr{Op: "==", Operands: []interface{}{4, executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"x"}}}},
+								1,
+								9,
+							}}},
+						},
+					},
+				},
+			},
+			ExpectError: false,
+		},
 	}
 
 	// テストケースの実行
 	RunTestCase(t, testCases, executor.ExecuteProgram)
 }
+
+func TestRunAssembler(t *testing.T) {
+	testCases := []struct {
+		Name              string
+		Source            string
+		Program           *assembler.Assembler // Source の代わりに実行する手で組み立てたプログラム
+		UnrollCount       int                  // 0 の場合はループ展開しない
+		ExpectedPC        int
+		ExpectedRegisters map[string]interface{}
+		ExpectError       bool
+	}{
+		{
+			Name:              "Loop with label",
+			Source:            "    x<-5\n    w<-0\nLoop:\n    w<-w+x\n    x<-x-1\n    y<-x=0\n    beqz y,Loop\n",
+			ExpectedPC:        6,
+			ExpectedRegisters: map[string]interface{}{"x": 0, "w": 15, "y": 1},
+		},
+		{
+			Name:              "Expanded loop jumps to programEnd",
+			Source:            "    x<-5\n    w<-0\nLoop:\n    w<-w+x\n    x<-x-1\n    y<-x=0\n    beqz y,Loop\n",
+			UnrollCount:       2,
+			ExpectedPC:        12,
+			ExpectedRegisters: map[string]interface{}{"x": 3, "w": 9, "y": 0},
+		},
+		{
+			Name:              "Exceeding the unroll count ends the program",
+			Source:            "    x<-0\nL:\n    x<-x+1\n    c<-x<10\n    beqz c,Out\n    jmp L\nOut:\n    load y,x\n",
+			UnrollCount:       2,
+			ExpectedPC:        12,
+			ExpectedRegisters: map[string]interface{}{"x": 2, "c": 1},
+		},
+		{
+			Name:              "Backward jump inside the loop stays in the same copy",
+			Source:            "    a<-0\n    i<-0\n    n<-0\nL:\n    beqz a,Far\nBack:\n    i<-i+1\n    c<-i<2\n    beqz c,Done\n    jmp L\nFar:\n    n<-n+1\n    jmp Back\nDone:\n    r<-n\n",
+			UnrollCount:       3,
+			ExpectedPC:        28,
+			ExpectedRegisters: map[string]interface{}{"a": 0, "i": 2, "n": 2, "c": 0, "r": 2},
+		},
+		{
+			Name:              "Forward jump to label at the end",
+			Source:            "    jmp End\n    x<-1\nEnd:\n",
+			ExpectedPC:        2,
+			ExpectedRegisters: map[string]interface{}{},
+		},
+		{
+			Name:              "Full operator set",
+			Source:            "    a<-7 mod 3\n    b<-a<<3 xor 1\n    c<-b>=9 /\\ -a=<0\n    d<- ~b \\/ 1\n",
+			ExpectedPC:        4,
+			ExpectedRegisters: map[string]interface{}{"a": 1, "b": 9, "c": 1, "d": -9},
+		},
+		{
+			// ParseAsm は未定義のラベルを拒否するため、手で組み立てたプログラムで確かめる
+			Name: "Undefined label",
+			Program: &assembler.Assembler{
+				Program: []assembler.Instruction{
+					{Addr: 0, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "Nowhere"}}},
+				},
+				Labels: map[string]int{},
+			},
+			ExpectError: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			asm := testCase.Program
+			var err error
+			if asm == nil {
+				asm, err = assembler.ParseAsm(strings.NewReader(testCase.Source))
+				if err != nil {
+					t.Fatalf("failed to parse program: %v", err)
+				}
+			}
+			if testCase.UnrollCount > 0 {
+				asm, err = loop_expander.Loop_expander(asm, testCase.UnrollCount)
+				if err != nil {
+					t.Fatalf("failed to expand loops: %v", err)
+				}
+			}
+
+			finalConfigs, err := executor.RunAssembler(asm, &executor.Configuration{Registers: map[string]interface{}{}}, 100)
+			if testCase.ExpectError {
+				if err == nil {
+					t.Errorf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(finalConfigs) != 1 {
+				t.Fatalf("expected 1 final configuration, but got %d", len(finalConfigs))
+			}
+			if finalConfigs[0].PC != testCase.ExpectedPC {
+				t.Errorf("expected PC %d, but got %d", testCase.ExpectedPC, finalConfigs[0].PC)
+			}
+			if !executor.CompareRegisters(testCase.ExpectedRegisters, finalConfigs[0].Registers) {
+				t.Errorf("expected registers %v, but got %v", testCase.ExpectedRegisters, finalConfigs[0].Registers)
+			}
+		})
+	}
+}
+
+func TestSymbolicMemoryReadsAgree(t *testing.T) {
+	symbol := func(name string) executor.SymbolicExpr {
+		return executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{name}}
+	}
+
+	// 初期メモリは一つの配列なので、アドレスが等しい読み取りは同じ値を返す
+	testCases := []struct {
+		Name        string
+		Source      string
+		SameAddress executor.SymbolicExpr // 二つの読み取りのアドレスが等しいという条件
+	}{
+		{
+			Name:        "Symbolic address before concrete address",
+			Source:      "    load a, i\n    load b, 3\n",
+			SameAddress: executor.SymbolicExpr{Op: "==", Operands: []interface{}{symbol("i"), 3}},
+		},
+		{
+			Name:        "Concrete address before symbolic address",
+			Source:      "    load b, 3\n    load a, i\n",
+			SameAddress: executor.SymbolicExpr{Op: "==", Operands: []interface{}{symbol("i"), 3}},
+		},
+		{
+			Name:        "Two symbolic addresses",
+			Source:      "    load a, i\n    load b, j + 1\n",
+			SameAddress: executor.SymbolicExpr{Op: "==", Operands: []interface{}{symbol("i"), executor.SymbolicExpr{Op: "+", Operands: []interface{}{symbol("j"), 1}}}},
+		},
+		{
+			Name:        "Symbolic read between two others",
+			Source:      "    load a, i\n    load c, k\n    load b, 3\n",
+			SameAddress: executor.SymbolicExpr{Op: "==", Operands: []interface{}{symbol("i"), 3}},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			asm, err := assembler.ParseAsm(strings.NewReader(testCase.Source))
+			if err != nil {
+				t.Fatalf("failed to parse program: %v", err)
+			}
+			initialConfig := &executor.Configuration{Registers: map[string]interface{}{}, MemoryPolicy: executor.MemorySymbolic}
+			finalConfigs, err := executor.RunAssembler(asm, initialConfig, 100)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(finalConfigs) != 1 {
+				t.Fatalf("expected 1 final configuration, but got %d", len(finalConfigs))
+			}
+			registers := finalConfigs[0].Registers
+			differ := executor.SymbolicExpr{Op: "!=", Operands: []interface{}{registers["a"], registers["b"]}}
+			if result, _ := executor.Solve(testCase.SameAddress, differ); result != executor.Unsat {
+				t.Errorf("expected a != b to be unsatisfiable when the addresses are equal, but got %v (a = %s, b = %s)",
+					result, executor.FormatValue(registers["a"]), executor.FormatValue(registers["b"]))
+			}
+		})
+	}
+}
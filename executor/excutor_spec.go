@@ -2,6 +2,7 @@ package executor
 
 import (
 	"errors"
+	"slices"
 
 	"github.com/taisii/go-project/assembler"
 )
@@ -10,6 +11,7 @@ import (
 type ExecutionPath struct {
 	CurrentConf      Configuration
 	SpeculativeStack []SpeculativeState
+	Mispredictions   int // このパスで開始した投機の数
 }
 
 func initializePaths(initialConfig *Configuration) []ExecutionPath {
@@ -27,12 +29,18 @@ func initializePaths(initialConfig *Configuration) []ExecutionPath {
 	}
 }
 
-func handleRollback(currentConf Configuration, specState SpeculativeState) Configuration {
+// handleRollback は、投機を開始した時点の状態に戻し、ロールバックの観測を追加します。
+// step はロールバックが起きた実行ステップで、観測の Step に記録されます。
+func handleRollback(currentConf Configuration, specState SpeculativeState, step int) Configuration {
 	rollbackConf := Configuration{
-		PC:        specState.CorrectPC,
-		Registers: copyRegisters(specState.Configuration.Registers),
-		Memory:    copyMemory(specState.Configuration.Memory),
-		Trace:     currentConf.Trace,
+		PC:           specState.CorrectPC,
+		Registers:    copyRegisters(specState.Configuration.Registers),
+		Memory:       copyMemory(specState.Configuration.Memory),
+		Writes:       copyWrites(specState.Configuration.Writes),
+		InitialReads: copyWrites(currentConf.InitialReads), // 初期値は投機によらないため、投機中に読み取ったものも残す
+		MemoryPolicy: specState.Configuration.MemoryPolicy,
+		StoreBuffer:  copyStoreBuffer(specState.Configuration.StoreBuffer),
+		Trace:        currentConf.Trace,
 	}
 
 	// ロールバック操作をトレースに追加
@@ -42,6 +50,7 @@ func handleRollback(currentConf Configuration, specState SpeculativeState) Confi
 			Type:  ObsTypeRollback,
 			Value: specState.ID,
 			PC:    currentConf.PC,
+			Step:  step,
 		},
 	)
 
@@ -61,64 +70,123 @@ func reverseCopy(slice []ExecutionPath) []ExecutionPath {
 	return reversed
 }
 
-func handleSpecStart(newConfs []*Configuration, correctConfs []*Configuration, path ExecutionPath, defaultRemainingWindow int) []ExecutionPath {
-	var newPaths []ExecutionPath
-
-	for i, conf := range newConfs {
-		copiedPath := copyExecutionPath(path)
-		newSpecState := SpeculativeState{
-			ID:            len(copiedPath.SpeculativeStack),
-			RemainingWin:  defaultRemainingWindow,
-			StartPC:       copiedPath.CurrentConf.PC,
-			Configuration: copyConfiguration(copiedPath.CurrentConf),
-			CorrectPC:     correctConfs[i].PC, // 正しい実行と投機的実行の条件探索順序が同じであることを仮定
-		}
-
-		// SpeculativeStack が空でない場合は RemainingWin を計算
-		if len(copiedPath.SpeculativeStack) > 0 {
-			newSpecState.RemainingWin = copiedPath.SpeculativeStack[len(copiedPath.SpeculativeStack)-1].RemainingWin - 1
-		}
+// handleSpecStart は、投機的な遷移先 successor に進む実行パスを作り、投機の開始をスタックとトレースに記録します。
+// branch は投機を開始した命令です。
+func handleSpecStart(successor Successor, path ExecutionPath, window WindowModel, branch string) ExecutionPath {
+	copiedPath := copyExecutionPath(path)
+	newSpecState := SpeculativeState{
+		ID:            len(copiedPath.SpeculativeStack),
+		RemainingWin:  window.startWindow(copiedPath.SpeculativeStack, branch),
+		StartPC:       copiedPath.CurrentConf.PC,
+		Configuration: copyConfiguration(*successor.Correct), // ロールバック後は正しく実行した状態から再開する
+		CorrectPC:     successor.Correct.PC,
+	}
 
-		newPath := ExecutionPath{
-			CurrentConf:      *conf,
-			SpeculativeStack: append(copiedPath.SpeculativeStack, copySpecState(newSpecState)),
-		}
-		observation := Observation{
-			PC:    copiedPath.CurrentConf.PC,
-			Type:  ObsTypeStart,
-			Value: newSpecState.ID,
-		}
+	// 共有の予算では、分岐命令も外側の投機のウィンドウを消費する
+	if window.Mode == WindowGlobal {
+		window.charge(copiedPath.SpeculativeStack, branch)
+	}
 
-		// Observation をコピー
-		var copiedObs []Observation
-		for _, ob := range newPath.CurrentConf.Trace.Observations {
-			copiedObs = append(copiedObs, copyObservation(ob))
-		}
+	newPath := ExecutionPath{
+		CurrentConf:      *successor.Conf,
+		SpeculativeStack: append(copiedPath.SpeculativeStack, copySpecState(newSpecState)),
+		Mispredictions:   copiedPath.Mispredictions + 1,
+	}
+	observation := Observation{
+		PC:    copiedPath.CurrentConf.PC,
+		Type:  ObsTypeStart,
+		Value: newSpecState.ID,
+	}
 
-		// Observations に新しい要素を最後から2番目に挿入
-		if len(copiedObs) >= 1 {
-			newPath.CurrentConf.Trace.Observations = append(copiedObs[:len(copiedObs)-1], observation, copiedObs[len(copiedObs)-1])
-		} else {
-			newPath.CurrentConf.Trace.Observations = append(copiedObs, observation)
-		}
+	// Observation をコピー
+	var copiedObs []Observation
+	for _, ob := range newPath.CurrentConf.Trace.Observations {
+		copiedObs = append(copiedObs, copyObservation(ob))
+	}
 
-		newPaths = append(newPaths, newPath)
+	// Observations に新しい要素を最後から2番目に挿入
+	if len(copiedObs) >= 1 {
+		newPath.CurrentConf.Trace.Observations = append(copiedObs[:len(copiedObs)-1], observation, copiedObs[len(copiedObs)-1])
+	} else {
+		newPath.CurrentConf.Trace.Observations = append(copiedObs, observation)
 	}
 
-	// スライスを末尾から出していくことでstackとしている。trueのほうから取り出したいからリバースして返す
-	return reverseCopy(newPaths)
+	return newPath
+}
+
+// SpecOptions は、投機実行の設定を表す構造体
+type SpecOptions struct {
+	Window          WindowModel      // 投機ウィンドウのモデル
+	Model           SpeculationModel // 投機のモデル (nil の場合は Semantics から選ぶ)
+	Semantics       SpecSemantics    // 投機する命令 (空の場合は SemanticsBranch)
+	StoreBufferSize int              // ストアバイパスでバイパスできるストアの数 (0 の場合は DefaultStoreBufferSize)
+	// MaxMispredictions が正の場合、各実行パスで開始する投機をその回数までに制限します (MispredictionBudget)。
+	// 0 の場合は制限しません。投機をまったく行わない場合は Model に NeverMispredict を指定します。
+	MaxMispredictions int
 }
 
-// execute runs the given program with the provided initial configuration up to maxSteps.
+// model は、opts で使う SpeculationModel を返します。
+func (opts SpecOptions) model() SpeculationModel {
+	model := opts.Model
+	if model == nil {
+		model = opts.Semantics.Model(opts.StoreBufferSize)
+	}
+	if opts.MaxMispredictions > 0 {
+		model = MispredictionBudget{Max: opts.MaxMispredictions, Model: model}
+	}
+	return model
+}
+
+// execute runs the given program with the provided initial configuration.
+// maxSteps bounds the total number of steps over all paths, not each path; the run fails once it is reached.
+// Every instruction costs one unit of the speculative window (see UnitWindow).
 func SpecExecute(program []assembler.OpCode, initialConfig *Configuration, maxSteps int, remainingWindow int) ([]*Configuration, error) {
+	return SpecExecuteWithOptions(program, initialConfig, maxSteps, SpecOptions{Window: UnitWindow(remainingWindow)})
+}
+
+// SpecExecuteWithOptions は、opts の設定で program を投機実行します。
+func SpecExecuteWithOptions(program []assembler.OpCode, initialConfig *Configuration, maxSteps int, opts SpecOptions) ([]*Configuration, error) {
+	// オペランドは実行前に一度だけ解析する
+	decoded, err := decodeProgram(program)
+	if err != nil {
+		return nil, err
+	}
+	return specExecuteDecoded(decoded, initialConfig, maxSteps, opts)
+}
 
+// SpecRunAssembler は、ラベルをアドレスに解決してから asm を SpecExecute と同様に投機実行します。
+func SpecRunAssembler(asm *assembler.Assembler, initialConfig *Configuration, maxSteps int, remainingWindow int) ([]*Configuration, error) {
+	return SpecRunAssemblerWithOptions(asm, initialConfig, maxSteps, SpecOptions{Window: UnitWindow(remainingWindow)})
+}
+
+// SpecRunAssemblerWithOptions は、ラベルをアドレスに解決してから asm を opts の設定で投機実行します。
+func SpecRunAssemblerWithOptions(asm *assembler.Assembler, initialConfig *Configuration, maxSteps int, opts SpecOptions) ([]*Configuration, error) {
+	decoded, err := decodeAssembler(asm)
+	if err != nil {
+		return nil, err
+	}
+	return specExecuteDecoded(decoded, initialConfig, maxSteps, opts)
+}
+
+// specExecuteDecoded は、解析済みのプログラムを opts の SpeculationModel で投機実行します。
+// maxSteps はパスごとではなくすべてのパスを合わせたステップ数の上限で、達した場合は途中のパスを捨てずにエラーを返します。
+// 上限を超えたパスを結果から除く executeDecoded と異なり、検査が一部のパスだけで安全と判定することはありません。
+func specExecuteDecoded(decoded []assembler.Stmt, initialConfig *Configuration, maxSteps int, opts SpecOptions) ([]*Configuration, error) {
+	if err := opts.Window.validate(); err != nil {
+		return nil, err
+	}
+	model := opts.model()
 	copiedConfig := copyConfiguration(*initialConfig)
 	paths := initializePaths(&copiedConfig)
 	var finalConfigs []*Configuration
 	stepCount := 0
 
 	// 実行ループ
-	for stepCount < maxSteps {
+	for {
+		// 最大ステップ数を超えた場合のエラー処理 (残りのパスがあれば、ロールバックや終了の処理も 1 ステップとして数える)
+		if len(paths) > 0 && stepCount >= maxSteps {
+			return nil, errors.New("execution reached maximum step limit")
+		}
 		stepCount++
 
 		if len(paths) > 0 {
@@ -132,19 +200,19 @@ func SpecExecute(program []assembler.OpCode, initialConfig *Configuration, maxSt
 
 				if currentSpeclativeStack.RemainingWin <= 0 {
 					currentPath.SpeculativeStack = currentPath.SpeculativeStack[:len(currentPath.SpeculativeStack)-1]
-					currentPath.CurrentConf = handleRollback(currentPath.CurrentConf, currentSpeclativeStack)
+					currentPath.CurrentConf = handleRollback(currentPath.CurrentConf, currentSpeclativeStack, stepCount)
 					paths = append(paths, currentPath)
 					continue
 				}
 			}
 
 			// プログラム終了判定
-			if currentPath.CurrentConf.PC >= len(program) {
+			if currentPath.CurrentConf.PC >= len(decoded) {
 				if len(currentPath.SpeculativeStack) > 0 {
 					// ロールバック処理
 					lastSpecState := currentPath.SpeculativeStack[len(currentPath.SpeculativeStack)-1]
 					currentPath.SpeculativeStack = currentPath.SpeculativeStack[:len(currentPath.SpeculativeStack)-1]
-					currentPath.CurrentConf = handleRollback(currentPath.CurrentConf, lastSpecState)
+					currentPath.CurrentConf = handleRollback(currentPath.CurrentConf, lastSpecState, stepCount)
 
 					paths = append(paths, currentPath)
 				} else {
@@ -155,38 +223,59 @@ func SpecExecute(program []assembler.OpCode, initialConfig *Configuration, maxSt
 			}
 
 			// 命令実行フェーズ
-			instruction := program[currentPath.CurrentConf.PC]
-			newConfs, isSpeculative, err := AlwaysMispredictStep(instruction, &currentPath.CurrentConf)
+			instruction := decoded[currentPath.CurrentConf.PC]
+			mnemonic := assembler.Mnemonic(instruction)
+
+			successors, err := model.Successors(instruction, &currentPath.CurrentConf, SpecContext{
+				Depth:          len(currentPath.SpeculativeStack),
+				Mispredictions: currentPath.Mispredictions,
+			})
 			if err != nil {
 				return nil, err
 			}
+			// 投機中にバリアに到達した場合は残りウィンドウを 0 にし、次のループでロールバックさせる
+			if len(currentPath.SpeculativeStack) > 0 && slices.ContainsFunc(successors, func(s Successor) bool { return s.Barrier }) {
+				currentPath.SpeculativeStack[len(currentPath.SpeculativeStack)-1].RemainingWin = 0
+				paths = append(paths, currentPath)
+				continue
+			}
+			// シンボリックな分岐で分かれた場合は、パス条件が充足不能な遷移先を取り除く
+			if len(successors) > 1 {
+				successors = feasibleSuccessors(successors)
+			}
 
-			if isSpeculative {
-				//ここでStep関数を実行して正しい遷移先を取得している。2つのsemanticsを表す関数が同じ順序でconfsを返すことが前提になっている
-				correctConfs, err := Step(instruction, &currentPath.CurrentConf)
-				if err != nil {
-					return nil, err
+			var nextPaths []ExecutionPath
+			for i, successor := range successors {
+				if successor.Speculative() {
+					nextPaths = append(nextPaths, handleSpecStart(successor, currentPath, opts.Window, mnemonic))
+					continue
 				}
-				paths = append(paths, handleSpecStart(newConfs, correctConfs, currentPath, remainingWindow)...)
-			} else {
 				// 通常の命令実行
-				currentPath.CurrentConf = *newConfs[0]
+				nextPath := currentPath
+				if i < len(successors)-1 {
+					nextPath = copyExecutionPath(currentPath)
+				}
+				nextPath.CurrentConf = *successor.Conf
 
 				//Remaining Windowの操作
-				if len(currentPath.SpeculativeStack) > 0 {
-					currentPath.SpeculativeStack[len(currentPath.SpeculativeStack)-1].RemainingWin--
-				}
-				paths = append(paths, currentPath)
+				opts.Window.charge(nextPath.SpeculativeStack, mnemonic)
+				nextPaths = append(nextPaths, nextPath)
 			}
+			// スライスを末尾から出していくことでstackとしている。最初の遷移先から取り出したいからリバースして積む
+			paths = append(paths, reverseCopy(nextPaths)...)
 		} else {
 			return finalConfigs, nil
 		}
+	}
+}
 
-		// 最大ステップ数を超えた場合のエラー処理
-		if stepCount >= maxSteps {
-			return nil, errors.New("execution reached maximum step limit")
+// feasibleSuccessors は、パス条件が充足不能な遷移先を取り除きます。
+func feasibleSuccessors(successors []Successor) []Successor {
+	var kept []Successor
+	for _, successor := range successors {
+		if isFeasible(successor.Conf.Trace.PathCond) {
+			kept = append(kept, successor)
 		}
 	}
-
-	return finalConfigs, nil
+	return kept
 }
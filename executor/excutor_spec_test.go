@@ -716,6 +716,71 @@ func TestSpecExecute(t *testing.T) {
 			ExpectedConfigs: nil,
 			ExpectError:     true,
 		},
+		// 投機実行バリア
+		{
+			Name: "spbarr stops speculation",
+			Program: []assembler.OpCode{
+				{Mnemonic: "beqz", Operands: []string{"x", "3"}},
+				{Mnemonic: "spbarr"},
+				{Mnemonic: "load", Operands: []string{"y", "0"}},
+			},
+			InitialConfig: &executor.Configuration{
+				PC: 0,
+				Registers: map[string]interface{}{
+					"x": 0,
+				},
+				Memory: map[int]interface{}{0: 7},
+				Trace:  executor.Trace{},
+			},
+			MaxSteps: 10,
+			ExpectedConfigs: []executor.Configuration{
+				{ // 誤って PC 1 に進むが、spbarr で load の前にロールバックする
+					PC: 3,
+					Registers: map[string]interface{}{
+						"x": 0,
+					},
+					Memory: map[int]interface{}{0: 7},
+					Trace: executor.Trace{
+						Observations: []executor.Observation{
+							{PC: 0, Type: executor.ObsTypeStart, Value: 0},
+							{PC: 0, Type: executor.ObsTypePC, Value: executor.SymbolicExpr{Op: "!=", Operands: []interface{}{0, 0}}},
+							{PC: 1, Type: executor.ObsTypeRollback, Value: 0},
+						},
+						PathCond: executor.SymbolicExpr{Op: "==", Operands: []interface{}{0, 0}},
+					},
+				},
+			},
+			ExpectError: false,
+		},
+		{
+			Name: "spbarr outside speculation",
+			Program: []assembler.OpCode{
+				{Mnemonic: "spbarr"},
+				{Mnemonic: "load", Operands: []string{"y", "0"}},
+			},
+			InitialConfig: &executor.Configuration{
+				PC:        0,
+				Registers: map[string]interface{}{},
+				Memory:    map[int]interface{}{0: 7},
+				Trace:     executor.Trace{},
+			},
+			MaxSteps: 10,
+			ExpectedConfigs: []executor.Configuration{
+				{
+					PC: 2,
+					Registers: map[string]interface{}{
+						"y": 7,
+					},
+					Memory: map[int]interface{}{0: 7},
+					Trace: executor.Trace{
+						Observations: []executor.Observation{
+							{PC: 1, Type: executor.ObsTypeLoad, Address: 0, Value: 7},
+						},
+					},
+				},
+			},
+			ExpectError: false,
+		},
 		// 無効な命令
 		{
 			Name: "Unsupported instruction",
@@ -2,30 +2,44 @@ package executor
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"strings"
 )
 
-// PrintConfiguration 詳細なフォーマットでConfigurationを表示
+// PrintConfiguration 詳細なフォーマットでConfigurationを標準出力に表示
 func PrintConfiguration(config Configuration) {
-	fmt.Println("Configuration Details:")
-	fmt.Printf("  Program Counter (PC): %d\n", config.PC)
-	fmt.Printf("  Step Count: %d\n", config.StepCount)
+	FprintConfiguration(os.Stdout, config)
+}
+
+// FprintConfiguration 詳細なフォーマットでConfigurationを w に出力
+func FprintConfiguration(w io.Writer, config Configuration) {
+	fmt.Fprintln(w, "Configuration Details:")
+	fmt.Fprintf(w, "  Program Counter (PC): %d\n", config.PC)
+	fmt.Fprintf(w, "  Step Count: %d\n", config.StepCount)
 
-	fmt.Println("  Registers:")
+	fmt.Fprintln(w, "  Registers:")
 	if len(config.Registers) == 0 {
-		fmt.Println("    (empty)")
+		fmt.Fprintln(w, "    (empty)")
 	} else {
-		printMapStringInterface(config.Registers, "    ")
+		printMapStringInterface(w, config.Registers, "    ")
 	}
 
-	fmt.Println("  Memory:")
+	fmt.Fprintln(w, "  Memory:")
 	if len(config.Memory) == 0 {
-		fmt.Println("    (empty)")
+		fmt.Fprintln(w, "    (empty)")
 	} else {
-		printMapIntInterface(config.Memory, "    ")
+		printMapIntInterface(w, config.Memory, "    ")
 	}
 
-	PrintTrace(config.Trace)
+	if len(config.Writes) > 0 {
+		fmt.Fprintln(w, "  Memory Writes:")
+		for _, write := range config.Writes {
+			fmt.Fprintf(w, "    [%s] <- %s\n", formatValue(write.Address), formatValue(write.Value))
+		}
+	}
+
+	FprintTrace(w, config.Trace)
 }
 
 func FormatConfigDifferences(expected, actual Configuration) string {
@@ -80,6 +94,11 @@ func FormatConfigDifferences(expected, actual Configuration) string {
 		}
 	}
 
+	// 書き込みの履歴の違い
+	if !CompareWrites(expected.Writes, actual.Writes) {
+		sb.WriteString(fmt.Sprintf("- Memory writes mismatch: expected %+v, got %+v\n", expected.Writes, actual.Writes))
+	}
+
 	// Traceの比較
 	sb.WriteString("Trace Differences:\n")
 	sb.WriteString(FormatTraceDifferences(expected.Trace, actual.Trace))
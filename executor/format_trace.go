@@ -2,31 +2,39 @@ package executor
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"sort"
 	"strings"
 )
 
-// PrintTrace 詳細なフォーマットでTraceを表示
+// PrintTrace 詳細なフォーマットでTraceを標準出力に表示
 func PrintTrace(trace Trace) {
-	fmt.Println("Trace :")
+	FprintTrace(os.Stdout, trace)
+}
+
+// FprintTrace 詳細なフォーマットでTraceを w に出力
+func FprintTrace(w io.Writer, trace Trace) {
+	fmt.Fprintln(w, "Trace :")
 
 	// 観測データの表示
 	if len(trace.Observations) == 0 {
-		fmt.Println("  Observations: (none)")
+		fmt.Fprintln(w, "  Observations: (none)")
 	} else {
-		fmt.Println("  Observations:")
+		fmt.Fprintln(w, "  Observations:")
 		for _, obs := range trace.Observations {
-			printObservation(obs) // 既存のprintObservationを利用
+			printObservation(w, obs) // 既存のprintObservationを利用
 		}
 	}
 
 	// パス条件の表示
-	fmt.Println("  Path Condition:")
+	fmt.Fprintln(w, "  Path Condition:")
 	if len(trace.PathCond.Operands) == 0 {
-		fmt.Println("    (none)")
+		fmt.Fprintln(w, "    (none)")
 	} else {
-		fmt.Printf("    %s\n", formatSymbolicExpr(trace.PathCond))
+		fmt.Fprintf(w, "    %s\n", formatSymbolicExpr(trace.PathCond))
 	}
-	fmt.Println("===========================")
+	fmt.Fprintln(w, "===========================")
 }
 
 func FormatTraceDifferences(expected, actual Trace) string {
@@ -75,22 +83,27 @@ func FormatTraceDifferences(expected, actual Trace) string {
 }
 
 // printObservation 観測データを整形して出力
-func printObservation(obs Observation) {
-	fmt.Printf("  PC: %d, Type: %s", obs.PC, obs.Type)
+func printObservation(w io.Writer, obs Observation) {
+	fmt.Fprintf(w, "  PC: %d, Type: %s", obs.PC, obs.Type)
 
 	// Addressがある場合の処理
 	if obs.Address != nil {
-		fmt.Printf(", Address: %s", formatValue(obs.Address))
+		fmt.Fprintf(w, ", Address: %s", formatValue(obs.Address))
 	}
 
 	// Valueがある場合の処理
 	if obs.Value != nil {
-		fmt.Printf(", Value: %s", formatValue(obs.Value))
+		fmt.Fprintf(w, ", Value: %s", formatValue(obs.Value))
+	}
+
+	// ロールバックが起きたステップ
+	if obs.Type == ObsTypeRollback {
+		fmt.Fprintf(w, ", Step: %d", obs.Step)
 	}
 
 	// SpeculativeStateがある場合の処理
 	if obs.SpecState != nil {
-		fmt.Printf(", SpeculativeState: {ID: %d, RemainingWin: %d, StartPC: %d, CorrectPC: %d, InitialConf: {Registers: %v, Memory: %v}}",
+		fmt.Fprintf(w, ", SpeculativeState: {ID: %d, RemainingWin: %d, StartPC: %d, CorrectPC: %d, InitialConf: {Registers: %v, Memory: %v}}",
 			obs.SpecState.ID,
 			obs.SpecState.RemainingWin,
 			obs.SpecState.StartPC,
@@ -99,27 +112,37 @@ func printObservation(obs Observation) {
 			obs.SpecState.Configuration.Memory)
 	}
 
-	fmt.Println()
+	fmt.Fprintln(w)
 }
 
 // printMemoryAndRegister Configuration を整形して出力
-func printMemoryAndRegister(config Configuration) {
-	fmt.Println("  m=")
-	printMapStringInterface(config.Registers, "    ")
-	fmt.Println("  a=")
-	printMapIntInterface(config.Memory, "    ")
+func printMemoryAndRegister(w io.Writer, config Configuration) {
+	fmt.Fprintln(w, "  m=")
+	printMapStringInterface(w, config.Registers, "    ")
+	fmt.Fprintln(w, "  a=")
+	printMapIntInterface(w, config.Memory, "    ")
 }
 
-// printMapStringInterface map[string]interface{} を整形して出力
-func printMapStringInterface(data map[string]interface{}, indent string) {
-	for key, value := range data {
-		fmt.Printf("%s%s: %s\n", indent, key, formatValue(value))
+// printMapStringInterface map[string]interface{} をキーの順に整形して出力
+func printMapStringInterface(w io.Writer, data map[string]interface{}, indent string) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s: %s\n", indent, key, formatValue(data[key]))
 	}
 }
 
-// printMapIntInterface map[int]interface{} を整形して出力
-func printMapIntInterface(data map[int]interface{}, indent string) {
-	for key, value := range data {
-		fmt.Printf("%s%d: %s\n", indent, key, formatValue(value))
+// printMapIntInterface map[int]interface{} をキーの順に整形して出力
+func printMapIntInterface(w io.Writer, data map[int]interface{}, indent string) {
+	keys := make([]int, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%d: %s\n", indent, key, formatValue(data[key]))
 	}
 }
@@ -5,6 +5,11 @@ import (
 	"strings"
 )
 
+// FormatValue は、具体値またはシンボリック式を "(x + 1)" のような文字列に変換します。
+func FormatValue(value interface{}) string {
+	return formatValue(value)
+}
+
 // formatValue 値を適切にフォーマット
 func formatValue(value interface{}) string {
 	switch v := value.(type) {
@@ -23,15 +28,34 @@ func formatValue(value interface{}) string {
 
 // formatSymbolicExpr シンボリック式を文字列にフォーマット
 func formatSymbolicExpr(expr SymbolicExpr) string {
+	// 単項演算子は前置で出力
+	if len(expr.Operands) == 1 {
+		switch expr.Op {
+		case "neg":
+			return "-" + formatValue(expr.Operands[0])
+		case "~", "!":
+			return expr.Op + formatValue(expr.Operands[0])
+		}
+	}
+
 	// 単一のオペランドの場合は括弧で囲まずに出力
 	if len(expr.Operands) == 1 {
 		return formatValue(expr.Operands[0])
 	}
 
+	// ite は関数呼び出しの形で出力
+	if expr.Op == "ite" && len(expr.Operands) == 3 {
+		return fmt.Sprintf("ite(%s, %s, %s)", formatValue(expr.Operands[0]), formatValue(expr.Operands[1]), formatValue(expr.Operands[2]))
+	}
+
 	// 演算を伴う場合はオペランドを演算子で結合し、式全体を () で囲む
 	var operands []string
 	for _, op := range expr.Operands {
 		operands = append(operands, formatValue(op))
 	}
-	return fmt.Sprintf("(%s)", strings.Join(operands, fmt.Sprintf(" %s ", expr.Op)))
+	op := expr.Op
+	if op == "%" {
+		op = "mod" // % は .muasm ではコメントの開始になるため
+	}
+	return fmt.Sprintf("(%s)", strings.Join(operands, fmt.Sprintf(" %s ", op)))
 }
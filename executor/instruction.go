@@ -2,11 +2,32 @@ package executor
 
 // Configuration structure
 type Configuration struct {
-	PC        int                    // Program Counter
-	Registers map[string]interface{} // General-purpose registers (can hold symbolic or concrete values)
-	Memory    map[int]interface{}    // Memory (address to value, symbolic or concrete)
-	Trace     Trace
-	StepCount int
+	PC           int                    // Program Counter
+	Registers    map[string]interface{} // General-purpose registers (can hold symbolic or concrete values)
+	Memory       map[int]interface{}    // Memory (address to value, symbolic or concrete)
+	Writes       []MemoryWrite          // Stores made after the first store to a symbolic address, oldest first
+	InitialReads []MemoryWrite          // Initial values read from symbolic addresses missing from Memory, oldest first
+	MemoryPolicy MemoryPolicy           // How loads from uninitialised memory are handled (default: strict)
+	StoreBuffer  []PendingStore         // Recent stores that later loads may bypass (store-bypass semantics only)
+	Trace        Trace
+	StepCount    int
+}
+
+// MemoryPolicy decides what a load from an address missing from Memory returns.
+type MemoryPolicy string
+
+const (
+	MemoryStrict   MemoryPolicy = "strict"   // Report an error (the zero value behaves the same)
+	MemorySymbolic MemoryPolicy = "symbolic" // Return a fresh input symbol named by MemorySymbol and record it in Memory
+	MemoryZero     MemoryPolicy = "zero"     // Return 0
+)
+
+// MemoryWrite is a store whose address may be symbolic.
+// Once a program stores to a symbolic address, later stores are recorded here in order
+// so that loads can be resolved against them with an if-then-else chain.
+type MemoryWrite struct {
+	Address interface{} // Address expression (concrete or symbolic)
+	Value   interface{} // Stored value (concrete or symbolic)
 }
 
 // SymbolicExpr represents a symbolic expression.
@@ -26,6 +47,7 @@ type Observation struct {
 	Address   interface{}       // メモリアクセスの場合のアドレス（シンボリック形式）
 	Value     interface{}       // 値の読み取りや書き込みの内容（シンボリック形式）
 	SpecState *SpeculativeState // スペキュレーション状態（該当する場合）
+	Step      int               // ロールバックが起きた SpecExecute の実行ステップ（rollback の場合）
 }
 
 type ObsType string
@@ -0,0 +1,154 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MemorySymbol は、アドレス addr のメモリの初期値を表すシンボル名を返します。
+func MemorySymbol(addr int) string {
+	return fmt.Sprintf("mem[%d]", addr)
+}
+
+// memorySymbolAddress は、MemorySymbol(addr) の形式のシンボル名からアドレスを返します。
+// シンボリックなアドレスのメモリのシンボル名などの場合は false を返します。
+func memorySymbolAddress(name string) (int, bool) {
+	inner, ok := strings.CutPrefix(name, "mem[")
+	if !ok || !strings.HasSuffix(inner, "]") {
+		return 0, false
+	}
+	addr, err := strconv.Atoi(strings.TrimSuffix(inner, "]"))
+	return addr, err == nil
+}
+
+// ParseMemoryPolicy は、文字列 (strict, symbolic, zero) を MemoryPolicy に変換します。
+func ParseMemoryPolicy(name string) (MemoryPolicy, error) {
+	switch policy := MemoryPolicy(name); policy {
+	case MemoryStrict, MemorySymbolic, MemoryZero:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown memory policy %q (expected strict, symbolic or zero)", name)
+}
+
+// readMemory はアドレス address (具体値またはシンボリック) のメモリの値を返します。
+// シンボリックなアドレスへの書き込みがある場合や、アドレスがシンボリックな場合は
+// 書き込みの履歴に対する ite (if-then-else) 式を組み立てます。
+func readMemory(conf *Configuration, address interface{}) (interface{}, error) {
+	value, err := initialMemoryValue(conf, address)
+	if err != nil {
+		return nil, err
+	}
+
+	// 古い書き込みから順に重ねていく (最後に一致した書き込みが優先される)
+	for _, write := range conf.Writes {
+		addr, addrConcrete := address.(int)
+		writeAddr, writeConcrete := write.Address.(int)
+		switch {
+		case addrConcrete && writeConcrete:
+			if addr == writeAddr {
+				value = write.Value
+			}
+		case CompareSymbolicExpr(address, write.Address):
+			value = write.Value
+		default:
+			value = ite(SymbolicExpr{Op: "==", Operands: []interface{}{address, write.Address}}, write.Value, value)
+		}
+	}
+	return value, nil
+}
+
+// initialMemoryValue は、Writes を適用する前の Memory から値を読み取ります。
+func initialMemoryValue(conf *Configuration, address interface{}) (interface{}, error) {
+	if addr, ok := address.(int); ok {
+		value, exists := conf.Memory[addr]
+		if !exists {
+			if memoryWritten(conf, addr) {
+				// Writes で上書きされるため初期値は使われない
+				return 0, nil
+			}
+			switch conf.MemoryPolicy {
+			case MemorySymbolic:
+				// 新しい入力として記録し、以降の読み取りでも同じ値を返す
+				// (以前にシンボリックなアドレスから読み取った初期値とアドレスが一致する場合はその値になる)
+				value := initialRead(conf, addr, SymbolicExpr{Op: "symbol", Operands: []interface{}{MemorySymbol(addr)}})
+				if conf.Memory == nil {
+					conf.Memory = make(map[int]interface{})
+				}
+				conf.Memory[addr] = value
+				return value, nil
+			case MemoryZero:
+				return 0, nil
+			}
+			return nil, fmt.Errorf("memory address %d not found", addr)
+		}
+		return value, nil
+	}
+
+	// アドレスがシンボリックな場合は、既知のセルと一致するかどうかで場合分けする
+	// (どのセルとも一致しない場合の値は、zero 以外のポリシーではアドレス式で名付けたシンボルを
+	// 以前に読み取った初期値と一致させたものにする)
+	var value interface{} = 0
+	if conf.MemoryPolicy != MemoryZero {
+		value = initialRead(conf, address, SymbolicExpr{Op: "symbol", Operands: []interface{}{fmt.Sprintf("mem[%s]", formatValue(address))}})
+	}
+	addrs := make([]int, 0, len(conf.Memory))
+	for addr := range conf.Memory {
+		addrs = append(addrs, addr)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(addrs)))
+	for _, addr := range addrs {
+		value = ite(SymbolicExpr{Op: "==", Operands: []interface{}{address, addr}}, conf.Memory[addr], value)
+	}
+	return value, nil
+}
+
+// initialRead は、Memory にないアドレス address の初期値を返します。
+// 初期メモリを一つの配列として扱うため、以前にシンボリックなアドレスから読み取った初期値とアドレスが等しい場合は
+// その値に、どれとも等しくない場合は fresh になる ite 式を組み立てます。
+// アドレスがシンボリックな場合は、以降の読み取りのために結果を InitialReads に記録します。
+func initialRead(conf *Configuration, address interface{}, fresh interface{}) interface{} {
+	for _, read := range conf.InitialReads {
+		if CompareSymbolicExpr(address, read.Address) {
+			return read.Value
+		}
+	}
+	value := fresh
+	for i := len(conf.InitialReads) - 1; i >= 0; i-- {
+		read := conf.InitialReads[i]
+		value = ite(SymbolicExpr{Op: "==", Operands: []interface{}{address, read.Address}}, read.Value, value)
+	}
+	if _, concrete := address.(int); !concrete {
+		conf.InitialReads = append(conf.InitialReads, MemoryWrite{Address: address, Value: value})
+	}
+	return value
+}
+
+// memoryWritten は、Writes に具体的なアドレス addr への書き込みがあるかを返します。
+func memoryWritten(conf *Configuration, addr int) bool {
+	for _, write := range conf.Writes {
+		if writeAddr, ok := write.Address.(int); ok && writeAddr == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// writeMemory は、アドレス address に value を書き込みます。
+// シンボリックなアドレスへの書き込みが一度でもあれば、以降の書き込みは順序を保つため Writes に追加します。
+func writeMemory(conf *Configuration, address interface{}, value interface{}) {
+	if addr, ok := address.(int); ok && len(conf.Writes) == 0 {
+		if conf.Memory == nil {
+			conf.Memory = make(map[int]interface{})
+		}
+		conf.Memory[addr] = value
+		return
+	}
+	conf.Writes = append(conf.Writes, MemoryWrite{Address: address, Value: value})
+}
+
+// ite は、cond が 0 以外なら then、0 なら els となる式を返します。
+func ite(cond interface{}, then interface{}, els interface{}) SymbolicExpr {
+	return SymbolicExpr{Op: "ite", Operands: []interface{}{cond, then, els}}
+}
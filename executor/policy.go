@@ -0,0 +1,418 @@
+package executor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/taisii/go-project/assembler"
+)
+
+// PolicyFile は、ポリシーファイルで宣言されたプログラムの入力を表す構造体
+//
+// ポリシーファイルは一行に一つの宣言を書くテキストファイルで、% 以降はコメントです。
+//
+//	public x, y          % 公開レジスタ
+//	public mem[0..15]    % 公開メモリ (範囲は両端を含む)
+//	secret k, mem[100]   % 秘密の入力 (宣言しなくても公開でない入力は秘密)
+//	init x = 3           % 具体的な初期値
+//	init mem[0..3] = 0
+//	symbolic y, mem[16]  % シンボリックな入力 (初期値のシンボル名はレジスタ名または MemorySymbol(addr))
+//	memory symbolic      % 初期化されていないメモリの扱い (strict, symbolic, zero)
+//
+// .muasm ファイルの中では、%! で始まるコメントに同じ宣言を書けます。
+type PolicyFile struct {
+	Policy          Policy                 // 公開入力
+	SecretRegisters []string               // 秘密と宣言されたレジスタ
+	SecretMemory    []AddressRange         // 秘密と宣言されたメモリのアドレスの範囲 (アドレス順で重ならない)
+	Registers       map[string]interface{} // レジスタの初期値
+	Memory          map[int]interface{}    // メモリの初期値
+	MemoryPolicy    MemoryPolicy           // 初期化されていないメモリの扱い (空の場合は指定なし)
+}
+
+// PolicyExtension は、サイドカーのポリシーファイルの拡張子です。
+const PolicyExtension = ".policy"
+
+// directivePrefix は、.muasm ファイルの中でポリシーの宣言を表すコメントの接頭辞です。
+const directivePrefix = "%!"
+
+// maxInitRange は、init と symbolic で宣言できるメモリの範囲のアドレスの数の上限です。
+// これらはアドレスごとに初期値を持つため、範囲を一つずつ展開します。
+const maxInitRange = 1 << 16
+
+// NewPolicyFile は、宣言のない PolicyFile を返します。
+func NewPolicyFile() *PolicyFile {
+	return &PolicyFile{
+		Registers: make(map[string]interface{}),
+		Memory:    make(map[int]interface{}),
+	}
+}
+
+// ParsePolicy は、ポリシーファイルを読み込みます。
+// 構文エラーは filename と行番号を含む *assembler.ParseError として返します。
+func ParsePolicy(filename string, r io.Reader) (*PolicyFile, error) {
+	policy := NewPolicyFile()
+	if err := policy.parse(filename, r, false); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// ParsePolicyDirectives は、.muasm ファイルの %! コメントに書かれた宣言を読み込みます。
+// 宣言以外の行は無視します。
+func ParsePolicyDirectives(filename string, r io.Reader) (*PolicyFile, error) {
+	policy := NewPolicyFile()
+	if err := policy.parse(filename, r, true); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// LoadPolicyFile は、asmPath のプログラムのポリシーを読み込みます。
+// プログラム内の %! の宣言を読み込んだ後、拡張子を .policy に置き換えたファイルがあればその宣言を追加します。
+func LoadPolicyFile(asmPath string) (*PolicyFile, error) {
+	policy := NewPolicyFile()
+	if err := policy.parseFile(asmPath, true); err != nil {
+		return nil, err
+	}
+
+	sidecar := strings.TrimSuffix(asmPath, filepath.Ext(asmPath)) + PolicyExtension
+	if err := policy.parseFile(sidecar, false); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// LoadFile は、path のポリシーファイルの宣言を policy に追加します。
+func (p *PolicyFile) LoadFile(path string) error {
+	return p.parseFile(path, false)
+}
+
+// parseFile は、path のファイルの宣言を policy に追加します。
+func (p *PolicyFile) parseFile(path string, directives bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return p.parse(path, file, directives)
+}
+
+// parse は、r の宣言を policy に追加します。directives が true の場合は %! の行だけを読みます。
+func (p *PolicyFile) parse(filename string, r io.Reader, directives bool) error {
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		text := scanner.Text()
+		offset := 0
+		if directives {
+			i := strings.Index(text, directivePrefix)
+			if i == -1 {
+				continue
+			}
+			offset = i + len(directivePrefix)
+			text = text[offset:]
+		}
+		if i := strings.Index(text, "%"); i != -1 {
+			text = text[:i]
+		}
+		line := strings.TrimSpace(text)
+		if line == "" {
+			continue
+		}
+		column := offset + strings.Index(text, line) + 1
+
+		if err := p.declare(line); err != nil {
+			return &assembler.ParseError{File: filename, Line: lineNo, Column: column, Message: err.Error()}
+		}
+	}
+	return scanner.Err()
+}
+
+// declare は、一つの宣言を policy に追加します。
+func (p *PolicyFile) declare(line string) error {
+	keyword, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+	switch keyword {
+	case "public", "secret", "symbolic":
+		if rest == "" {
+			return fmt.Errorf("%s requires at least one input", keyword)
+		}
+		for _, item := range strings.Split(rest, ",") {
+			input, err := parsePolicyInput(strings.TrimSpace(item))
+			if err != nil {
+				return err
+			}
+			if err := p.mark(keyword, input); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "init":
+		target, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			return fmt.Errorf("init requires the form init <input> = <value>")
+		}
+		input, err := parsePolicyInput(strings.TrimSpace(target))
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("initial value of %s must be an integer, got %q", input, strings.TrimSpace(value))
+		}
+		if input.register != "" {
+			p.Registers[input.register] = n
+			return nil
+		}
+		return input.eachAddress("init", func(addr int) {
+			p.Memory[addr] = n
+		})
+	case "memory":
+		policy, err := ParseMemoryPolicy(rest)
+		if err != nil {
+			return err
+		}
+		p.MemoryPolicy = policy
+		return nil
+	}
+	return fmt.Errorf("unknown policy declaration %q (expected public, secret, init, symbolic or memory)", keyword)
+}
+
+// mark は、input を public、secret、symbolic のいずれかとして宣言します。
+func (p *PolicyFile) mark(keyword string, input policyInput) error {
+	if input.register != "" {
+		switch keyword {
+		case "public":
+			if slices.Contains(p.SecretRegisters, input.register) {
+				return fmt.Errorf("%s is declared both public and secret", input.register)
+			}
+			p.Policy.PublicRegisters = appendUnique(p.Policy.PublicRegisters, input.register)
+		case "secret":
+			if slices.Contains(p.Policy.PublicRegisters, input.register) {
+				return fmt.Errorf("%s is declared both public and secret", input.register)
+			}
+			p.SecretRegisters = appendUnique(p.SecretRegisters, input.register)
+		case "symbolic":
+			p.Registers[input.register] = SymbolicExpr{Op: "symbol", Operands: []interface{}{input.register}}
+		}
+		return nil
+	}
+
+	r := input.addressRange()
+	switch keyword {
+	case "public":
+		if addr, ok := overlap(p.SecretMemory, r); ok {
+			return fmt.Errorf("%s is declared both public and secret", MemorySymbol(addr))
+		}
+		p.Policy.PublicMemory = addRange(p.Policy.PublicMemory, r)
+	case "secret":
+		if addr, ok := overlap(p.Policy.PublicMemory, r); ok {
+			return fmt.Errorf("%s is declared both public and secret", MemorySymbol(addr))
+		}
+		p.SecretMemory = addRange(p.SecretMemory, r)
+	case "symbolic":
+		return input.eachAddress("symbolic", func(addr int) {
+			p.Memory[addr] = SymbolicExpr{Op: "symbol", Operands: []interface{}{MemorySymbol(addr)}}
+		})
+	}
+	return nil
+}
+
+// Configuration は、宣言された初期値を持つ初期状態を返します。
+// 返した Configuration のマップは PolicyFile と共有しません。
+func (p *PolicyFile) Configuration() *Configuration {
+	registers := make(map[string]interface{}, len(p.Registers))
+	for name, value := range p.Registers {
+		registers[name] = value
+	}
+	memory := make(map[int]interface{}, len(p.Memory))
+	for addr, value := range p.Memory {
+		memory[addr] = value
+	}
+	conf := NewConfiguration(memory, registers)
+	conf.MemoryPolicy = p.MemoryPolicy
+	return conf
+}
+
+// String は、ポリシーをポリシーファイルの形式で返します。
+func (p *PolicyFile) String() string {
+	var lines []string
+	if len(p.Policy.PublicRegisters) > 0 {
+		lines = append(lines, "public "+strings.Join(p.Policy.PublicRegisters, ", "))
+	}
+	if len(p.Policy.PublicMemory) > 0 {
+		lines = append(lines, "public "+formatAddressRanges(p.Policy.PublicMemory))
+	}
+	if len(p.SecretRegisters) > 0 {
+		lines = append(lines, "secret "+strings.Join(p.SecretRegisters, ", "))
+	}
+	if len(p.SecretMemory) > 0 {
+		lines = append(lines, "secret "+formatAddressRanges(p.SecretMemory))
+	}
+
+	names := make([]string, 0, len(p.Registers))
+	for name := range p.Registers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if n, ok := p.Registers[name].(int); ok {
+			lines = append(lines, fmt.Sprintf("init %s = %d", name, n))
+		} else {
+			lines = append(lines, "symbolic "+name)
+		}
+	}
+	addrs := make([]int, 0, len(p.Memory))
+	for addr := range p.Memory {
+		addrs = append(addrs, addr)
+	}
+	sort.Ints(addrs)
+	for _, addr := range addrs {
+		if n, ok := p.Memory[addr].(int); ok {
+			lines = append(lines, fmt.Sprintf("init %s = %d", MemorySymbol(addr), n))
+		} else {
+			lines = append(lines, "symbolic "+MemorySymbol(addr))
+		}
+	}
+
+	if p.MemoryPolicy != "" {
+		lines = append(lines, "memory "+string(p.MemoryPolicy))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// policyInput は、宣言の対象となるレジスタまたはメモリの範囲を表す構造体
+type policyInput struct {
+	register  string // レジスタ名 (メモリの場合は空文字列)
+	low, high int    // メモリのアドレスの範囲 (両端を含む)
+}
+
+func (in policyInput) String() string {
+	if in.register != "" {
+		return in.register
+	}
+	return in.addressRange().String()
+}
+
+// addressRange は、メモリの入力のアドレスの範囲を返します。
+func (in policyInput) addressRange() AddressRange {
+	return AddressRange{Low: in.low, High: in.high}
+}
+
+// eachAddress は、メモリの入力の範囲の各アドレスについて f を呼び出します。
+// 範囲のアドレスの数が maxInitRange を超える場合は、keyword の宣言のエラーを返します。
+func (in policyInput) eachAddress(keyword string, f func(addr int)) error {
+	// high - low が桁あふれする場合も負になる
+	if size := in.high - in.low; size < 0 || size >= maxInitRange {
+		return fmt.Errorf("%s is too large for %s (at most %d addresses)", in, keyword, maxInitRange)
+	}
+	// addr++ が桁あふれしないよう、high で止めてから増やす
+	for addr := in.low; ; addr++ {
+		f(addr)
+		if addr == in.high {
+			return nil
+		}
+	}
+}
+
+// parsePolicyInput は、x、mem[4]、mem[0..15] のいずれかの形式の入力を読み取ります。
+func parsePolicyInput(item string) (policyInput, error) {
+	if strings.HasPrefix(item, "mem[") && strings.HasSuffix(item, "]") {
+		inner := strings.TrimSuffix(strings.TrimPrefix(item, "mem["), "]")
+		lowText, highText, isRange := strings.Cut(inner, "..")
+		low, err := strconv.Atoi(strings.TrimSpace(lowText))
+		if err != nil {
+			return policyInput{}, fmt.Errorf("invalid memory address in %q", item)
+		}
+		high := low
+		if isRange {
+			high, err = strconv.Atoi(strings.TrimSpace(highText))
+			if err != nil {
+				return policyInput{}, fmt.Errorf("invalid memory address in %q", item)
+			}
+		}
+		if high < low {
+			return policyInput{}, fmt.Errorf("empty memory range %q", item)
+		}
+		return policyInput{low: low, high: high}, nil
+	}
+	if !isIdentifier(item) {
+		return policyInput{}, fmt.Errorf("invalid input %q (expected a register, mem[addr] or mem[low..high])", item)
+	}
+	return policyInput{register: item}, nil
+}
+
+// isIdentifier は、token がレジスタ名として使える識別子かどうかを返します。
+func isIdentifier(token string) bool {
+	if len(token) == 0 {
+		return false
+	}
+	for i, r := range token {
+		if i == 0 {
+			// 先頭はアルファベットまたはアンダースコア
+			if !unicode.IsLetter(r) && r != '_' {
+				return false
+			}
+		} else {
+			// それ以降はアルファベット、数字、またはアンダースコア
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// formatAddressRanges は、範囲の一覧を mem[low..high] の形式で返します。
+func formatAddressRanges(ranges []AddressRange) string {
+	items := make([]string, len(ranges))
+	for i, r := range ranges {
+		items[i] = r.String()
+	}
+	return strings.Join(items, ", ")
+}
+
+// appendUnique は、list に含まれていない場合だけ item を追加します。
+func appendUnique[T comparable](list []T, item T) []T {
+	if slices.Contains(list, item) {
+		return list
+	}
+	return append(list, item)
+}
+
+// addRange は、アドレス順に並んだ重ならない範囲に r を加えます。重なるか隣接する範囲は一つにまとめます。
+func addRange(ranges []AddressRange, r AddressRange) []AddressRange {
+	i := sort.Search(len(ranges), func(k int) bool {
+		return ranges[k].High >= r.Low || (r.Low != math.MinInt && ranges[k].High == r.Low-1)
+	})
+	j := i
+	for j < len(ranges) && (ranges[j].Low <= r.High || (r.High != math.MaxInt && ranges[j].Low == r.High+1)) {
+		r.Low = min(r.Low, ranges[j].Low)
+		r.High = max(r.High, ranges[j].High)
+		j++
+	}
+	return slices.Replace(ranges, i, j, r)
+}
+
+// overlap は、アドレス順に並んだ重ならない範囲と r の両方に含まれる最小のアドレスを返します。
+func overlap(ranges []AddressRange, r AddressRange) (int, bool) {
+	i := sort.Search(len(ranges), func(k int) bool { return ranges[k].High >= r.Low })
+	if i < len(ranges) && ranges[i].Low <= r.High {
+		return max(ranges[i].Low, r.Low), true
+	}
+	return 0, false
+}
@@ -0,0 +1,218 @@
+package executor_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/taisii/go-project/assembler"
+	"github.com/taisii/go-project/executor"
+)
+
+func TestParsePolicy(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Source   string
+		Expected *executor.PolicyFile
+	}{
+		{
+			Name:   "Public and secret inputs",
+			Source: "% Spectre v1\npublic idx, size\npublic mem[0..2]\nsecret k, mem[100]\n",
+			Expected: &executor.PolicyFile{
+				Policy:          executor.Policy{PublicRegisters: []string{"idx", "size"}, PublicMemory: []executor.AddressRange{{Low: 0, High: 2}}},
+				SecretRegisters: []string{"k"},
+				SecretMemory:    []executor.AddressRange{{Low: 100, High: 100}},
+				Registers:       map[string]interface{}{},
+				Memory:          map[int]interface{}{},
+			},
+		},
+		{
+			Name:   "Initial values and symbolic inputs",
+			Source: "init a1 = 100\ninit mem[4..5] = -1\nsymbolic y, mem[16]   % input\nmemory zero\n",
+			Expected: &executor.PolicyFile{
+				Registers:    map[string]interface{}{"a1": 100, "y": sym("y")},
+				Memory:       map[int]interface{}{4: -1, 5: -1, 16: sym("mem[16]")},
+				MemoryPolicy: executor.MemoryZero,
+			},
+		},
+		{
+			Name:   "Duplicate declarations",
+			Source: "public x\npublic x, mem[1]\npublic mem[1]\n",
+			Expected: &executor.PolicyFile{
+				Policy:    executor.Policy{PublicRegisters: []string{"x"}, PublicMemory: []executor.AddressRange{{Low: 1, High: 1}}},
+				Registers: map[string]interface{}{},
+				Memory:    map[int]interface{}{},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			policy, err := executor.ParsePolicy("test.policy", strings.NewReader(testCase.Source))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(policy, testCase.Expected) {
+				t.Errorf("expected %+v, got %+v", testCase.Expected, policy)
+			}
+		})
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Source   string
+		Expected string
+	}{
+		{Name: "Unknown declaration", Source: "public x\n  private y\n", Expected: "test.policy:2:3: unknown policy declaration \"private\""},
+		{Name: "Public and secret", Source: "secret mem[3]\npublic mem[0..7]\n", Expected: "test.policy:2:1: mem[3] is declared both public and secret"},
+		{Name: "Empty range", Source: "public mem[5..1]\n", Expected: "empty memory range"},
+		{Name: "Invalid register", Source: "public 1x\n", Expected: "invalid input \"1x\""},
+		{Name: "Missing value", Source: "init x\n", Expected: "init requires the form"},
+		{Name: "Non-integer value", Source: "init x = y\n", Expected: "initial value of x must be an integer"},
+		{Name: "Unknown memory policy", Source: "memory random\n", Expected: "unknown memory policy"},
+		{Name: "No inputs", Source: "secret\n", Expected: "secret requires at least one input"},
+		{Name: "Large init range", Source: "init mem[0..200000] = 0\n", Expected: "mem[0..200000] is too large for init"},
+		{Name: "Large symbolic range", Source: "symbolic mem[1..9223372036854775807]\n", Expected: "mem[1..9223372036854775807] is too large for symbolic"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			_, err := executor.ParsePolicy("test.policy", strings.NewReader(testCase.Source))
+			if err == nil {
+				t.Fatalf("expected error containing %q", testCase.Expected)
+			}
+			var parseErr *assembler.ParseError
+			if !errors.As(err, &parseErr) {
+				t.Errorf("expected *assembler.ParseError, got %T", err)
+			}
+			if !strings.Contains(err.Error(), testCase.Expected) {
+				t.Errorf("expected error containing %q, got %q", testCase.Expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestParsePolicyMemoryRanges(t *testing.T) {
+	// 公開と秘密のメモリは範囲のまま保持するため、大きな範囲も展開しない
+	source := "public mem[10..20], mem[0..9223372036854775807]\n"
+	policy, err := executor.ParsePolicy("test.policy", strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []executor.AddressRange{{Low: 0, High: 9223372036854775807}}
+	if !reflect.DeepEqual(policy.Policy.PublicMemory, expected) {
+		t.Errorf("expected %v, got %v", expected, policy.Policy.PublicMemory)
+	}
+	if !policy.Policy.IsPublic("mem[123456789]") {
+		t.Errorf("expected mem[123456789] to be public")
+	}
+
+	// 隣接する範囲はまとめ、間の空いた範囲は別に保持する
+	policy, err = executor.ParsePolicy("test.policy", strings.NewReader("secret mem[4..7], mem[0..3], mem[10]\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = []executor.AddressRange{{Low: 0, High: 7}, {Low: 10, High: 10}}
+	if !reflect.DeepEqual(policy.SecretMemory, expected) {
+		t.Errorf("expected %v, got %v", expected, policy.SecretMemory)
+	}
+	if policy.Policy.IsPublic("mem[8]") || policy.Policy.IsPublic("k") {
+		t.Errorf("expected undeclared inputs to be secret")
+	}
+}
+
+func TestParsePolicyDirectives(t *testing.T) {
+	source := "%! public idx\n    beqz idx, End   %! init a1 = 100\n% public k\n    load v, a1 + idx\nEnd:\n"
+	policy, err := executor.ParsePolicyDirectives("test.muasm", strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(policy.Policy.PublicRegisters, []string{"idx"}) {
+		t.Errorf("expected public registers [idx], got %v", policy.Policy.PublicRegisters)
+	}
+	if !reflect.DeepEqual(policy.Registers, map[string]interface{}{"a1": 100}) {
+		t.Errorf("expected registers map[a1:100], got %v", policy.Registers)
+	}
+
+	_, err = executor.ParsePolicyDirectives("test.muasm", strings.NewReader("skip\n  %! public\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "test.muasm:2:6: ") {
+		t.Errorf("expected error at test.muasm:2:6, got %v", err)
+	}
+}
+
+func TestLoadPolicyFile(t *testing.T) {
+	dir := t.TempDir()
+	asmPath := filepath.Join(dir, "v1.muasm")
+	program := "%! public idx, size\n%! init a1 = 100\n%! init a2 = 200\n" +
+		"x <- idx < size\nbeqz x, End\nload v, a1 + idx\nload w, a2 + v\nEnd:\n"
+	if err := os.WriteFile(asmPath, []byte(program), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// サイドカーがない場合はプログラム内の宣言だけを使う
+	policy, err := executor.LoadPolicyFile(asmPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if policy.MemoryPolicy != "" {
+		t.Errorf("expected no memory policy, got %q", policy.MemoryPolicy)
+	}
+
+	asm, err := assembler.ParseAsm(strings.NewReader(program))
+	if err != nil {
+		t.Fatalf("failed to parse program: %v", err)
+	}
+	result, err := executor.CheckSNI(asm, policy.Policy, policy.Configuration(), 100, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Secure {
+		t.Errorf("expected a leak with public idx and size")
+	}
+
+	// サイドカーで追加した宣言はプログラム内の宣言に加わる
+	sidecar := "public mem[0..1000]\nmemory symbolic\n"
+	if err := os.WriteFile(filepath.Join(dir, "v1.policy"), []byte(sidecar), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err = executor.LoadPolicyFile(asmPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if policy.MemoryPolicy != executor.MemorySymbolic || !reflect.DeepEqual(policy.Policy.PublicMemory, []executor.AddressRange{{Low: 0, High: 1000}}) {
+		t.Errorf("expected the sidecar declarations, got %s", policy)
+	}
+	if !reflect.DeepEqual(policy.Policy.PublicRegisters, []string{"idx", "size"}) {
+		t.Errorf("expected public registers [idx size], got %v", policy.Policy.PublicRegisters)
+	}
+
+	if _, err := executor.LoadPolicyFile(filepath.Join(dir, "missing.muasm")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing program to be reported, got %v", err)
+	}
+}
+
+func TestPolicyFileString(t *testing.T) {
+	source := "public x, y\npublic mem[0..3], mem[8]\nsecret k\ninit a = 1\nsymbolic b, mem[16]\ninit mem[20] = 7\nmemory zero\n"
+	policy, err := executor.ParsePolicy("", strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "public x, y\npublic mem[0..3], mem[8]\nsecret k\ninit a = 1\nsymbolic b\nsymbolic mem[16]\ninit mem[20] = 7\nmemory zero\n"
+	if policy.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, policy.String())
+	}
+
+	// 出力はもう一度読み込める
+	reparsed, err := executor.ParsePolicy("", strings.NewReader(policy.String()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(reparsed, policy) {
+		t.Errorf("expected %+v, got %+v", policy, reparsed)
+	}
+}
@@ -0,0 +1,234 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// secondRunSuffix は、二つ目の実行の秘密のシンボル名に付ける接尾辞です。
+const secondRunSuffix = "'"
+
+// selfComposition は、一つ目の実行と、秘密の入力の名前を変えた二つ目の実行を組み合わせた検査の条件です。
+type selfComposition struct {
+	a, b         *Configuration // b は renameSecrets した二つ目の実行
+	specA, specB []Observation
+	constraints  []interface{}
+}
+
+// newSelfComposition は、a と b の実行パスについて、両方のパス条件が成り立ち、非投機的な観測がすべて一致し、
+// 投機的な観測のいずれかが異なるという条件を作ります。二つ目の実行の秘密の入力は a と独立で、公開入力は a と共有します。
+// 非投機的な観測の列の形が異なる場合や、投機的な観測が異なり得ない場合はエラーを返します。
+func newSelfComposition(a, b *Configuration, policy Policy) (*selfComposition, error) {
+	nonSpecA, specA := SplitTrace(a.Trace)
+	renamed := renameSecrets(b, policy)
+	nonSpecB, specB := SplitTrace(renamed.Trace)
+	if len(nonSpecA) != len(nonSpecB) {
+		return nil, fmt.Errorf("paths differ without speculation: %d and %d non-speculative observations", len(nonSpecA), len(nonSpecB))
+	}
+
+	constraints := []interface{}{a.Trace.PathCond, renamed.Trace.PathCond}
+	for i := range nonSpecA {
+		if !sameObservationKind(nonSpecA[i], nonSpecB[i]) {
+			return nil, fmt.Errorf("paths differ without speculation at observation %d (pc %d and %d)", i, nonSpecA[i].PC, nonSpecB[i].PC)
+		}
+		for _, eq := range observationsEqual(nonSpecA[i], nonSpecB[i]) {
+			// 公開入力だけに依存する観測は常に等しい
+			if eq = Simplify(eq); eq != 1 {
+				constraints = append(constraints, eq)
+			}
+		}
+	}
+
+	// 投機的な観測のどれかが異なる (観測の種類や数が異なる場合は条件なしで異なる)
+	structurallyDifferent := len(specA) != len(specB)
+	var differences []interface{}
+	for i := 0; i < len(specA) && i < len(specB); i++ {
+		if !sameObservationKind(specA[i], specB[i]) {
+			structurallyDifferent = true
+			break
+		}
+		for _, eq := range observationsEqual(specA[i], specB[i]) {
+			if difference := Simplify(SymbolicExpr{Op: "!", Operands: []interface{}{eq}}); difference != 0 {
+				differences = append(differences, difference)
+			}
+		}
+	}
+	if !structurallyDifferent {
+		if len(differences) == 0 {
+			return nil, fmt.Errorf("no speculative observation can differ")
+		}
+		constraints = append(constraints, SymbolicExpr{Op: "||", Operands: differences})
+	}
+	return &selfComposition{a: a, b: renamed, specA: specA, specB: specB, constraints: constraints}, nil
+}
+
+// firstDifference は、model のもとで最初に異なる投機的な観測の位置を返します。
+// 共通の長さの範囲で異ならない場合は、短い方の観測の数を返します (両方の長さが同じ場合は、異なる観測がありません)。
+func (s *selfComposition) firstDifference(model Model) int {
+	for i := 0; i < len(s.specA) && i < len(s.specB); i++ {
+		if !sameObservationKind(s.specA[i], s.specB[i]) || !observationHolds(observationsEqual(s.specA[i], s.specB[i]), model) {
+			return i
+		}
+	}
+	return min(len(s.specA), len(s.specB))
+}
+
+// differingObservation は、model のもとで最初に異なる投機的な観測を、観測がある方の実行から返します。
+// model のもとで異なる観測がない場合は false を返します。
+func (s *selfComposition) differingObservation(model Model) (Observation, bool) {
+	index := s.firstDifference(model)
+	if index == len(s.specA) && index == len(s.specB) {
+		return Observation{}, false
+	}
+	if obs := s.difference(index, 0); obs.Type != "" {
+		return obs, true
+	}
+	return s.difference(index, 1), true
+}
+
+// difference は、run 番目 (0 または 1) の実行の index 番目の投機的な観測を、元のシンボル名で返します。
+// 観測がない場合はゼロ値を返します。
+func (s *selfComposition) difference(index int, run int) Observation {
+	if run == 0 {
+		if index < len(s.specA) {
+			return s.specA[index]
+		}
+		return Observation{}
+	}
+	if index < len(s.specB) {
+		return renameObservation(s.specB[index], Policy{}, true)
+	}
+	return Observation{}
+}
+
+// sameObservationKind は、二つの観測が同じ命令の同じ種類の観測かどうかを返します。
+// 分岐の観測は、進んだ方向 (== または !=) も比較します。
+func sameObservationKind(a, b Observation) bool {
+	return a.PC == b.PC && a.Type == b.Type && branchDirection(a) == branchDirection(b) &&
+		(a.Address == nil) == (b.Address == nil) && (a.Value == nil) == (b.Value == nil)
+}
+
+// branchDirection は、分岐の観測が記録した方向を返します。分岐以外の観測では空文字列を返します。
+func branchDirection(obs Observation) string {
+	if expr, ok := obs.Value.(SymbolicExpr); ok && obs.Type == ObsTypePC {
+		return expr.Op
+	}
+	return ""
+}
+
+// observationsEqual は、二つの観測の観測できる部分が等しいという条件を返します。
+// ロードとストアはアドレスだけを比較します (値は攻撃者から見えない)。
+// 分岐の観測は方向だけを観測するため、条件を返しません (方向の条件はパス条件に含まれる)。
+func observationsEqual(a, b Observation) []interface{} {
+	switch a.Type {
+	case ObsTypeLoad, ObsTypeStore:
+		if a.Address != nil {
+			return []interface{}{SymbolicExpr{Op: "==", Operands: []interface{}{a.Address, b.Address}}}
+		}
+	}
+	return nil
+}
+
+// observationHolds は、model のもとで条件がすべて成り立つかどうかを返します。
+func observationHolds(eqs []interface{}, model Model) bool {
+	for _, eq := range eqs {
+		if value, ok := evalModel(eq, model); !ok || value == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// evalModel は、シンボルに model の値を代入した式の値を返します。値が決まらない場合は false を返します。
+func evalModel(value interface{}, model Model) (int, bool) {
+	names := make(map[string]bool)
+	collectSolverSymbols(value, names)
+	domains := make(map[string]interval, len(names))
+	for name := range names {
+		v := model[name]
+		domains[name] = interval{v, v}
+	}
+	result := evalInterval(value, domains)
+	if result.empty() || !result.singleton() {
+		return 0, false
+	}
+	return result.lo, true
+}
+
+// renameSecrets は、公開されていないシンボルに secondRunSuffix を付けた conf のトレースを返します。
+func renameSecrets(conf *Configuration, policy Policy) *Configuration {
+	renamed := &Configuration{
+		Registers: make(map[string]interface{}, len(conf.Registers)),
+		Memory:    make(map[int]interface{}, len(conf.Memory)),
+	}
+	for name, value := range conf.Registers {
+		renamed.Registers[name] = renameSymbols(value, policy)
+	}
+	for addr, value := range conf.Memory {
+		renamed.Memory[addr] = renameSymbols(value, policy)
+	}
+	renamed.Trace.PathCond, _ = renameSymbols(conf.Trace.PathCond, policy).(SymbolicExpr)
+	for _, obs := range conf.Trace.Observations {
+		renamed.Trace.Observations = append(renamed.Trace.Observations, renameObservation(obs, policy, false))
+	}
+	return renamed
+}
+
+// renameObservation は、観測のアドレスと値のシンボル名を変換します。restore が true の場合は接尾辞を取り除きます。
+func renameObservation(obs Observation, policy Policy, restore bool) Observation {
+	rename := func(value interface{}) interface{} {
+		if restore {
+			return restoreSymbols(value)
+		}
+		return renameSymbols(value, policy)
+	}
+	renamed := obs
+	if obs.Address != nil {
+		renamed.Address = rename(obs.Address)
+	}
+	if obs.Value != nil {
+		renamed.Value = rename(obs.Value)
+	}
+	return renamed
+}
+
+// renameSymbols は、式の中の公開されていないシンボルに secondRunSuffix を付けます。
+func renameSymbols(value interface{}, policy Policy) interface{} {
+	return mapSymbols(value, func(name string) string {
+		if policy.IsPublic(name) {
+			return name
+		}
+		return name + secondRunSuffix
+	})
+}
+
+// restoreSymbols は、renameSymbols で付けた接尾辞を取り除きます。
+func restoreSymbols(value interface{}) interface{} {
+	return mapSymbols(value, func(name string) string {
+		return strings.TrimSuffix(name, secondRunSuffix)
+	})
+}
+
+// mapSymbols は、式の中の symbol ノードの名前を f で置き換えた式を返します。
+func mapSymbols(value interface{}, f func(string) string) interface{} {
+	switch v := value.(type) {
+	case *SymbolicExpr:
+		if v == nil {
+			return v
+		}
+		mapped := mapSymbols(*v, f).(SymbolicExpr)
+		return &mapped
+	case SymbolicExpr:
+		if v.Op == "symbol" && len(v.Operands) == 1 {
+			if name, ok := v.Operands[0].(string); ok {
+				return SymbolicExpr{Op: "symbol", Operands: []interface{}{f(name)}}
+			}
+		}
+		operands := make([]interface{}, len(v.Operands))
+		for i, operand := range v.Operands {
+			operands[i] = mapSymbols(operand, f)
+		}
+		return SymbolicExpr{Op: v.Op, Operands: operands}
+	}
+	return value
+}
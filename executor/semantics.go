@@ -8,18 +8,24 @@ import (
 
 // Step executes a single instruction
 func Step(instruction assembler.OpCode, conf *Configuration) ([]*Configuration, error) {
+	stmt, err := DecodeInstruction(instruction)
+	if err != nil {
+		return nil, err
+	}
+	return step(stmt, conf)
+}
+
+// step executes a single decoded instruction.
+func step(instruction assembler.Stmt, conf *Configuration) ([]*Configuration, error) {
 	copiedConf := copyConfiguration(*conf)
 	var traceEvent Observation    // トレースイベントを初期化
 	traceEvent.PC = copiedConf.PC // 現在のプログラムカウンタを設定
 
-	switch instruction.Mnemonic {
-	case "mov":
+	switch inst := instruction.(type) {
+	case assembler.Mov:
 		// mov dest, src
-		if len(instruction.Operands) != 2 {
-			return nil, fmt.Errorf("mov requires 2 operands, got %d", len(instruction.Operands))
-		}
-		dest := instruction.Operands[0]
-		srcValue, err := evalExpr(instruction.Operands[1], &copiedConf)
+		dest := inst.Dest.Name
+		srcValue, err := evalAST(inst.Src, &copiedConf)
 		if err != nil {
 			return nil, err
 		}
@@ -34,24 +40,60 @@ func Step(instruction assembler.OpCode, conf *Configuration) ([]*Configuration,
 
 		return []*Configuration{&copiedConf}, nil
 
-	case "add":
-		// add dest, src1, src2
-		if len(instruction.Operands) != 3 {
-			return nil, fmt.Errorf("add requires 3 operands, got %d", len(instruction.Operands))
+	case assembler.Assign:
+		// dest <- expr
+		value, err := evalAST(inst.Value, &copiedConf)
+		if err != nil {
+			return nil, err
+		}
+		copiedConf.Registers[inst.Dest.Name] = value
+		copiedConf.PC++
+
+		// Spectector のセマンティクスに従い、レジスタへの代入は観測を生まない
+		return []*Configuration{&copiedConf}, nil
+
+	case assembler.CondAssign:
+		// cmov cond, dest <- expr
+		cond, err := evalAST(inst.Cond, &copiedConf)
+		if err != nil {
+			return nil, err
 		}
-		dest := instruction.Operands[0]
-		src1, err := evalExpr(instruction.Operands[1], &copiedConf)
+		assigned, err := evalAST(inst.Value, &copiedConf)
+		if err != nil {
+			return nil, err
+		}
+		current, err := evalAST(inst.Dest, &copiedConf)
+		if err != nil {
+			return nil, err
+		}
+		// 条件がシンボリックな場合は ite 式になる (条件が具体値ならどちらかを選ぶ)
+		value, err := applyOp("ite", []interface{}{cond, assigned, current})
+		if err != nil {
+			return nil, err
+		}
+		copiedConf.Registers[inst.Dest.Name] = value
+		copiedConf.PC++
+
+		// 条件付き代入も分岐しないため観測を生まない
+		return []*Configuration{&copiedConf}, nil
+
+	case assembler.Skip:
+		// skip
+		copiedConf.PC++
+		return []*Configuration{&copiedConf}, nil
+
+	case assembler.Add:
+		// add dest, src1, src2
+		dest := inst.Dest.Name
+		src1, err := evalAST(inst.Left, &copiedConf)
 		if err != nil {
 			return nil, err
 		}
-		src2, err := evalExpr(instruction.Operands[2], &copiedConf)
+		src2, err := evalAST(inst.Right, &copiedConf)
 		if err != nil {
 			return nil, err
 		}
-		result, err := evalExpr(SymbolicExpr{
-			Op:       "+",
-			Operands: []interface{}{src1, src2},
-		}, &copiedConf)
+		result, err := applyOp("+", []interface{}{src1, src2})
 		if err != nil {
 			return nil, err
 		}
@@ -66,16 +108,17 @@ func Step(instruction assembler.OpCode, conf *Configuration) ([]*Configuration,
 
 		return []*Configuration{&copiedConf}, nil
 
-	case "beqz":
+	case assembler.Beqz:
 		// beqz reg, target
-		if len(instruction.Operands) != 2 {
-			return nil, fmt.Errorf("beqz requires 2 operands, got %d", len(instruction.Operands))
+		target, err := evalAST(inst.Target, &copiedConf)
+		if err != nil {
+			return nil, err
 		}
-		target, err := evalExpr(instruction.Operands[1], &copiedConf)
+		targetPC, err := jumpAddress(target)
 		if err != nil {
 			return nil, err
 		}
-		reg, err := evalExpr(instruction.Operands[0], &copiedConf)
+		reg, err := evalAST(inst.Cond, &copiedConf)
 		if err != nil {
 			return nil, err
 		}
@@ -102,7 +145,7 @@ func Step(instruction assembler.OpCode, conf *Configuration) ([]*Configuration,
 			// Concrete condition
 			if condValue == 0 {
 				// True branch
-				copiedConf.PC = int(target.(int))
+				copiedConf.PC = targetPC
 				copiedConf.Trace.PathCond = updatePathCond(copiedConf.Trace.PathCond, "==", reg)
 				copiedConf.Trace.Observations = append(copiedConf.Trace.Observations, traceEventTrue)
 				return []*Configuration{&copiedConf}, nil
@@ -123,7 +166,7 @@ func Step(instruction assembler.OpCode, conf *Configuration) ([]*Configuration,
 			confFalse.Registers = copyRegisters(copiedConf.Registers)
 
 			// True branch
-			confTrue.PC = int(target.(int))
+			confTrue.PC = targetPC
 			confTrue.Trace.PathCond = updatePathCond(copiedConf.Trace.PathCond, "==", reg)
 			confTrue.Trace.Observations = append(confTrue.Trace.Observations, traceEventTrue)
 
@@ -138,31 +181,20 @@ func Step(instruction assembler.OpCode, conf *Configuration) ([]*Configuration,
 			return nil, fmt.Errorf("unexpected type for condition: %T", condValue)
 		}
 
-	case "load":
+	case assembler.Load:
 		// load dest, addr
-		if len(instruction.Operands) != 2 {
-			return nil, fmt.Errorf("load requires 2 operands, got %d", len(instruction.Operands))
-		}
-		dest := instruction.Operands[0]
-		addrExpr, err := ParseSymbolicExpr(instruction.Operands[1])
-		if err != nil {
-			return nil, err
-		}
+		dest := inst.Dest.Name
 
 		// アドレス式を評価
-		addrValue, err := evalExpr(*addrExpr, &copiedConf)
+		addrValue, err := evalAST(inst.Addr, &copiedConf)
 		if err != nil {
 			return nil, err
 		}
 
-		// メモリから値を取得
-		address, ok := addrValue.(int)
-		if !ok {
-			return nil, fmt.Errorf("address must be an integer, got %T", addrValue)
-		}
-		value, exists := copiedConf.Memory[address]
-		if !exists {
-			return nil, fmt.Errorf("memory address %d not found", address)
+		// メモリから値を取得 (アドレスがシンボリックな場合は ite 式になる)
+		value, err := readMemory(&copiedConf, addrValue)
+		if err != nil {
+			return nil, err
 		}
 
 		// 値をレジスタに保存
@@ -171,40 +203,27 @@ func Step(instruction assembler.OpCode, conf *Configuration) ([]*Configuration,
 
 		// トレースイベントを追加
 		traceEvent.Type = ObsTypeLoad
-		traceEvent.Address = address
+		traceEvent.Address = addrValue
 		traceEvent.Value = value
 		copiedConf.Trace.Observations = append(copiedConf.Trace.Observations, traceEvent)
 
 		return []*Configuration{&copiedConf}, nil
 
-	case "store":
+	case assembler.Store:
 		// store value, addr
-		if len(instruction.Operands) != 2 {
-			return nil, fmt.Errorf("store requires 2 operands, got %d", len(instruction.Operands))
-		}
-		valueExpr := instruction.Operands[0]
-		addressExpression, err := ParseSymbolicExpr(instruction.Operands[1])
-		if err != nil {
-			return nil, err
-		}
 
 		// 値とアドレスを評価
-		value, err := evalExpr(valueExpr, &copiedConf)
+		value, err := evalAST(inst.Src, &copiedConf)
 		if err != nil {
 			return nil, err
 		}
-		addrValue, err := evalExpr(*addressExpression, &copiedConf)
+		addrValue, err := evalAST(inst.Addr, &copiedConf)
 		if err != nil {
 			return nil, err
 		}
 
-		address, ok := addrValue.(int)
-		if !ok {
-			return nil, fmt.Errorf("address must be an integer, got %T", addrValue)
-		}
-
 		// メモリを更新
-		copiedConf.Memory[address] = value
+		writeMemory(&copiedConf, addrValue, value)
 		copiedConf.PC++
 
 		// トレースイベントを追加
@@ -215,16 +234,17 @@ func Step(instruction assembler.OpCode, conf *Configuration) ([]*Configuration,
 
 		return []*Configuration{&copiedConf}, nil
 
-	case "jmp":
+	case assembler.Jmp:
 		// jmp target
-		if len(instruction.Operands) != 1 {
-			return nil, fmt.Errorf("jmp requires 1 operand, got %d", len(instruction.Operands))
+		target, err := evalAST(inst.Target, &copiedConf)
+		if err != nil {
+			return nil, err
 		}
-		target, err := evalExpr(instruction.Operands[0], &copiedConf)
+		targetPC, err := jumpAddress(target)
 		if err != nil {
 			return nil, err
 		}
-		copiedConf.PC = int(target.(int))
+		copiedConf.PC = targetPC
 
 		// トレースイベントを追加
 		traceEvent.Type = ObsTypePC
@@ -233,25 +253,47 @@ func Step(instruction assembler.OpCode, conf *Configuration) ([]*Configuration,
 
 		return []*Configuration{&copiedConf}, nil
 
+	case assembler.Spbarr:
+		// spbarr
+		// 何もしない (投機中はモデルが Successor.Barrier を設定し、SpecExecute がロールバックする)
+		copiedConf.PC++
+		return []*Configuration{&copiedConf}, nil
+
 	default:
-		return nil, fmt.Errorf("unsupported instruction: %s", instruction.Mnemonic)
+		return nil, fmt.Errorf("unsupported instruction: %s", instruction)
 	}
 }
 
+// updatePathCond は、パス条件に reg op 0 を追加し、正規化した条件を返します。
+// 追加する条件が常に真の場合、パス条件は変わりません。
 func updatePathCond(currentCond SymbolicExpr, op string, reg interface{}) SymbolicExpr {
-	newCond := SymbolicExpr{
+	newCond := Simplify(SymbolicExpr{
 		Op:       op,
 		Operands: []interface{}{reg, 0},
-	}
+	})
 
 	if currentCond.Op == "" && len(currentCond.Operands) == 0 {
 		// 現在の条件が空の場合、新しい条件をそのまま返す
-		return newCond
+		return pathCondExpr(newCond)
 	}
 
 	// 現在の条件がある場合、新しい条件と連結
-	return SymbolicExpr{
+	return pathCondExpr(Simplify(SymbolicExpr{
 		Op:       "&&",
 		Operands: []interface{}{currentCond, newCond},
+	}))
+}
+
+// pathCondExpr は、正規化した条件を PathCond に格納できる形にします。
+// 常に真の条件は空の SymbolicExpr に、常に偽の条件は値 0 のノードになります。
+func pathCondExpr(cond interface{}) SymbolicExpr {
+	switch c := cond.(type) {
+	case SymbolicExpr:
+		return c
+	case int:
+		if c != 0 {
+			return SymbolicExpr{}
+		}
 	}
+	return SymbolicExpr{Op: "value", Operands: []interface{}{cond}}
 }
@@ -10,22 +10,35 @@ import (
 func AlwaysMispredictStep(
 	inst assembler.OpCode,
 	currentConf *Configuration,
+) ([]*Configuration, bool, error) {
+	stmt, err := DecodeInstruction(inst)
+	if err != nil {
+		return nil, false, err
+	}
+	return alwaysMispredictStep(stmt, currentConf)
+}
+
+// alwaysMispredictStep is AlwaysMispredictStep for a decoded instruction.
+func alwaysMispredictStep(
+	inst assembler.Stmt,
+	currentConf *Configuration,
 ) ([]*Configuration, bool, error) {
 	copiedConf := copyConfiguration(*currentConf)
 	newConfs := []*Configuration{}
 	isSpeculative := false // 投機実行が必要かどうかを示すフラグ
 
-	switch inst.Mnemonic {
-	case "beqz":
+	switch beqz := inst.(type) {
+	case assembler.Beqz:
 		// beqz reg, target
-		if len(inst.Operands) != 2 {
-			return nil, false, fmt.Errorf("beqz requires 2 operands, got %d", len(inst.Operands))
+		target, err := evalAST(beqz.Target, &copiedConf)
+		if err != nil {
+			return nil, false, err
 		}
-		target, err := evalExpr(inst.Operands[1], &copiedConf)
+		targetPC, err := jumpAddress(target)
 		if err != nil {
 			return nil, false, err
 		}
-		reg, err := evalExpr(inst.Operands[0], &copiedConf)
+		reg, err := evalAST(beqz.Cond, &copiedConf)
 		if err != nil {
 			return nil, false, err
 		}
@@ -61,7 +74,7 @@ func AlwaysMispredictStep(
 			} else {
 				// Condition false,
 				isSpeculative = true
-				newConf.PC = int(target.(int))
+				newConf.PC = targetPC
 				newConf.Trace.PathCond = updatePathCond(newConf.Trace.PathCond, "!=", reg)
 				newConf.Trace.Observations = append(newConf.Trace.Observations, traceEventTrue) // 誤ってtrueのほうに進むからトレースはtrueのもの
 			}
@@ -79,7 +92,7 @@ func AlwaysMispredictStep(
 			newConfTrue.Trace.Observations = append(newConfTrue.Trace.Observations, traceEventFalse) // 誤ってfalseのほうに進むからトレースはfalseのもの
 
 			// False branch (condition is false, mispredicts to True)
-			newConfFalse.PC = int(target.(int))
+			newConfFalse.PC = targetPC
 			newConfFalse.Trace.PathCond = updatePathCond(copiedConf.Trace.PathCond, "!=", reg)
 			newConfFalse.Trace.Observations = append(newConfFalse.Trace.Observations, traceEventTrue) // 誤ってtrueのほうに進むからトレースはtrueのもの
 
@@ -92,7 +105,7 @@ func AlwaysMispredictStep(
 
 	default:
 		// Unsupported instructions are handled with the default step
-		conf, err := Step(inst, &copiedConf)
+		conf, err := step(inst, &copiedConf)
 		if err != nil {
 			return nil, false, err
 		}
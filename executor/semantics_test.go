@@ -395,6 +395,356 @@ func TestStep(t *testing.T) {
 			},
 			ExpectError: true,
 		},
+		{
+			Name: "Move with arithmetic operand",
+			InitialConf: executor.Configuration{
+				PC: 0,
+				Registers: map[string]interface{}{
+					"x": 4,
+				},
+				Memory: map[int]interface{}{},
+			},
+			Instruction: assembler.OpCode{
+				Mnemonic: "mov",
+				Operands: []string{"y", "(x + 2) * 3"},
+			},
+			ExpectedConfigs: []executor.Configuration{
+				{
+					PC: 1,
+					Registers: map[string]interface{}{
+						"x": 4,
+						"y": 18,
+					},
+					Memory: map[int]interface{}{},
+					Trace: executor.Trace{
+						Observations: []executor.Observation{
+							{
+								PC:   0,
+								Type: executor.ObsTypeStore,
+								Address: &executor.SymbolicExpr{
+									Op:       "var",
+									Operands: []interface{}{"y"},
+								},
+								Value: 18,
+							},
+						},
+					},
+				},
+			},
+			ExpectError: false,
+		},
+		{
+			Name: "Assignment with concrete expression",
+			InitialConf: executor.Configuration{
+				PC: 2,
+				Registers: map[string]interface{}{
+					"w": 5,
+					"x": 3,
+				},
+				Memory: map[int]interface{}{},
+			},
+			Instruction: assembler.OpCode{
+				Mnemonic: "<-",
+				Operands: []string{"w", "w+x*2"},
+			},
+			ExpectedConfigs: []executor.Configuration{
+				{
+					PC: 3,
+					Registers: map[string]interface{}{
+						"w": 11,
+						"x": 3,
+					},
+					Memory: map[int]interface{}{},
+				},
+			},
+			ExpectError: false,
+		},
+		{
+			Name: "Assignment with symbolic expression",
+			InitialConf: executor.Configuration{
+				PC:        0,
+				Registers: map[string]interface{}{},
+				Memory:    map[int]interface{}{},
+			},
+			Instruction: assembler.OpCode{
+				Mnemonic: "<-",
+				Operands: []string{"y", "x=0"},
+			},
+			ExpectedConfigs: []executor.Configuration{
+				{
+					PC: 1,
+					Registers: map[string]interface{}{
+						"y": executor.SymbolicExpr{
+							Op: "==",
+							Operands: []interface{}{
+								executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"x"}},
+								0,
+							},
+						},
+					},
+					Memory: map[int]interface{}{},
+				},
+			},
+			ExpectError: false,
+		},
+		{
+			Name: "Conditional assignment with concrete condition",
+			InitialConf: executor.Configuration{
+				PC: 0,
+				Registers: map[string]interface{}{
+					"c": 0,
+					"x": 1,
+				},
+				Memory: map[int]interface{}{},
+			},
+			Instruction: assembler.OpCode{
+				Mnemonic: "cmov",
+				Operands: []string{"c = 0", "x", "x + 4"},
+			},
+			ExpectedConfigs: []executor.Configuration{
+				{
+					PC: 1,
+					Registers: map[string]interface{}{
+						"c": 0,
+						"x": 5,
+					},
+					Memory: map[int]interface{}{},
+				},
+			},
+			ExpectError: false,
+		},
+		{
+			Name: "Conditional assignment with symbolic condition",
+			InitialConf: executor.Configuration{
+				PC: 0,
+				Registers: map[string]interface{}{
+					"x": 1,
+				},
+				Memory: map[int]interface{}{},
+			},
+			Instruction: assembler.OpCode{
+				Mnemonic: "cmov",
+				Operands: []string{"c", "x", "2"},
+			},
+			ExpectedConfigs: []executor.Configuration{
+				{
+					PC: 1,
+					Registers: map[string]interface{}{
+						"x": executor.SymbolicExpr{Op: "ite", Operands: []interface{}{
+							executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"c"}},
+							2,
+							1,
+						}},
+					},
+					Memory: map[int]interface{}{},
+				},
+			},
+			ExpectError: false,
+		},
+		{
+			Name: "Skip",
+			InitialConf: executor.Configuration{
+				PC: 3,
+				Registers: map[string]interface{}{
+					"x": 1,
+				},
+				Memory: map[int]interface{}{},
+			},
+			Instruction: assembler.OpCode{
+				Mnemonic: "skip",
+			},
+			ExpectedConfigs: []executor.Configuration{
+				{
+					PC: 4,
+					Registers: map[string]interface{}{
+						"x": 1,
+					},
+					Memory: map[int]interface{}{},
+				},
+			},
+			ExpectError: false,
+		},
+		{
+			Name: "Load from symbolic address",
+			InitialConf: executor.Configuration{
+				PC:        0,
+				Registers: map[string]interface{}{},
+				Memory: map[int]interface{}{
+					0: 7,
+				},
+			},
+			Instruction: assembler.OpCode{
+				Mnemonic: "load",
+				Operands: []string{"y", "x"},
+			},
+			ExpectedConfigs: []executor.Configuration{
+				{
+					PC: 1,
+					Registers: map[string]interface{}{
+						"y": executor.SymbolicExpr{Op: "ite", Operands: []interface{}{
+							executor.SymbolicExpr{Op: "==", Operands: []interface{}{executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"x"}}, 0}},
+							7,
+							executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"mem[x]"}},
+						}},
+					},
+					Memory: map[int]interface{}{
+						0: 7,
+					},
+					Trace: executor.Trace{
+						Observations: []executor.Observation{
+							{
+								PC:      0,
+								Type:    executor.ObsTypeLoad,
+								Address: executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"x"}},
+								Value: executor.SymbolicExpr{Op: "ite", Operands: []interface{}{
+									executor.SymbolicExpr{Op: "==", Operands: []interface{}{executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"x"}}, 0}},
+									7,
+									executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"mem[x]"}},
+								}},
+							},
+						},
+					},
+				},
+			},
+			ExpectError: false,
+		},
+		{
+			Name: "Store to symbolic address",
+			InitialConf: executor.Configuration{
+				PC: 0,
+				Registers: map[string]interface{}{
+					"v": 5,
+				},
+				Memory: map[int]interface{}{},
+			},
+			Instruction: assembler.OpCode{
+				Mnemonic: "store",
+				Operands: []string{"v", "x+1"},
+			},
+			ExpectedConfigs: []executor.Configuration{
+				{
+					PC: 1,
+					Registers: map[string]interface{}{
+						"v": 5,
+					},
+					Memory: map[int]interface{}{},
+					Writes: []executor.MemoryWrite{
+						{
+							Address: executor.SymbolicExpr{Op: "+", Operands: []interface{}{executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"x"}}, 1}},
+							Value:   5,
+						},
+					},
+					Trace: executor.Trace{
+						Observations: []executor.Observation{
+							{
+								PC:      0,
+								Type:    executor.ObsTypeStore,
+								Address: executor.SymbolicExpr{Op: "+", Operands: []interface{}{executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"x"}}, 1}},
+								Value:   5,
+							},
+						},
+					},
+				},
+			},
+			ExpectError: false,
+		},
+		{
+			Name: "Load from uninitialised memory with strict policy",
+			InitialConf: executor.Configuration{
+				PC:        0,
+				Registers: map[string]interface{}{},
+				Memory:    map[int]interface{}{},
+			},
+			Instruction: assembler.OpCode{
+				Mnemonic: "load",
+				Operands: []string{"y", "3"},
+			},
+			ExpectError: true,
+		},
+		{
+			Name: "Load from uninitialised memory with symbolic policy",
+			InitialConf: executor.Configuration{
+				PC:           0,
+				Registers:    map[string]interface{}{},
+				Memory:       map[int]interface{}{},
+				MemoryPolicy: executor.MemorySymbolic,
+			},
+			Instruction: assembler.OpCode{
+				Mnemonic: "load",
+				Operands: []string{"y", "3"},
+			},
+			ExpectedConfigs: []executor.Configuration{
+				{
+					PC: 1,
+					Registers: map[string]interface{}{
+						"y": executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"mem[3]"}},
+					},
+					Memory: map[int]interface{}{
+						3: executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"mem[3]"}}, // 入力として記録される
+					},
+					Trace: executor.Trace{
+						Observations: []executor.Observation{
+							{PC: 0, Type: executor.ObsTypeLoad, Address: 3, Value: executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"mem[3]"}}},
+						},
+					},
+				},
+			},
+			ExpectError: false,
+		},
+		{
+			Name: "Load from uninitialised memory with zero policy",
+			InitialConf: executor.Configuration{
+				PC:           0,
+				Registers:    map[string]interface{}{},
+				Memory:       map[int]interface{}{},
+				MemoryPolicy: executor.MemoryZero,
+			},
+			Instruction: assembler.OpCode{
+				Mnemonic: "load",
+				Operands: []string{"y", "3"},
+			},
+			ExpectedConfigs: []executor.Configuration{
+				{
+					PC: 1,
+					Registers: map[string]interface{}{
+						"y": 0,
+					},
+					Memory: map[int]interface{}{},
+					Trace: executor.Trace{
+						Observations: []executor.Observation{
+							{PC: 0, Type: executor.ObsTypeLoad, Address: 3, Value: 0},
+						},
+					},
+				},
+			},
+			ExpectError: false,
+		},
+		{
+			Name: "Symbolic jump target error",
+			InitialConf: executor.Configuration{
+				PC:        0,
+				Registers: map[string]interface{}{},
+				Memory:    map[int]interface{}{},
+			},
+			Instruction: assembler.OpCode{
+				Mnemonic: "jmp",
+				Operands: []string{"Loop"},
+			},
+			ExpectError: true,
+		},
+		{
+			Name: "Malformed operand error",
+			InitialConf: executor.Configuration{
+				PC:        0,
+				Registers: map[string]interface{}{},
+				Memory:    map[int]interface{}{},
+			},
+			Instruction: assembler.OpCode{
+				Mnemonic: "mov",
+				Operands: []string{"y", "x +"},
+			},
+			ExpectError: true,
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -422,3 +772,15 @@ func TestStep(t *testing.T) {
 		})
 	}
 }
+
+func TestParseMemoryPolicy(t *testing.T) {
+	for _, name := range []string{"strict", "symbolic", "zero"} {
+		policy, err := executor.ParseMemoryPolicy(name)
+		if err != nil || string(policy) != name {
+			t.Errorf("ParseMemoryPolicy(%q) = %q, %v", name, policy, err)
+		}
+	}
+	if _, err := executor.ParseMemoryPolicy("random"); err == nil {
+		t.Errorf("expected an error for an unknown policy")
+	}
+}
@@ -0,0 +1,190 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/taisii/go-project/assembler"
+)
+
+// SpecSemantics は、SpecExecute で投機する命令の種類を表す型
+type SpecSemantics string
+
+const (
+	SemanticsBranch      SpecSemantics = "branch"       // すべての beqz を誤って予測する (Spectre v1、空の値も同じ)
+	SemanticsStoreBypass SpecSemantics = "store-bypass" // ロードが同じアドレスへの未解決のストアをバイパスする (Spectre v4)
+	SemanticsAll         SpecSemantics = "all"          // 分岐の誤予測とストアバイパスの両方
+)
+
+// DefaultStoreBufferSize は、SpecOptions.StoreBufferSize が 0 の場合に保持する未解決のストアの数です。
+const DefaultStoreBufferSize = 4
+
+// ParseSpecSemantics は、文字列 (branch, store-bypass, all) を SpecSemantics に変換します。
+func ParseSpecSemantics(name string) (SpecSemantics, error) {
+	switch semantics := SpecSemantics(name); semantics {
+	case SemanticsBranch, SemanticsStoreBypass, SemanticsAll:
+		return semantics, nil
+	}
+	return "", fmt.Errorf("unknown speculation semantics %q (expected branch, store-bypass or all)", name)
+}
+
+// Model は、s に対応する SpeculationModel を返します。bufferSize はストアバイパスのストアバッファの大きさです。
+func (s SpecSemantics) Model(bufferSize int) SpeculationModel {
+	switch s {
+	case SemanticsStoreBypass:
+		return StoreBypass{BufferSize: bufferSize}
+	case SemanticsAll:
+		return StoreBypass{BufferSize: bufferSize, Branches: AlwaysMispredict{}}
+	}
+	return AlwaysMispredict{}
+}
+
+// PendingStore は、アドレスがまだ解決していないストアを表す構造体
+// 後続の同じアドレスからのロードは、このストアをバイパスして Value の代わりに Previous を読むことがあります。
+type PendingStore struct {
+	PC          int         // ストア命令のアドレス
+	Address     interface{} // ストア先のアドレス (具体値またはシンボリックな式)
+	Value       interface{} // ストアした値
+	Previous    interface{} // ストア前のメモリの値 (バイパスしたロードが読む古い値)
+	PreviousErr error       // Previous を読めなかった場合のエラー (MemoryStrict での未初期化のメモリなど)。バイパスしたロードが返す
+}
+
+// StoreBypassStep は、ストアバイパスのセマンティクスで命令を一つ実行します。
+// ロードはバイパスできる未解決のストアごとに状態を返し、投機を開始したことを報告します。
+func StoreBypassStep(inst assembler.OpCode, currentConf *Configuration) ([]*Configuration, bool, error) {
+	stmt, err := DecodeInstruction(inst)
+	if err != nil {
+		return nil, false, err
+	}
+	successors, err := StoreBypass{}.Successors(stmt, currentConf, SpecContext{})
+	if err != nil {
+		return nil, false, err
+	}
+	var newConfs []*Configuration
+	isSpeculative := false
+	for _, successor := range successors {
+		newConfs = append(newConfs, successor.Conf)
+		isSpeculative = isSpeculative || successor.Speculative()
+	}
+	return newConfs, isSpeculative, nil
+}
+
+// StoreBypass は、Spectre v4 (投機的ストアバイパス) の投機のモデル
+// ストアは通常どおり実行し、最大 BufferSize 個 (0 の場合は DefaultStoreBufferSize 個) のストアバッファに記録します。
+// 未解決のストアが書き込んだアドレスからのロードは、新しいストアから順に、そのストアの前のメモリの値を投機的に読みます。
+// ストアは投機のウィンドウを使い切った時点で解決するとみなし、SpecExecute はバイパスしたストアを含まない
+// ストアバッファを持つ正しいロードの状態にロールバックします。
+// バイパスするのは、アドレスがロードのアドレスと構造的に等しいストアだけです。
+// 未初期化のメモリへのストアをバイパスするロードは、そのメモリを読むため MemoryStrict ではエラーになります。
+// spbarr はすべての未解決のストアを解決します。その他の命令は Branches (nil の場合は NeverMispredict) で実行します。
+type StoreBypass struct {
+	BufferSize int
+	Branches   SpeculationModel
+}
+
+func (m StoreBypass) Successors(inst assembler.Stmt, currentConf *Configuration, ctx SpecContext) ([]Successor, error) {
+	switch s := inst.(type) {
+	case assembler.Store:
+		return m.store(s, currentConf)
+	case assembler.Load:
+		return m.load(s, currentConf)
+	case assembler.Spbarr:
+		// バリアの後のロードは、それより前のストアをバイパスできない
+		successors, err := NeverMispredict{}.Successors(inst, currentConf, ctx)
+		for _, successor := range successors {
+			successor.Conf.StoreBuffer = nil
+		}
+		return successors, err
+	}
+	if m.Branches == nil {
+		return NeverMispredict{}.Successors(inst, currentConf, ctx)
+	}
+	return m.Branches.Successors(inst, currentConf, ctx)
+}
+
+func (m StoreBypass) store(inst assembler.Store, currentConf *Configuration) ([]Successor, error) {
+	addrValue, err := evalAST(inst.Addr, currentConf)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := evalAST(inst.Src, currentConf)
+	if err != nil {
+		return nil, err
+	}
+	// ストア前の値は、currentConf を変更しないようにコピーから読む
+	// (symbolic のポリシーで記録した初期値は、コピーごとストアを実行して後続の状態に引き継ぐ)
+	// 読めない場合のエラーは、このストアをバイパスしたロードが返す
+	snapshot := copyConfiguration(*currentConf)
+	previous, previousErr := readMemory(&snapshot, addrValue)
+
+	confs, err := step(inst, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+	bufferSize := m.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultStoreBufferSize
+	}
+	successors := make([]Successor, len(confs))
+	for i, conf := range confs {
+		conf.StoreBuffer = append(copyStoreBuffer(currentConf.StoreBuffer), PendingStore{
+			PC:          currentConf.PC,
+			Address:     addrValue,
+			Value:       stored,
+			Previous:    previous,
+			PreviousErr: previousErr,
+		})
+		if len(conf.StoreBuffer) > bufferSize {
+			conf.StoreBuffer = conf.StoreBuffer[len(conf.StoreBuffer)-bufferSize:]
+		}
+		successors[i] = Successor{Conf: conf}
+	}
+	return successors, nil
+}
+
+func (m StoreBypass) load(inst assembler.Load, currentConf *Configuration) ([]Successor, error) {
+	confs, err := step(inst, currentConf)
+	if err != nil {
+		return nil, err
+	}
+	addrValue, err := evalAST(inst.Addr, currentConf)
+	if err != nil {
+		return nil, err
+	}
+
+	dest := inst.Dest.Name
+	correct := confs[0]
+	var remaining []PendingStore
+	var staleConfs []*Configuration
+	// 新しいストアから順にバイパスする
+	for i := len(currentConf.StoreBuffer) - 1; i >= 0; i-- {
+		pending := currentConf.StoreBuffer[i]
+		if !CompareSymbolicExpr(pending.Address, addrValue) {
+			remaining = append([]PendingStore{pending}, remaining...)
+			continue
+		}
+		if pending.PreviousErr != nil {
+			return nil, fmt.Errorf("load at pc %d bypasses the store at pc %d: %w", currentConf.PC, pending.PC, pending.PreviousErr)
+		}
+		if CompareSymbolicExpr(pending.Previous, correct.Registers[dest]) {
+			// 古い値が正しい値と同じなら投機しても区別できない
+			continue
+		}
+		stale := copyConfiguration(*correct)
+		stale.Registers[dest] = pending.Previous
+		// トレースにも実際に読んだ古い値を記録する
+		stale.Trace.Observations[len(stale.Trace.Observations)-1].Value = pending.Previous
+		staleConfs = append(staleConfs, &stale)
+	}
+	if len(staleConfs) == 0 {
+		return []Successor{{Conf: correct}}, nil
+	}
+
+	// ロールバックした時点でバイパスしたストアは解決している
+	correct.StoreBuffer = remaining
+	successors := make([]Successor, len(staleConfs))
+	for i, stale := range staleConfs {
+		stale.StoreBuffer = copyStoreBuffer(remaining)
+		successors[i] = Successor{Conf: stale, Correct: correct}
+	}
+	return successors, nil
+}
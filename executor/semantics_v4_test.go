@@ -0,0 +1,163 @@
+package executor_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/taisii/go-project/assembler"
+	"github.com/taisii/go-project/executor"
+)
+
+func TestStoreBypass(t *testing.T) {
+	testCases := []struct {
+		Name              string
+		Source            string
+		Semantics         executor.SpecSemantics
+		ExpectedRegisters map[string]interface{}
+		ExpectedSpecLoads []interface{} // 投機中の load のアドレス
+	}{
+		{
+			Name:              "Load reads the stale value",
+			Source:            "    v<-7\n    store v,0\n    load a,0\n    load b,a\n",
+			Semantics:         executor.SemanticsStoreBypass,
+			ExpectedRegisters: map[string]interface{}{"v": 7, "a": 7, "b": 70},
+			ExpectedSpecLoads: []interface{}{5},
+		},
+		{
+			Name:              "Bypass the two latest stores",
+			Source:            "    u<-6\n    v<-7\n    store u,0\n    store v,0\n    load a,0\n    load b,a\n",
+			Semantics:         executor.SemanticsStoreBypass,
+			ExpectedRegisters: map[string]interface{}{"u": 6, "v": 7, "a": 7, "b": 70},
+			ExpectedSpecLoads: []interface{}{6, 5},
+		},
+		{
+			Name:              "Store to another address",
+			Source:            "    v<-7\n    store v,1\n    load a,0\n    load b,a\n",
+			Semantics:         executor.SemanticsStoreBypass,
+			ExpectedRegisters: map[string]interface{}{"v": 7, "a": 5, "b": 50},
+		},
+		{
+			Name:              "spbarr resolves pending stores",
+			Source:            "    v<-7\n    store v,0\n    spbarr\n    load a,0\n    load b,a\n",
+			Semantics:         executor.SemanticsStoreBypass,
+			ExpectedRegisters: map[string]interface{}{"v": 7, "a": 7, "b": 70},
+		},
+		{
+			Name:              "Branch semantics does not bypass stores",
+			Source:            "    v<-7\n    store v,0\n    load a,0\n    load b,a\n",
+			Semantics:         executor.SemanticsBranch,
+			ExpectedRegisters: map[string]interface{}{"v": 7, "a": 7, "b": 70},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			asm, err := assembler.ParseAsm(strings.NewReader(testCase.Source))
+			if err != nil {
+				t.Fatalf("failed to parse program: %v", err)
+			}
+			conf := &executor.Configuration{Memory: map[int]interface{}{0: 5, 1: 0, 5: 50, 6: 60, 7: 70}}
+			opts := executor.SpecOptions{Window: executor.UnitWindow(10), Semantics: testCase.Semantics}
+			finalConfigs, err := executor.SpecRunAssemblerWithOptions(asm, conf, 100, opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// バイパスするストアごとに別の実行パスになる
+			var specLoads []interface{}
+			for _, final := range finalConfigs {
+				if !executor.CompareRegisters(testCase.ExpectedRegisters, final.Registers) {
+					t.Errorf("expected registers %v, got %v", testCase.ExpectedRegisters, final.Registers)
+				}
+				_, spec := executor.SplitTrace(final.Trace)
+				for _, obs := range spec {
+					if obs.Type == executor.ObsTypeLoad {
+						specLoads = append(specLoads, obs.Address)
+					}
+				}
+			}
+			if len(specLoads) != len(testCase.ExpectedSpecLoads) {
+				t.Fatalf("expected speculative loads %v, got %v", testCase.ExpectedSpecLoads, specLoads)
+			}
+			for i, addr := range testCase.ExpectedSpecLoads {
+				if !executor.CompareSymbolicExpr(addr, specLoads[i]) {
+					t.Errorf("expected speculative loads %v, got %v", testCase.ExpectedSpecLoads, specLoads)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSNIStoreBypass(t *testing.T) {
+	// 秘密を 0 で上書きした後に読み出し、その値をアドレスに使う Spectre v4 のガジェット
+	source := "    z<-0\n    store z,100\n    load a,100\n    load b,a\n"
+	asm, err := assembler.ParseAsm(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("failed to parse program: %v", err)
+	}
+
+	for _, semantics := range []executor.SpecSemantics{executor.SemanticsBranch, executor.SemanticsStoreBypass, executor.SemanticsAll} {
+		t.Run(string(semantics), func(t *testing.T) {
+			conf := &executor.Configuration{Memory: map[int]interface{}{0: 1}}
+			opts := executor.SpecOptions{Window: executor.UnitWindow(5), Semantics: semantics}
+			result, err := executor.CheckSNIWithOptions(asm, executor.Policy{}, conf, 100, opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expectSecure := semantics == executor.SemanticsBranch
+			if result.Secure != expectSecure {
+				t.Fatalf("expected secure=%v, got %v (leaks: %v)", expectSecure, result.Secure, result.Leaks)
+			}
+			if !expectSecure && (len(result.Leaks[0].Secrets) == 0 || result.Leaks[0].Secrets[0] != "mem[100]") {
+				t.Errorf("expected the leak of mem[100], got %v", result.Leaks[0].Secrets)
+			}
+		})
+	}
+}
+
+func TestStoreBypassUninitialisedMemory(t *testing.T) {
+	store := assembler.Store{Src: assembler.Register{Name: "v"}, Addr: assembler.Immediate{Value: 0}}
+	load := assembler.Load{Dest: assembler.Register{Name: "a"}, Addr: assembler.Immediate{Value: 0}}
+	model := executor.StoreBypass{}
+
+	t.Run("Symbolic", func(t *testing.T) {
+		conf := &executor.Configuration{Registers: map[string]interface{}{"v": 7}, MemoryPolicy: executor.MemorySymbolic}
+		stored, err := model.Successors(store, conf, executor.SpecContext{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// ストア前の値を読んでも元の状態は変わらない
+		if len(conf.Memory) != 0 || len(conf.InitialReads) != 0 {
+			t.Errorf("store modified the configuration: memory %v, initial reads %v", conf.Memory, conf.InitialReads)
+		}
+
+		loaded, err := model.Successors(load, stored[0].Conf, executor.SpecContext{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(loaded) != 1 || !loaded[0].Speculative() {
+			t.Fatalf("expected one bypassing successor, got %d", len(loaded))
+		}
+		// バイパスしたロードのトレースには、実際に読んだ古い値を記録する
+		stale := executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{executor.MemorySymbol(0)}}
+		observations := loaded[0].Conf.Trace.Observations
+		if last := observations[len(observations)-1]; !executor.CompareSymbolicExpr(last.Value, stale) {
+			t.Errorf("expected the bypassing load to observe %v, got %v", stale, last.Value)
+		}
+		observations = loaded[0].Correct.Trace.Observations
+		if last := observations[len(observations)-1]; !executor.CompareSymbolicExpr(last.Value, 7) {
+			t.Errorf("expected the correct load to observe 7, got %v", last.Value)
+		}
+	})
+
+	t.Run("Strict", func(t *testing.T) {
+		conf := &executor.Configuration{Registers: map[string]interface{}{"v": 7}, MemoryPolicy: executor.MemoryStrict}
+		stored, err := model.Successors(store, conf, executor.SpecContext{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// バイパスしたロードは初期化されていないメモリを読むのでエラーになる
+		if _, err := model.Successors(load, stored[0].Conf, executor.SpecContext{}); err == nil || !strings.Contains(err.Error(), "bypasses the store") {
+			t.Errorf("expected an error for the bypassing load, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,523 @@
+package executor
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Simplify は、式を書き換え規則で正規化した式を返します。
+// 定数畳み込み、単位元・吸収元の除去、結合的な演算の平坦化 ((a + b) + c → a + b + c)、
+// 可換な演算のオペランドの整列、二重否定の除去を行います。
+// 結果は元の式と同じ値をとり、同じ意味の式は多くの場合同じ形になります。
+// SymbolicExpr 以外の値 (int やレジスタ名) はそのまま返します。
+func Simplify(value interface{}) interface{} {
+	expr, ok := value.(SymbolicExpr)
+	if !ok {
+		if ptr, isPtr := value.(*SymbolicExpr); isPtr && ptr != nil {
+			expr = *ptr
+		} else {
+			return value
+		}
+	}
+
+	switch expr.Op {
+	case "", "symbol", "var":
+		return expr
+	case "value":
+		// パーサーが生成するリーフは中身と同じ意味を持つ
+		if len(expr.Operands) == 1 {
+			return Simplify(expr.Operands[0])
+		}
+		return expr
+	}
+
+	operands := make([]interface{}, len(expr.Operands))
+	for i, operand := range expr.Operands {
+		operands[i] = Simplify(operand)
+	}
+
+	switch expr.Op {
+	case "+", "-", "neg":
+		if expr.Op == "neg" && len(operands) != 1 {
+			break
+		}
+		return simplifySum(expr.Op, operands)
+	case "*":
+		return simplifyProduct(operands)
+	case "&", "|", "^":
+		return simplifyBitwise(expr.Op, operands)
+	case "&&", "||":
+		return simplifyLogical(expr.Op, operands)
+	case "!":
+		if len(operands) == 1 {
+			return simplifyNot(operands[0])
+		}
+	case "~":
+		if len(operands) == 1 {
+			// ~~x → x
+			if inner, ok := operands[0].(SymbolicExpr); ok && inner.Op == "~" && len(inner.Operands) == 1 {
+				return inner.Operands[0]
+			}
+		}
+	case "==", "!=", "<", "<=", ">", ">=":
+		if len(operands) == 2 {
+			return simplifyCompare(expr.Op, operands[0], operands[1])
+		}
+	case "ite":
+		if len(operands) == 3 {
+			if cond, ok := operands[0].(int); ok {
+				if cond != 0 {
+					return operands[1]
+				}
+				return operands[2]
+			}
+			if reflect.DeepEqual(operands[1], operands[2]) {
+				return operands[1]
+			}
+		}
+	}
+	return foldConstant(expr.Op, operands)
+}
+
+// foldConstant は、オペランドがすべて具体値なら計算結果を、そうでなければ式を返します。
+// 0 除算などで計算できない場合は式のまま残します。
+func foldConstant(op string, operands []interface{}) interface{} {
+	if allConcrete(operands) {
+		if result, err := computeConcrete(op, operands); err == nil {
+			return result
+		}
+	}
+	return SymbolicExpr{Op: op, Operands: operands}
+}
+
+// exprKey は、式を同一視するためのキーを返します。
+func exprKey(value interface{}) string {
+	return fmt.Sprintf("%#v", value)
+}
+
+// sortOperands は、オペランドを表示形式の順に並べ替えます。
+func sortOperands(operands []interface{}) {
+	sort.SliceStable(operands, func(i, j int) bool {
+		a, b := formatValue(operands[i]), formatValue(operands[j])
+		if a != b {
+			return a < b
+		}
+		return exprKey(operands[i]) < exprKey(operands[j])
+	})
+}
+
+// flatten は、op の入れ子になった式のオペランドを一列に並べます。
+func flatten(op string, operands []interface{}) []interface{} {
+	var result []interface{}
+	for _, operand := range operands {
+		if inner, ok := operand.(SymbolicExpr); ok && inner.Op == op {
+			result = append(result, flatten(op, inner.Operands)...)
+		} else {
+			result = append(result, operand)
+		}
+	}
+	return result
+}
+
+// linearTerm は、和の中の項とその係数を表す構造体
+type linearTerm struct {
+	expr  interface{}
+	coeff int
+}
+
+// simplifySum は、加減算と単項マイナスを項の係数にまとめて正規化します。
+// 例えば ((x + 1) + 1) - 1 は (x + 1) に、x - x は 0 になります。
+func simplifySum(op string, operands []interface{}) interface{} {
+	terms := make(map[string]*linearTerm)
+	var order []string
+	constant := 0
+
+	var collect func(value interface{}, sign int)
+	collect = func(value interface{}, sign int) {
+		switch v := value.(type) {
+		case int:
+			constant += sign * v
+			return
+		case SymbolicExpr:
+			switch {
+			case v.Op == "+":
+				for _, operand := range v.Operands {
+					collect(operand, sign)
+				}
+				return
+			case v.Op == "-" && len(v.Operands) >= 2:
+				collect(v.Operands[0], sign)
+				for _, operand := range v.Operands[1:] {
+					collect(operand, -sign)
+				}
+				return
+			case v.Op == "neg" && len(v.Operands) == 1:
+				collect(v.Operands[0], -sign)
+				return
+			case v.Op == "*" && len(v.Operands) >= 2:
+				// 定数倍は係数として扱う
+				if c, ok := v.Operands[len(v.Operands)-1].(int); ok {
+					rest := v.Operands[:len(v.Operands)-1]
+					var term interface{} = SymbolicExpr{Op: "*", Operands: rest}
+					if len(rest) == 1 {
+						term = rest[0]
+					}
+					addTerm(terms, &order, term, sign*c)
+					return
+				}
+			}
+		}
+		addTerm(terms, &order, value, sign)
+	}
+
+	switch op {
+	case "+":
+		for _, operand := range operands {
+			collect(operand, 1)
+		}
+	case "-":
+		collect(operands[0], 1)
+		for _, operand := range operands[1:] {
+			collect(operand, -1)
+		}
+	case "neg":
+		collect(operands[0], -1)
+	}
+
+	sort.Strings(order)
+	var positives, negatives []interface{}
+	for _, key := range order {
+		term := terms[key]
+		if term.coeff == 0 {
+			continue
+		}
+		magnitude := term.coeff
+		if magnitude < 0 {
+			magnitude = -magnitude
+		}
+		value := term.expr
+		if magnitude != 1 {
+			value = simplifyProduct([]interface{}{term.expr, magnitude})
+		}
+		if term.coeff > 0 {
+			positives = append(positives, value)
+		} else {
+			negatives = append(negatives, value)
+		}
+	}
+	sortOperands(positives)
+	sortOperands(negatives)
+	if constant > 0 {
+		positives = append(positives, constant)
+	} else if constant < 0 {
+		negatives = append(negatives, -constant)
+	}
+
+	var left interface{}
+	switch len(positives) {
+	case 0:
+		if len(negatives) == 0 {
+			return 0
+		}
+		// 正の項がない場合は先頭の項を符号反転する
+		if c, ok := negatives[0].(int); ok {
+			left = -c
+		} else {
+			left = SymbolicExpr{Op: "neg", Operands: []interface{}{negatives[0]}}
+		}
+		negatives = negatives[1:]
+	case 1:
+		left = positives[0]
+	default:
+		left = SymbolicExpr{Op: "+", Operands: positives}
+	}
+	if len(negatives) == 0 {
+		return left
+	}
+	return SymbolicExpr{Op: "-", Operands: append([]interface{}{left}, negatives...)}
+}
+
+// addTerm は、項 expr の係数に coeff を加えます。
+func addTerm(terms map[string]*linearTerm, order *[]string, expr interface{}, coeff int) {
+	key := exprKey(expr)
+	if term, ok := terms[key]; ok {
+		term.coeff += coeff
+		return
+	}
+	terms[key] = &linearTerm{expr: expr, coeff: coeff}
+	*order = append(*order, key)
+}
+
+// simplifyProduct は、乗算を平坦化し、定数をまとめて末尾に置きます。
+func simplifyProduct(operands []interface{}) interface{} {
+	constant := 1
+	var factors []interface{}
+	for _, operand := range flatten("*", operands) {
+		switch v := operand.(type) {
+		case int:
+			constant *= v
+		case SymbolicExpr:
+			if v.Op == "neg" && len(v.Operands) == 1 {
+				constant = -constant
+				factors = append(factors, v.Operands[0])
+			} else {
+				factors = append(factors, v)
+			}
+		default:
+			factors = append(factors, v)
+		}
+	}
+	if constant == 0 || len(factors) == 0 {
+		return constant
+	}
+	sortOperands(factors)
+	if constant == -1 && len(factors) == 1 {
+		return SymbolicExpr{Op: "neg", Operands: factors}
+	}
+	if constant != 1 {
+		factors = append(factors, constant)
+	}
+	if len(factors) == 1 {
+		return factors[0]
+	}
+	return SymbolicExpr{Op: "*", Operands: factors}
+}
+
+// simplifyBitwise は、&, |, ^ を平坦化し、定数をまとめ、重複するオペランドを除去します。
+func simplifyBitwise(op string, operands []interface{}) interface{} {
+	// 単位元と吸収元
+	identity, absorbing := 0, 0
+	hasAbsorbing := false
+	switch op {
+	case "&":
+		identity, absorbing, hasAbsorbing = -1, 0, true
+	case "|":
+		identity, absorbing, hasAbsorbing = 0, -1, true
+	}
+
+	constant := identity
+	counts := make(map[string]int)
+	var terms []interface{}
+	for _, operand := range flatten(op, operands) {
+		if c, ok := operand.(int); ok {
+			constant = bitwise(op, constant, c)
+			continue
+		}
+		key := exprKey(operand)
+		if counts[key] == 0 {
+			terms = append(terms, operand)
+		}
+		counts[key]++
+	}
+	if hasAbsorbing && constant == absorbing {
+		return absorbing
+	}
+
+	var result []interface{}
+	for _, term := range terms {
+		// x ^ x = 0 なので排他的論理和では偶数個の重複を消す (& と | は冪等)
+		if op == "^" && counts[exprKey(term)]%2 == 0 {
+			continue
+		}
+		result = append(result, term)
+	}
+	sortOperands(result)
+	if constant != identity {
+		result = append(result, constant)
+	}
+	switch len(result) {
+	case 0:
+		return identity
+	case 1:
+		return result[0]
+	}
+	return SymbolicExpr{Op: op, Operands: result}
+}
+
+func bitwise(op string, a, b int) int {
+	switch op {
+	case "&":
+		return a & b
+	case "|":
+		return a | b
+	default:
+		return a ^ b
+	}
+}
+
+// simplifyLogical は、&& と || を平坦化し、定数、重複、吸収則 (a && (a || b) → a) を処理します。
+func simplifyLogical(op string, operands []interface{}) interface{} {
+	// && では偽 (0)、|| では真 (1) が全体の値を決める
+	dominant, neutral := 0, 1
+	dual := "||"
+	if op == "||" {
+		dominant, neutral = 1, 0
+		dual = "&&"
+	}
+
+	seen := make(map[string]bool)
+	var terms []interface{}
+	for _, operand := range flatten(op, operands) {
+		if c, ok := operand.(int); ok {
+			if (c != 0) == (dominant != 0) {
+				return dominant
+			}
+			continue
+		}
+		key := exprKey(operand)
+		if !seen[key] {
+			seen[key] = true
+			terms = append(terms, operand)
+		}
+	}
+
+	var result []interface{}
+	for _, term := range terms {
+		// 相補則: a && !a → 0, a || !a → 1
+		if negated, ok := negateCondition(term); ok && seen[exprKey(negated)] {
+			return dominant
+		}
+		// 吸収則: 他のオペランドを含む dual の式は取り除く
+		if inner, ok := term.(SymbolicExpr); ok && inner.Op == dual {
+			absorbed := false
+			for _, operand := range inner.Operands {
+				if seen[exprKey(operand)] {
+					absorbed = true
+					break
+				}
+			}
+			if absorbed {
+				continue
+			}
+		}
+		result = append(result, term)
+	}
+
+	switch len(result) {
+	case 0:
+		return neutral
+	case 1:
+		return asCondition(result[0])
+	}
+	sortOperands(result)
+	return SymbolicExpr{Op: op, Operands: result}
+}
+
+// isCondition は、式の値が必ず 0 か 1 になるかどうかを返します。
+func isCondition(value interface{}) bool {
+	expr, ok := value.(SymbolicExpr)
+	return ok && isBooleanOp(expr.Op)
+}
+
+// asCondition は、式を 0 か 1 の値をとる条件に変換します (x → x != 0)。
+func asCondition(value interface{}) interface{} {
+	if c, ok := value.(int); ok {
+		return boolToInt(c != 0)
+	}
+	if isCondition(value) {
+		return value
+	}
+	return SymbolicExpr{Op: "!=", Operands: []interface{}{value, 0}}
+}
+
+// negatedComparison は、比較演算子の否定を表します。
+var negatedComparison = map[string]string{
+	"==": "!=", "!=": "==",
+	"<": ">=", ">=": "<",
+	">": "<=", "<=": ">",
+}
+
+// negateCondition は、条件式の否定を否定演算子を使わずに表せる場合はその式を返します。
+func negateCondition(value interface{}) (interface{}, bool) {
+	expr, ok := value.(SymbolicExpr)
+	if !ok {
+		return nil, false
+	}
+	if negated, ok := negatedComparison[expr.Op]; ok && len(expr.Operands) == 2 {
+		return SymbolicExpr{Op: negated, Operands: expr.Operands}, true
+	}
+	if expr.Op == "!" && len(expr.Operands) == 1 {
+		return asCondition(expr.Operands[0]), true
+	}
+	return nil, false
+}
+
+// simplifyNot は、論理否定を比較演算子の反転で表し、二重否定を取り除きます。
+func simplifyNot(operand interface{}) interface{} {
+	if c, ok := operand.(int); ok {
+		return boolToInt(c == 0)
+	}
+	if negated, ok := negateCondition(operand); ok {
+		return negated
+	}
+	if isCondition(operand) {
+		return SymbolicExpr{Op: "!", Operands: []interface{}{operand}}
+	}
+	// !x は x == 0 と同じ
+	return SymbolicExpr{Op: "==", Operands: []interface{}{operand, 0}}
+}
+
+// mirroredComparison は、左右のオペランドを入れ替えたときの比較演算子を表します。
+var mirroredComparison = map[string]string{
+	"==": "==", "!=": "!=",
+	"<": ">", ">": "<",
+	"<=": ">=", ">=": "<=",
+}
+
+// simplifyCompare は、比較の定数を右辺に集め、条件式と 0, 1 との比較を取り除きます。
+func simplifyCompare(op string, left, right interface{}) interface{} {
+	if allConcrete([]interface{}{left, right}) {
+		return foldConstant(op, []interface{}{left, right})
+	}
+	if reflect.DeepEqual(left, right) {
+		return boolToInt(op == "==" || op == "<=" || op == ">=")
+	}
+
+	// 定数は右辺に置く
+	if _, ok := left.(int); ok {
+		left, right = right, left
+		op = mirroredComparison[op]
+	}
+
+	if c, ok := right.(int); ok {
+		// x + 1 == 3 → x == 2
+		// 大小比較は int の折り返しで結果が変わる (x + 1 < 3 と x < 2 は x が最大値のとき異なる) ため、等価比較に限る
+		if offset, rest, ok := splitConstant(left); ok && (op == "==" || op == "!=") {
+			c -= offset
+			left, right = rest, c
+		}
+		// 条件式は 0 か 1 なので、0 や 1 との等価比較は条件式そのものかその否定になる
+		if isCondition(left) && (op == "==" || op == "!=") && (c == 0 || c == 1) {
+			if (op == "==") == (c == 1) {
+				return left
+			}
+			negated, _ := negateCondition(left)
+			if negated == nil {
+				return SymbolicExpr{Op: "!", Operands: []interface{}{left}}
+			}
+			return negated
+		}
+	}
+	return SymbolicExpr{Op: op, Operands: []interface{}{left, right}}
+}
+
+// splitConstant は、simplifySum の結果の式を定数部分とそれ以外に分けます。
+func splitConstant(value interface{}) (int, interface{}, bool) {
+	expr, ok := value.(SymbolicExpr)
+	if !ok || len(expr.Operands) < 2 {
+		return 0, nil, false
+	}
+	last, ok := expr.Operands[len(expr.Operands)-1].(int)
+	if !ok || (expr.Op != "+" && expr.Op != "-") {
+		return 0, nil, false
+	}
+	if expr.Op == "-" {
+		last = -last
+	}
+	rest := expr.Operands[:len(expr.Operands)-1]
+	if len(rest) == 1 {
+		return last, rest[0], true
+	}
+	return last, SymbolicExpr{Op: expr.Op, Operands: rest}, true
+}
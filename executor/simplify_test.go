@@ -0,0 +1,134 @@
+package executor
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		// 定数畳み込み
+		{input: "1 + 2 * 3", expected: "7"},
+		{input: "x + (2 * 3)", expected: "(x + 6)"},
+		{input: "x / 0", expected: "(x / 0)"},
+		// 加減算の正規化
+		{input: "((x + 1) + 1) - 1", expected: "(x + 1)"},
+		{input: "x - x", expected: "0"},
+		{input: "x + x", expected: "(x * 2)"},
+		{input: "1 + x", expected: "(x + 1)"},
+		{input: "y + x - 3", expected: "((x + y) - 3)"},
+		{input: "0 - x", expected: "-x"},
+		{input: "-(-x)", expected: "x"},
+		{input: "-(a - b)", expected: "(b - a)"},
+		// 単位元と吸収元
+		{input: "x * 1", expected: "x"},
+		{input: "x * 0", expected: "0"},
+		{input: "x & 0", expected: "0"},
+		{input: "x | 0", expected: "x"},
+		{input: "x ^ x", expected: "0"},
+		{input: "x & x", expected: "x"},
+		// 平坦化と整列
+		{input: "(c * b) * a", expected: "(a * b * c)"},
+		{input: "c | (b | a)", expected: "(a | b | c)"},
+		{input: "(a == 0 && b == 0) && c == 0", expected: "((a == 0) && (b == 0) && (c == 0))"},
+		// 論理演算
+		{input: "x == 0 && 1", expected: "(x == 0)"},
+		{input: "x == 0 && 0", expected: "0"},
+		{input: "x == 0 || 1", expected: "1"},
+		{input: "x && 1", expected: "(x != 0)"},
+		{input: "a == 0 && (a == 0 || b == 0)", expected: "(a == 0)"},
+		{input: "a < 1 && a >= 1", expected: "0"},
+		{input: "a == 0 && a == 0", expected: "(a == 0)"},
+		// 二重否定と比較
+		{input: "!!(x < 1)", expected: "(x < 1)"},
+		{input: "!!x", expected: "(x != 0)"},
+		{input: "!(x == y)", expected: "(x != y)"},
+		{input: "~~x", expected: "x"},
+		{input: "(x = 0) = 0", expected: "(x != 0)"},
+		{input: "(x < 3) != 0", expected: "(x < 3)"},
+		{input: "3 < x", expected: "(x > 3)"},
+		{input: "x + 1 == 3", expected: "(x == 2)"},
+		{input: "x + 1 < 3", expected: "((x + 1) < 3)"},
+		{input: "x == x", expected: "1"},
+		{input: "x < x", expected: "0"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.input, func(t *testing.T) {
+			expr, err := ParseSymbolicExpr(testCase.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := formatValue(Simplify(*expr)); got != testCase.expected {
+				t.Errorf("expected %s, got %s", testCase.expected, got)
+			}
+		})
+	}
+}
+
+// 正規化しても具体的な値が変わらないことを確認する
+func TestSimplifyPreservesValue(t *testing.T) {
+	inputs := []string{
+		"((x + 1) + 1) - 1",
+		"-(a - b) * 3 + a",
+		"x - y - (x - 2 * y)",
+		"(a & b) | (b & a) ^ a",
+		"!(a < b) && (b >= a || a = 0)",
+		"(x = 0) = 0",
+		"x + 1 =< 3",
+		"x + 1 < 3",
+		"x - 1 > y",
+		"x + 1 = 3",
+		"~~x + -x",
+	}
+	assignments := []map[string]interface{}{
+		{"x": 0, "y": 0, "a": 0, "b": 0},
+		{"x": 2, "y": -3, "a": 5, "b": 6},
+		{"x": -7, "y": 4, "a": -1, "b": 12},
+		// 折り返しの境界
+		{"x": math.MaxInt64, "y": math.MaxInt64, "a": math.MinInt64, "b": math.MaxInt64},
+		{"x": math.MinInt64, "y": 0, "a": math.MaxInt64, "b": math.MinInt64},
+	}
+
+	for _, input := range inputs {
+		expr, err := ParseSymbolicExpr(input)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", input, err)
+		}
+		simplified := Simplify(*expr)
+		for _, registers := range assignments {
+			conf := &Configuration{Registers: registers}
+			want, err := evalExpr(*expr, conf)
+			if err != nil {
+				t.Fatalf("failed to evaluate %q: %v", input, err)
+			}
+			got, err := evalExpr(simplified, conf)
+			if err != nil {
+				t.Fatalf("failed to evaluate simplified %s: %v", formatValue(simplified), err)
+			}
+			if want != got {
+				t.Errorf("%q with %v: expected %v, but simplified %s gives %v", input, registers, want, formatValue(simplified), got)
+			}
+		}
+	}
+}
+
+func TestUpdatePathCondSimplifies(t *testing.T) {
+	x := SymbolicExpr{Op: "symbol", Operands: []interface{}{"x"}}
+	y := SymbolicExpr{Op: "symbol", Operands: []interface{}{"y"}}
+
+	cond := updatePathCond(SymbolicExpr{}, "!=", x)
+	cond = updatePathCond(cond, "==", y)
+	cond = updatePathCond(cond, "!=", x)
+	if got := formatSymbolicExpr(cond); got != "((x != 0) && (y == 0))" {
+		t.Errorf("unexpected path condition: %s", got)
+	}
+
+	// 具体値の条件は常に真なのでパス条件に残らない
+	if cond := updatePathCond(SymbolicExpr{}, "==", 0); cond.Op != "" || len(cond.Operands) != 0 {
+		t.Errorf("expected empty path condition, got %s", formatSymbolicExpr(cond))
+	}
+}
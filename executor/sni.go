@@ -0,0 +1,232 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/taisii/go-project/assembler"
+)
+
+// Policy は、投機的非干渉性の検査で攻撃者が知っている (公開) とみなす入力を表す構造体
+// ここに含まれないシンボルはすべて秘密として扱います。
+type Policy struct {
+	PublicRegisters []string       // 公開レジスタ (初期値のシンボル名はレジスタ名と同じ)
+	PublicMemory    []AddressRange // 公開メモリのアドレスの範囲 (初期値のシンボル名は MemorySymbol(addr))
+}
+
+// IsPublic は、シンボル name が公開入力かどうかを返します。
+func (p Policy) IsPublic(name string) bool {
+	for _, reg := range p.PublicRegisters {
+		if reg == name {
+			return true
+		}
+	}
+	if addr, ok := memorySymbolAddress(name); ok {
+		return rangesContain(p.PublicMemory, addr)
+	}
+	return false
+}
+
+// AddressRange は、両端を含むメモリのアドレスの範囲を表す構造体
+type AddressRange struct {
+	Low, High int
+}
+
+// Contains は、addr が範囲に含まれるかどうかを返します。
+func (r AddressRange) Contains(addr int) bool {
+	return r.Low <= addr && addr <= r.High
+}
+
+// String は、範囲を mem[addr] または mem[low..high] の形式で返します。
+func (r AddressRange) String() string {
+	if r.Low == r.High {
+		return MemorySymbol(r.Low)
+	}
+	return fmt.Sprintf("mem[%d..%d]", r.Low, r.High)
+}
+
+// rangesContain は、アドレス順に並んだ重ならない範囲のいずれかに addr が含まれるかどうかを返します。
+func rangesContain(ranges []AddressRange, addr int) bool {
+	i := sort.Search(len(ranges), func(k int) bool { return ranges[k].High >= addr })
+	return i < len(ranges) && ranges[i].Contains(addr)
+}
+
+// Leak は、投機実行中の観測だけが秘密に依存している実行パスを表す構造体
+type Leak struct {
+	Config      *Configuration // リークが見つかったパスの最終状態
+	Other       *Configuration // 観測が異なる二つ目の実行が通るパスの最終状態 (Config と同じ場合もある)
+	Observation Observation    // 秘密によって異なり得る最初の投機的な観測
+	Secrets     []string       // Observation の観測できる部分に現れる秘密のシンボル
+}
+
+// SNIResult は、投機的非干渉性の検査結果を表す構造体
+type SNIResult struct {
+	Secure       bool             // リークが見つからず、判定できなかったパスもない場合は true
+	Paths        int              // 検査した実行パスの数
+	Leaks        []Leak           // パスごとに見つかったリーク
+	Inconclusive []*Configuration // リークは見つからなかったが、ソルバーが判定できなかったパス
+	Configs      []*Configuration // 検査した実行パスの最終状態
+}
+
+// CheckSNI は、asm を投機実行し、policy に対して投機的非干渉性を満たすかを検査します。
+// initialConfig が nil の場合は、すべてのレジスタをシンボリックな入力として実行します。
+// メモリのポリシーが指定されていない場合は MemorySymbolic を使います。
+func CheckSNI(asm *assembler.Assembler, policy Policy, initialConfig *Configuration, maxSteps int, remainingWindow int) (*SNIResult, error) {
+	return CheckSNIWithOptions(asm, policy, initialConfig, maxSteps, SpecOptions{Window: UnitWindow(remainingWindow)})
+}
+
+// CheckSNIWithOptions は、opts の設定で投機実行して CheckSNI と同じ検査を行います。
+func CheckSNIWithOptions(asm *assembler.Assembler, policy Policy, initialConfig *Configuration, maxSteps int, opts SpecOptions) (*SNIResult, error) {
+	if initialConfig == nil {
+		initialConfig = &Configuration{}
+	}
+	if initialConfig.MemoryPolicy == "" {
+		// 初期化されていないメモリは入力として扱う
+		conf := *initialConfig
+		conf.MemoryPolicy = MemorySymbolic
+		initialConfig = &conf
+	}
+	finalConfigs, err := SpecRunAssemblerWithOptions(asm, initialConfig, maxSteps, opts)
+	if err != nil {
+		return nil, err
+	}
+	return AnalyzeTraces(finalConfigs, policy), nil
+}
+
+// AnalyzeTraces は、SpecExecute の結果の各実行パスについて、投機的非干渉性を満たさない入力の組があるかを検査します。
+// 秘密の入力の名前を変えた二つ目の実行 (自己合成) と組み合わせ、公開入力とパス条件と非投機的な観測が
+// 一致するのに投機的な観測が異なる入力をソルバーで探し、見つかった場合はリークとして報告します。
+// 観測されるのはロードとストアのアドレスと分岐の方向だけで、ロードした値そのものは観測されません。
+// ソルバーが判定できなかったパスはリークとはせず、Inconclusive として報告します (この場合 Secure は false です)。
+func AnalyzeTraces(finalConfigs []*Configuration, policy Policy) *SNIResult {
+	result := &SNIResult{Secure: true, Paths: len(finalConfigs), Configs: finalConfigs}
+	for _, conf := range finalConfigs {
+		switch leak, status := findLeak(conf, finalConfigs, policy); status {
+		case Sat:
+			result.Secure = false
+			result.Leaks = append(result.Leaks, leak)
+		case Unknown:
+			result.Secure = false
+			result.Inconclusive = append(result.Inconclusive, conf)
+		}
+	}
+	return result
+}
+
+// findLeak は、conf の実行と、configs のいずれかのパスを通る二つ目の実行の組で投機的な観測が異なるものを探します。
+// 一つのパスの中では投機的な分岐の方向もパス条件で決まるため、二つ目の実行は conf 自身に加えて他のパスからも探します。
+// リークが見つかった場合は Sat を、見つからなかったがソルバーが判定できない組があった場合は Unknown を、
+// どの組でも投機的な観測が一致する場合は Unsat を返します。
+func findLeak(conf *Configuration, configs []*Configuration, policy Policy) (Leak, SolveResult) {
+	result := Unsat
+	candidates := append([]*Configuration{conf}, configs...)
+	for i, other := range candidates {
+		if i > 0 && other == conf {
+			continue
+		}
+		query, err := newSelfComposition(conf, other, policy)
+		if err != nil {
+			continue
+		}
+		status, model := Solve(query.constraints...)
+		switch status {
+		case Unsat:
+			continue
+		case Unknown:
+			result = Unknown
+			continue
+		}
+		// モデルのもとで実際に異なる観測がなければリークとして報告しない
+		obs, ok := query.differingObservation(model)
+		if !ok {
+			result = Unknown
+			continue
+		}
+		return Leak{Config: conf, Other: other, Observation: obs, Secrets: secretSymbols(obs, policy)}, Sat
+	}
+	return Leak{}, result
+}
+
+// secretSymbols は、観測に現れる公開されていない入力のシンボル名を返します。
+func secretSymbols(obs Observation, policy Policy) []string {
+	var secrets []string
+	for _, name := range observationSymbols(obs) {
+		if !policy.IsPublic(name) {
+			secrets = append(secrets, name)
+		}
+	}
+	return secrets
+}
+
+// SplitTrace は、トレースの観測を非投機的なものと投機的なものに分けます。
+// start 直後の分岐の観測は、正しい方向の分岐と同じ条件を観測するため start の外側として扱います。
+func SplitTrace(trace Trace) (nonSpec []Observation, spec []Observation) {
+	depth := 0
+	afterStart := false
+	for _, obs := range trace.Observations {
+		switch obs.Type {
+		case ObsTypeStart:
+			depth++
+			afterStart = true
+			continue
+		case ObsTypeRollback, ObsTypeCommit:
+			if depth > 0 {
+				depth--
+			}
+			continue
+		}
+
+		visibleDepth := depth
+		if afterStart {
+			visibleDepth--
+			afterStart = false
+		}
+		if visibleDepth == 0 {
+			nonSpec = append(nonSpec, obs)
+		} else {
+			spec = append(spec, obs)
+		}
+	}
+	return nonSpec, spec
+}
+
+// observationSymbols は、攻撃者が観測できる部分 (ロードとストアのアドレス、分岐の条件) に現れるシンボル名をソートして返します。
+func observationSymbols(obs Observation) []string {
+	set := make(map[string]bool)
+	switch obs.Type {
+	case ObsTypeLoad, ObsTypeStore:
+		collectSymbols(obs.Address, set)
+	case ObsTypePC:
+		collectSymbols(obs.Value, set)
+	}
+
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// collectSymbols は、式に含まれる symbol ノードの名前を set に追加します。
+func collectSymbols(value interface{}, set map[string]bool) {
+	switch v := value.(type) {
+	case *SymbolicExpr:
+		if v != nil {
+			collectSymbols(*v, set)
+		}
+	case SymbolicExpr:
+		switch v.Op {
+		case "symbol":
+			if name, ok := v.Operands[0].(string); ok {
+				set[name] = true
+			}
+		case "var":
+			// レジスタへの書き込み先はレジスタ名であり、入力ではない
+		default:
+			for _, operand := range v.Operands {
+				collectSymbols(operand, set)
+			}
+		}
+	}
+}
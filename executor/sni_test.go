@@ -0,0 +1,215 @@
+package executor_test
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/taisii/go-project/assembler"
+	"github.com/taisii/go-project/executor"
+)
+
+func TestCheckSNI(t *testing.T) {
+	secretMemory := func() *executor.Configuration {
+		return &executor.Configuration{
+			Memory: map[int]interface{}{
+				5: executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{executor.MemorySymbol(5)}},
+			},
+		}
+	}
+
+	testCases := []struct {
+		Name            string
+		Source          string
+		Policy          executor.Policy
+		InitialConfig   *executor.Configuration
+		ExpectedSecure  bool
+		ExpectedSecrets []string // 最初のリークの秘密
+	}{
+		{
+			Name:            "Secret loaded under misprediction controls a branch",
+			Source:          "beqz c, End\nload s, 5\nbeqz s, End\nEnd:\n",
+			Policy:          executor.Policy{PublicRegisters: []string{"c"}},
+			InitialConfig:   secretMemory(),
+			ExpectedSecure:  false,
+			ExpectedSecrets: []string{"mem[5]"},
+		},
+		{
+			Name:           "spbarr prevents the leak",
+			Source:         "beqz c, End\nspbarr\nload s, 5\nbeqz s, End\nEnd:\n",
+			Policy:         executor.Policy{PublicRegisters: []string{"c"}},
+			InitialConfig:  secretMemory(),
+			ExpectedSecure: true,
+		},
+		{
+			Name:           "Public memory is not a secret",
+			Source:         "beqz c, End\nload s, 5\nbeqz s, End\nEnd:\n",
+			Policy:         executor.Policy{PublicRegisters: []string{"c"}, PublicMemory: []executor.AddressRange{{Low: 5, High: 5}}},
+			InitialConfig:  secretMemory(),
+			ExpectedSecure: true,
+		},
+		{
+			Name:           "Secret already observed non-speculatively",
+			Source:         "beqz k, End\nEnd:\n",
+			Policy:         executor.Policy{},
+			ExpectedSecure: true,
+		},
+		{
+			Name:            "Secret register branch under misprediction",
+			Source:          "beqz c, End\nbeqz k, End\nEnd:\n",
+			Policy:          executor.Policy{PublicRegisters: []string{"c"}},
+			ExpectedSecure:  false,
+			ExpectedSecrets: []string{"k"},
+		},
+		{
+			Name:            "Secret in a non-speculative branch still leaks speculatively",
+			Source:          "beqz k, L\nL:\nbeqz c, End\nload y, k\nEnd:\n",
+			Policy:          executor.Policy{PublicRegisters: []string{"c"}},
+			ExpectedSecure:  false,
+			ExpectedSecrets: []string{"k"},
+		},
+		{
+			Name:           "Secret fully revealed by a non-speculative load",
+			Source:         "load t, k\nbeqz c, End\nload y, k\nEnd:\n",
+			Policy:         executor.Policy{PublicRegisters: []string{"c"}},
+			ExpectedSecure: true,
+		},
+		{
+			Name:   "Spectre v1 gadget with symbolic addresses",
+			Source: "x <- idx < size\nbeqz x, End\nload v, a1 + idx\nload w, a2 + v\nEnd:\n",
+			Policy: executor.Policy{PublicRegisters: []string{"idx", "size"}},
+			InitialConfig: &executor.Configuration{
+				Registers: map[string]interface{}{"a1": 100, "a2": 200},
+			},
+			ExpectedSecure:  false,
+			ExpectedSecrets: []string{"mem[(idx + 100)]"},
+		},
+		{
+			Name:           "Speculatively loaded value is not observed",
+			Source:         "x <- in < bound\nbeqz x, End\nload v, in\nEnd:\n",
+			Policy:         executor.Policy{PublicRegisters: []string{"in", "bound"}},
+			ExpectedSecure: true,
+		},
+		{
+			Name:   "Non-speculative branch reveals only part of a secret",
+			Source: "x <- k < 10\nbeqz x, End\nbeqz c, End\nload y, a + k\nEnd:\n",
+			Policy: executor.Policy{PublicRegisters: []string{"c"}},
+			InitialConfig: &executor.Configuration{
+				Registers:    map[string]interface{}{"a": 100},
+				MemoryPolicy: executor.MemoryZero,
+			},
+			ExpectedSecure:  false,
+			ExpectedSecrets: []string{"k"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			asm, err := assembler.ParseAsm(strings.NewReader(testCase.Source))
+			if err != nil {
+				t.Fatalf("failed to parse program: %v", err)
+			}
+			result, err := executor.CheckSNI(asm, testCase.Policy, testCase.InitialConfig, 100, 5)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Secure != testCase.ExpectedSecure {
+				t.Fatalf("expected secure=%v, but got %v (leaks: %+v)", testCase.ExpectedSecure, result.Secure, result.Leaks)
+			}
+			if !testCase.ExpectedSecure && !reflect.DeepEqual(result.Leaks[0].Secrets, testCase.ExpectedSecrets) {
+				t.Errorf("expected secrets %v, but got %v", testCase.ExpectedSecrets, result.Leaks[0].Secrets)
+			}
+			for _, leak := range result.Leaks {
+				if leak.Observation.Type == "" {
+					t.Errorf("leak without an observation: %+v", leak)
+				}
+				if leak.Other == nil {
+					t.Errorf("leak without a second run: %+v", leak)
+				}
+			}
+		})
+	}
+}
+
+// tests/test2.muasm は、すべての入力が秘密でも投機的な観測は非投機的な観測から決まるので安全
+func TestCheckSNIAllSecretTest2(t *testing.T) {
+	file, err := os.Open("../tests/test2.muasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	asm, err := assembler.ParseAsm(file)
+	if err != nil {
+		t.Fatalf("failed to parse program: %v", err)
+	}
+	result, err := executor.CheckSNI(asm, executor.Policy{}, nil, 1000, 20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Secure || len(result.Leaks) != 0 || len(result.Inconclusive) != 0 {
+		t.Errorf("expected secure, but got leaks %+v and %d undecided paths", result.Leaks, len(result.Inconclusive))
+	}
+}
+
+func TestCheckSNIUndecided(t *testing.T) {
+	// k*k == k'*k' かつ k != k' は k' = -k で成り立つが、区間の探索では判定できない
+	source := "a <- k*k\nload t, a\nbeqz c, End\nload t, k\nEnd:\n"
+	asm, err := assembler.ParseAsm(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("failed to parse program: %v", err)
+	}
+	result, err := executor.CheckSNI(asm, executor.Policy{PublicRegisters: []string{"c"}}, nil, 100, 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Secure || len(result.Leaks) != 0 || len(result.Inconclusive) != 1 {
+		t.Errorf("expected one undecided path and no leaks, but got secure=%v, leaks %+v and %d undecided paths", result.Secure, result.Leaks, len(result.Inconclusive))
+	}
+}
+
+func TestCheckSNIMispredictionBudget(t *testing.T) {
+	// 予算が 1 の場合でも、最初の分岐を正しく予測して 2 つ目の分岐を誤って予測するパスを探索する
+	source := "beqz d, L\nL:\nbeqz c, End\nload s, 5\nbeqz s, End\nEnd:\n"
+	asm, err := assembler.ParseAsm(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("failed to parse program: %v", err)
+	}
+	initialConfig := &executor.Configuration{
+		Memory: map[int]interface{}{
+			5: executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{executor.MemorySymbol(5)}},
+		},
+	}
+	opts := executor.SpecOptions{Window: executor.UnitWindow(5), MaxMispredictions: 1}
+	result, err := executor.CheckSNIWithOptions(asm, executor.Policy{PublicRegisters: []string{"c", "d"}}, initialConfig, 200, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Secure || len(result.Leaks) == 0 {
+		t.Fatalf("expected a leak, but got secure=%v", result.Secure)
+	}
+	if !reflect.DeepEqual(result.Leaks[0].Secrets, []string{"mem[5]"}) {
+		t.Errorf("expected secrets [mem[5]], but got %v", result.Leaks[0].Secrets)
+	}
+}
+
+func TestSplitTrace(t *testing.T) {
+	trace := executor.Trace{
+		Observations: []executor.Observation{
+			{PC: 0, Type: executor.ObsTypeLoad, Address: 1, Value: 2},
+			{PC: 1, Type: executor.ObsTypeStart, Value: 0},
+			{PC: 1, Type: executor.ObsTypePC, Value: executor.SymbolicExpr{Op: "!=", Operands: []interface{}{"x", 0}}},
+			{PC: 2, Type: executor.ObsTypeLoad, Address: 3, Value: 4},
+			{PC: 3, Type: executor.ObsTypeRollback, Value: 0},
+			{PC: 4, Type: executor.ObsTypeLoad, Address: 5, Value: 6},
+		},
+	}
+
+	nonSpec, spec := executor.SplitTrace(trace)
+	if len(nonSpec) != 3 || nonSpec[1].PC != 1 || nonSpec[2].PC != 4 {
+		t.Errorf("unexpected non-speculative observations: %+v", nonSpec)
+	}
+	if len(spec) != 1 || spec[0].PC != 2 {
+		t.Errorf("unexpected speculative observations: %+v", spec)
+	}
+}
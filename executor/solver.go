@@ -0,0 +1,734 @@
+package executor
+
+import (
+	"math"
+	"sort"
+)
+
+// SolveResult は、制約の充足可能性の判定結果を表す型
+type SolveResult int
+
+const (
+	Unsat   SolveResult = iota // 充足不能
+	Sat                        // 充足可能 (Model が得られる)
+	Unknown                    // 探索の上限に達したため判定できない
+)
+
+func (r SolveResult) String() string {
+	switch r {
+	case Unsat:
+		return "unsat"
+	case Sat:
+		return "sat"
+	default:
+		return "unknown"
+	}
+}
+
+// Model は、シンボル名から具体値への割り当てを表す型
+type Model map[string]int
+
+// Solver は、SymbolicExpr の制約を解く区間伝播と二分探索によるソルバー
+// 各シンボルは [MinValue, MaxValue] の整数をとるものとして扱います。
+// 算術演算は computeConcrete と同じく Go の int (2^64 を法として折り返す) として扱い、
+// 探索したノード数が MaxNodes を超えた場合は Unknown を返すため、NewSolver の Unsat の判定は常に正しいです。
+type Solver struct {
+	MinValue int
+	MaxValue int
+	MaxNodes int
+}
+
+// NewSolver は、実行器と同じ int のすべての値を入力としてとり得る Solver を作成します。
+func NewSolver() *Solver {
+	return &Solver{
+		MinValue: math.MinInt64,
+		MaxValue: math.MaxInt64,
+		MaxNodes: 10000,
+	}
+}
+
+// Solve は、NewSolver の Solver で constraints がすべて成り立つ割り当てを探します。
+func Solve(constraints ...interface{}) (SolveResult, Model) {
+	return NewSolver().Solve(constraints...)
+}
+
+// Witness は、パス条件を満たす具体的な入力を返します。見つからない場合は false を返します。
+func Witness(conf Configuration) (Model, bool) {
+	result, model := Solve(conf.Trace.PathCond)
+	return model, result == Sat
+}
+
+// isFeasible は、パス条件が充足不能と判定されなければ true を返します。
+func isFeasible(pathCond SymbolicExpr) bool {
+	result, _ := Solve(pathCond)
+	return result != Unsat
+}
+
+// Solve は、constraints (0 以外を真とする式) がすべて成り立つ割り当てを探します。
+// 空の SymbolicExpr は真として扱います。
+func (s *Solver) Solve(constraints ...interface{}) (SolveResult, Model) {
+	var active []interface{}
+	names := make(map[string]bool)
+	for _, c := range constraints {
+		if expr, ok := c.(SymbolicExpr); ok && expr.Op == "" && len(expr.Operands) == 0 {
+			continue
+		}
+		active = append(active, c)
+		collectSolverSymbols(c, names)
+	}
+
+	// 区間では表せない変数同士の関係 (x == y と x != y、x < y と y < x など) を先に調べる
+	if relationsInconsistent(active) {
+		return Unsat, nil
+	}
+
+	domains := make(map[string]interval, len(names))
+	for name := range names {
+		domains[name] = interval{s.MinValue, s.MaxValue}
+	}
+	search := &solverSearch{constraints: active, maxNodes: s.MaxNodes}
+	return search.run(domains)
+}
+
+// collectSolverSymbols は、式に現れる変数名を names に追加します。
+func collectSolverSymbols(value interface{}, names map[string]bool) {
+	switch v := value.(type) {
+	case string:
+		names[v] = true
+	case *SymbolicExpr:
+		if v != nil {
+			collectSolverSymbols(*v, names)
+		}
+	case SymbolicExpr:
+		for _, operand := range v.Operands {
+			collectSolverSymbols(operand, names)
+		}
+	}
+}
+
+// interval は、整数の閉区間 [lo, hi] を表す構造体 (lo > hi は空集合)
+// 区間演算は、結果が int で桁あふれし得る場合は fullInterval を返します。
+type interval struct {
+	lo, hi int
+}
+
+var (
+	fullInterval  = interval{math.MinInt64, math.MaxInt64}
+	emptyInterval = interval{1, 0}
+	trueInterval  = interval{1, 1}
+	falseInterval = interval{0, 0}
+	boolInterval  = interval{0, 1}
+)
+
+func (a interval) empty() bool     { return a.lo > a.hi }
+func (a interval) singleton() bool { return a.lo == a.hi }
+func (a interval) contains(v int) bool {
+	return a.lo <= v && v <= a.hi
+}
+
+func (a interval) intersect(b interval) interval {
+	return interval{max(a.lo, b.lo), min(a.hi, b.hi)}
+}
+
+// definitelyTrue, definitelyFalse は、区間内のすべての値が真 (0 以外) または偽 (0) かを返します。
+func (a interval) definitelyTrue() bool  { return !a.empty() && !a.contains(0) }
+func (a interval) definitelyFalse() bool { return a == falseInterval }
+
+// closestToZero は、区間内で 0 に最も近い値を返します。
+func (a interval) closestToZero() int {
+	switch {
+	case a.lo > 0:
+		return a.lo
+	case a.hi < 0:
+		return a.hi
+	default:
+		return 0
+	}
+}
+
+// checkedAdd, checkedSub は、Go の int の加算・減算の結果と、桁あふれしなかったかどうかを返します。
+func checkedAdd(a, b int) (int, bool) {
+	r := a + b
+	return r, (b >= 0) == (r >= a)
+}
+
+func checkedSub(a, b int) (int, bool) {
+	r := a - b
+	return r, (b >= 0) == (r <= a)
+}
+
+// mulOverflows は、区間同士の積のいずれかが桁あふれし得るかどうかを返します。
+// 端点の積が桁あふれしなければ、区間内の積も桁あふれしません。
+func mulOverflows(a, b interval) bool {
+	for _, x := range []int{a.lo, a.hi} {
+		for _, y := range []int{b.lo, b.hi} {
+			if x == 0 || y == 0 {
+				continue
+			}
+			r := x * y
+			if r/y != x || (x == -1 && y == math.MinInt64) || (y == -1 && x == math.MinInt64) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func satAdd(a, b int) int {
+	switch {
+	case b > 0 && a > math.MaxInt64-b:
+		return math.MaxInt64
+	case b < 0 && a < math.MinInt64-b:
+		return math.MinInt64
+	}
+	return a + b
+}
+
+func satNeg(a int) int {
+	if a == math.MinInt64 {
+		return math.MaxInt64
+	}
+	return -a
+}
+
+func satSub(a, b int) int { return satAdd(a, satNeg(b)) }
+
+// corners は、区間の端点同士に演算 f を適用した結果を含む最小の区間を返します。
+func corners(a, b interval, f func(x, y int) int) interval {
+	values := []int{f(a.lo, b.lo), f(a.lo, b.hi), f(a.hi, b.lo), f(a.hi, b.hi)}
+	sort.Ints(values)
+	return interval{values[0], values[3]}
+}
+
+// floorDiv, ceilDiv は、切り捨て・切り上げの整数除算 (b != 0) です。
+func floorDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+func ceilDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) == (b < 0)) {
+		q++
+	}
+	return q
+}
+
+// solverSearch は、一回の Solve の探索状態を保持する構造体
+type solverSearch struct {
+	constraints []interface{}
+	maxNodes    int
+	nodes       int
+}
+
+// run は、区間を伝播させ、決まらない場合は最も広い区間を二分して探索します。
+func (s *solverSearch) run(domains map[string]interval) (SolveResult, Model) {
+	s.nodes++
+	if s.nodes > s.maxNodes {
+		return Unknown, nil
+	}
+	if !s.propagate(domains) {
+		return Unsat, nil
+	}
+
+	allTrue := true
+	for _, c := range s.constraints {
+		value := evalInterval(c, domains)
+		if value.empty() || value.definitelyFalse() {
+			return Unsat, nil
+		}
+		if !value.definitelyTrue() {
+			allTrue = false
+		}
+	}
+	if allTrue {
+		// 区間内の点は 0 による除算となるものを除いてすべて解なので、0 に近い値を選んで確かめる
+		model := make(Model, len(domains))
+		for name, d := range domains {
+			model[name] = d.closestToZero()
+		}
+		if s.holds(model) {
+			return Sat, model
+		}
+		// 選んだ値で除数が 0 になる場合は、区間を分割して探索を続ける
+	}
+
+	// 最も広い区間を持つ変数を分割する (名前順で決定的にする)
+	names := make([]string, 0, len(domains))
+	for name := range domains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	splitName := ""
+	for _, name := range names {
+		d := domains[name]
+		if d.singleton() {
+			continue
+		}
+		if splitName == "" || satSub(d.hi, d.lo) > satSub(domains[splitName].hi, domains[splitName].lo) {
+			splitName = name
+		}
+	}
+	if splitName == "" {
+		// すべて具体値なのに判定できない (未対応の演算子など)
+		return Unknown, nil
+	}
+
+	d := domains[splitName]
+	var halves [2]interval
+	if d.lo < 0 && d.hi >= 0 {
+		halves = [2]interval{{0, d.hi}, {d.lo, -1}}
+	} else {
+		mid := d.lo + (d.hi-d.lo)/2
+		lower, upper := interval{d.lo, mid}, interval{mid + 1, d.hi}
+		if d.lo >= 0 {
+			halves = [2]interval{lower, upper}
+		} else {
+			halves = [2]interval{upper, lower}
+		}
+	}
+
+	result := Unsat
+	for _, half := range halves {
+		branch := make(map[string]interval, len(domains))
+		for name, value := range domains {
+			branch[name] = value
+		}
+		branch[splitName] = half
+		r, model := s.run(branch)
+		if r == Sat {
+			return Sat, model
+		}
+		if r == Unknown {
+			result = Unknown
+		}
+	}
+	return result, nil
+}
+
+// holds は、model のもとですべての制約が成り立つかどうかを返します。
+// 実行器と同じく、0 による除算と剰余を含む制約は成り立たないものとします。
+func (s *solverSearch) holds(model Model) bool {
+	for _, c := range s.constraints {
+		if v, ok := evalModel(c, model); !ok || v == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// propagate は、区間が変化しなくなるまで制約による絞り込みを繰り返します。矛盾した場合は false を返します。
+func (s *solverSearch) propagate(domains map[string]interval) bool {
+	for round := 0; round < 64; round++ {
+		before := make(map[string]interval, len(domains))
+		for name, value := range domains {
+			before[name] = value
+		}
+		for _, c := range s.constraints {
+			if !narrowTruth(c, true, domains) {
+				return false
+			}
+		}
+		changed := false
+		for name, value := range domains {
+			if before[name] != value {
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			return true
+		}
+	}
+	return true
+}
+
+// isBooleanOp は、結果が 0 か 1 になる演算子かどうかを返します。
+func isBooleanOp(op string) bool {
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=", "&&", "||", "!":
+		return true
+	}
+	return false
+}
+
+// unwrapValue は、パーサーが生成する "value" ノードやポインタを取り除いた式を返します。
+func unwrapValue(value interface{}) interface{} {
+	for {
+		expr, ok := value.(SymbolicExpr)
+		if !ok || expr.Op != "value" || len(expr.Operands) != 1 {
+			if ptr, ok := value.(*SymbolicExpr); ok && ptr != nil {
+				value = *ptr
+				continue
+			}
+			return value
+		}
+		value = expr.Operands[0]
+	}
+}
+
+// evalInterval は、変数の区間 domains のもとで式がとりうる値の区間を返します。
+func evalInterval(value interface{}, domains map[string]interval) interval {
+	switch v := unwrapValue(value).(type) {
+	case int:
+		return interval{v, v}
+	case string:
+		if d, ok := domains[v]; ok {
+			return d
+		}
+		return fullInterval
+	case SymbolicExpr:
+		if v.Op == "symbol" {
+			return evalInterval(v.Operands[0], domains)
+		}
+		if len(v.Operands) == 1 {
+			switch v.Op {
+			case "!":
+				return notInterval(evalInterval(v.Operands[0], domains))
+			case "neg":
+				return applyInterval("-", interval{0, 0}, evalInterval(v.Operands[0], domains))
+			case "~":
+				// ~x = -x - 1
+				return applyInterval("-", interval{-1, -1}, evalInterval(v.Operands[0], domains))
+			}
+		}
+		if v.Op == "ite" && len(v.Operands) == 3 {
+			cond := evalInterval(v.Operands[0], domains)
+			then := evalInterval(v.Operands[1], domains)
+			els := evalInterval(v.Operands[2], domains)
+			switch {
+			case cond.empty():
+				return emptyInterval
+			case cond.definitelyTrue():
+				return then
+			case cond.definitelyFalse():
+				return els
+			case then.empty():
+				return els
+			case els.empty():
+				return then
+			}
+			return interval{min(then.lo, els.lo), max(then.hi, els.hi)}
+		}
+		if len(v.Operands) == 0 {
+			return fullInterval
+		}
+		result := evalInterval(v.Operands[0], domains)
+		for _, operand := range v.Operands[1:] {
+			result = applyInterval(v.Op, result, evalInterval(operand, domains))
+		}
+		return result
+	default:
+		return fullInterval
+	}
+}
+
+func notInterval(a interval) interval {
+	switch {
+	case a.empty():
+		return emptyInterval
+	case a.definitelyTrue():
+		return falseInterval
+	case a.definitelyFalse():
+		return trueInterval
+	default:
+		return boolInterval
+	}
+}
+
+func boolResult(isTrue, isFalse bool) interval {
+	switch {
+	case isTrue:
+		return trueInterval
+	case isFalse:
+		return falseInterval
+	default:
+		return boolInterval
+	}
+}
+
+// applyInterval は、二項演算の結果の区間を返します。
+func applyInterval(op string, a, b interval) interval {
+	if a.empty() || b.empty() {
+		return emptyInterval
+	}
+	// 両辺が具体値の場合は、桁あふれによる折り返しも含めて実行器と同じ値を求める
+	if a.singleton() && b.singleton() {
+		if v, err := computeConcrete(op, []interface{}{a.lo, b.lo}); err == nil {
+			return interval{v, v}
+		}
+	}
+	switch op {
+	case "+":
+		lo, okLo := checkedAdd(a.lo, b.lo)
+		hi, okHi := checkedAdd(a.hi, b.hi)
+		if !okLo || !okHi {
+			return fullInterval
+		}
+		return interval{lo, hi}
+	case "-":
+		lo, okLo := checkedSub(a.lo, b.hi)
+		hi, okHi := checkedSub(a.hi, b.lo)
+		if !okLo || !okHi {
+			return fullInterval
+		}
+		return interval{lo, hi}
+	case "*":
+		if mulOverflows(a, b) {
+			return fullInterval
+		}
+		return corners(a, b, func(x, y int) int { return x * y })
+	case "/":
+		// MinInt64 / -1 は MinInt64 に折り返す
+		if a.lo == math.MinInt64 && b.contains(-1) {
+			return fullInterval
+		}
+		// 0 による除算を除いた符号ごとの端点から求める
+		result := emptyInterval
+		for _, part := range []interval{b.intersect(interval{math.MinInt64, -1}), b.intersect(interval{1, math.MaxInt64})} {
+			if part.empty() {
+				continue
+			}
+			q := corners(a, part, func(x, y int) int { return x / y })
+			if result.empty() {
+				result = q
+			} else {
+				result = interval{min(result.lo, q.lo), max(result.hi, q.hi)}
+			}
+		}
+		return result
+	case "%":
+		bound := max(satNeg(b.lo), b.hi)
+		if b == falseInterval {
+			return emptyInterval
+		}
+		limit := satSub(bound, 1)
+		if b.lo == math.MinInt64 {
+			// |x % MinInt64| は MaxInt64 に達し得る
+			limit = math.MaxInt64
+		}
+		switch {
+		case a.lo >= 0:
+			return interval{0, min(a.hi, limit)}
+		case a.hi <= 0:
+			return interval{max(a.lo, satNeg(limit)), 0}
+		default:
+			return interval{satNeg(limit), limit}
+		}
+	case "==":
+		return boolResult(a.singleton() && b.singleton() && a.lo == b.lo, a.intersect(b).empty())
+	case "!=":
+		return boolResult(a.intersect(b).empty(), a.singleton() && b.singleton() && a.lo == b.lo)
+	case "<":
+		return boolResult(a.hi < b.lo, a.lo >= b.hi)
+	case "<=":
+		return boolResult(a.hi <= b.lo, a.lo > b.hi)
+	case ">":
+		return boolResult(a.lo > b.hi, a.hi <= b.lo)
+	case ">=":
+		return boolResult(a.lo >= b.hi, a.hi < b.lo)
+	case "&&":
+		return boolResult(a.definitelyTrue() && b.definitelyTrue(), a.definitelyFalse() || b.definitelyFalse())
+	case "||":
+		return boolResult(a.definitelyTrue() || b.definitelyTrue(), a.definitelyFalse() && b.definitelyFalse())
+	default:
+		// その他の演算子は具体値の場合のみ計算する
+		if a.singleton() && b.singleton() {
+			result, err := computeConcrete(op, []interface{}{a.lo, b.lo})
+			if err != nil {
+				return emptyInterval
+			}
+			return interval{result, result}
+		}
+		return fullInterval
+	}
+}
+
+// narrowTruth は、式が truth の真偽値をとるように domains を絞り込みます。矛盾した場合は false を返します。
+func narrowTruth(value interface{}, truth bool, domains map[string]interval) bool {
+	value = unwrapValue(value)
+	expr, ok := value.(SymbolicExpr)
+	if !ok || !isBooleanOp(expr.Op) {
+		if !truth {
+			return narrow(value, falseInterval, domains)
+		}
+		current := evalInterval(value, domains)
+		switch {
+		case current.lo == 0:
+			return narrow(value, interval{1, math.MaxInt64}, domains)
+		case current.hi == 0:
+			return narrow(value, interval{math.MinInt64, -1}, domains)
+		}
+		return !current.empty() && current != falseInterval
+	}
+
+	if expr.Op == "!" && len(expr.Operands) == 1 {
+		return narrowTruth(expr.Operands[0], !truth, domains)
+	}
+
+	switch expr.Op {
+	case "&&", "||":
+		// && が真、|| が偽の場合はすべてのオペランドが同じ真偽値をとる
+		all := expr.Op == "&&"
+		if truth == all {
+			for _, operand := range expr.Operands {
+				if !narrowTruth(operand, truth, domains) {
+					return false
+				}
+			}
+			return true
+		}
+		// それ以外は、決まっていないオペランドが 1 つだけの場合に絞り込める
+		var undecided []interface{}
+		for _, operand := range expr.Operands {
+			value := evalInterval(operand, domains)
+			if (all && value.definitelyTrue()) || (!all && value.definitelyFalse()) {
+				continue
+			}
+			undecided = append(undecided, operand)
+		}
+		switch len(undecided) {
+		case 0:
+			return false
+		case 1:
+			return narrowTruth(undecided[0], truth, domains)
+		}
+		return true
+	}
+
+	if len(expr.Operands) != 2 {
+		return !evalInterval(value, domains).empty()
+	}
+	left, right := expr.Operands[0], expr.Operands[1]
+
+	op := expr.Op
+	if !truth {
+		op = map[string]string{"==": "!=", "!=": "==", "<": ">=", ">=": "<", ">": "<=", "<=": ">"}[op]
+	}
+	// a > b は b < a として扱う
+	if op == ">" || op == ">=" {
+		left, right = right, left
+		op = map[string]string{">": "<", ">=": "<="}[op]
+	}
+
+	l := evalInterval(left, domains)
+	r := evalInterval(right, domains)
+	switch op {
+	case "==":
+		return narrow(left, r, domains) && narrow(right, evalInterval(left, domains), domains)
+	case "!=":
+		return narrowNotEqual(left, l, r, domains) && narrowNotEqual(right, r, l, domains)
+	case "<":
+		if r.hi == math.MinInt64 {
+			return false
+		}
+		if !narrow(left, interval{math.MinInt64, r.hi - 1}, domains) {
+			return false
+		}
+		if l = evalInterval(left, domains); l.lo == math.MaxInt64 {
+			return false
+		}
+		return narrow(right, interval{l.lo + 1, math.MaxInt64}, domains)
+	default: // "<="
+		return narrow(left, interval{math.MinInt64, r.hi}, domains) &&
+			narrow(right, interval{evalInterval(left, domains).lo, math.MaxInt64}, domains)
+	}
+}
+
+// narrowNotEqual は、other が一点のとき、その値を self の区間の端から取り除きます。
+func narrowNotEqual(self interface{}, current, other interval, domains map[string]interval) bool {
+	if !other.singleton() {
+		return true
+	}
+	switch {
+	case current.singleton() && current.lo == other.lo:
+		return false
+	case current.lo == other.lo:
+		return narrow(self, interval{satAdd(current.lo, 1), current.hi}, domains)
+	case current.hi == other.lo:
+		return narrow(self, interval{current.lo, satSub(current.hi, 1)}, domains)
+	}
+	return true
+}
+
+// narrow は、式の値が required に含まれるように domains を絞り込みます。矛盾した場合は false を返します。
+func narrow(value interface{}, required interval, domains map[string]interval) bool {
+	value = unwrapValue(value)
+	current := evalInterval(value, domains)
+	if current.intersect(required).empty() {
+		return false
+	}
+
+	switch v := value.(type) {
+	case string:
+		if d, ok := domains[v]; ok {
+			domains[v] = d.intersect(required)
+		}
+		return true
+	case SymbolicExpr:
+		if v.Op == "symbol" {
+			return narrow(v.Operands[0], required, domains)
+		}
+		if isBooleanOp(v.Op) {
+			required = required.intersect(boolInterval)
+			switch {
+			case required.empty():
+				return false
+			case required == trueInterval:
+				return narrowTruth(v, true, domains)
+			case required == falseInterval:
+				return narrowTruth(v, false, domains)
+			}
+			return true
+		}
+		if len(v.Operands) != 2 {
+			return true
+		}
+		left, right := v.Operands[0], v.Operands[1]
+		l := evalInterval(left, domains)
+		r := evalInterval(right, domains)
+		switch v.Op {
+		case "+":
+			return narrow(left, applyInterval("-", required, r), domains) &&
+				narrow(right, applyInterval("-", required, evalInterval(left, domains)), domains)
+		case "-":
+			return narrow(left, applyInterval("+", required, r), domains) &&
+				narrow(right, applyInterval("-", evalInterval(left, domains), required), domains)
+		case "*":
+			// 折り返し得る場合は c*x の値から x を一つの区間に絞り込めない
+			if mulOverflows(l, r) {
+				return true
+			}
+			if r.singleton() && r.lo != 0 {
+				return narrow(left, divideInterval(required, r.lo), domains)
+			}
+			if l.singleton() && l.lo != 0 {
+				return narrow(right, divideInterval(required, l.lo), domains)
+			}
+		}
+	}
+	return true
+}
+
+// divideInterval は、c*x が required に含まれるような x の区間を返します (c != 0)。
+func divideInterval(required interval, c int) interval {
+	if c == math.MinInt64 {
+		return fullInterval
+	}
+	lo, hi := required.lo, required.hi
+	if c < 0 {
+		lo, hi = satNeg(hi), satNeg(lo)
+		c = -c
+	}
+	result := fullInterval
+	if lo != math.MinInt64 {
+		result.lo = ceilDiv(lo, c)
+	}
+	if hi != math.MaxInt64 {
+		result.hi = floorDiv(hi, c)
+	}
+	return result
+}
@@ -0,0 +1,186 @@
+package executor
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// linearForm は、Σ coeffs[x]*x + constant の形の一次式を表す構造体
+// 係数と定数は、実行器の int と同じく 2^64 を法とする値として扱います。
+type linearForm struct {
+	coeffs   map[string]uint64
+	constant uint64
+}
+
+func newLinearForm() linearForm {
+	return linearForm{coeffs: make(map[string]uint64)}
+}
+
+// addScaled は、l に k*other を加えた一次式を返します。
+func (l linearForm) addScaled(other linearForm, k uint64) linearForm {
+	result := newLinearForm()
+	for name, c := range l.coeffs {
+		result.coeffs[name] = c
+	}
+	for name, c := range other.coeffs {
+		sum := result.coeffs[name] + c*k
+		if sum == 0 {
+			delete(result.coeffs, name)
+		} else {
+			result.coeffs[name] = sum
+		}
+	}
+	result.constant = l.constant + other.constant*k
+	return result
+}
+
+// linearize は、式を一次式に変換します。
+// 一次式でない部分式 (x*y や ite など) は、その式を表す一つの変数 (opaqueTerm) として扱います。
+// 同じ部分式は常に同じ値をとるため、この緩和のもとで解がなければ元の制約にも解はありません。
+func linearize(value interface{}) linearForm {
+	switch v := unwrapValue(value).(type) {
+	case int:
+		l := newLinearForm()
+		l.constant = uint64(v)
+		return l
+	case string:
+		l := newLinearForm()
+		l.coeffs[v] = 1
+		return l
+	case SymbolicExpr:
+		if v.Op == "symbol" {
+			return linearize(v.Operands[0])
+		}
+		if v.Op == "neg" && len(v.Operands) == 1 {
+			return newLinearForm().addScaled(linearize(v.Operands[0]), minusOne)
+		}
+		if len(v.Operands) < 2 || (v.Op != "+" && v.Op != "-" && v.Op != "*") {
+			return opaqueTerm(v)
+		}
+		// 平坦化された式 (a + b + c) は左から順に結合する
+		result := linearize(v.Operands[0])
+		for _, operand := range v.Operands[1:] {
+			right := linearize(operand)
+			switch v.Op {
+			case "+":
+				result = result.addScaled(right, 1)
+			case "-":
+				result = result.addScaled(right, minusOne)
+			default: // "*"
+				// 片方が定数の場合のみ一次式になる
+				switch {
+				case len(right.coeffs) == 0:
+					result = newLinearForm().addScaled(result, right.constant)
+				case len(result.coeffs) == 0:
+					result = newLinearForm().addScaled(right, result.constant)
+				default:
+					return opaqueTerm(v)
+				}
+			}
+		}
+		return result
+	}
+	return opaqueTerm(value)
+}
+
+// opaqueTerm は、式 value を一つの変数とみなした一次式を返します。
+// 変数名は式の文字列表現に、シンボル名と重ならないよう "#" を付けたものです。
+func opaqueTerm(value interface{}) linearForm {
+	l := newLinearForm()
+	l.coeffs["#"+formatValue(value)] = 1
+	return l
+}
+
+// minusOne は、2^64 を法とする -1
+const minusOne = ^uint64(0)
+
+// inverse は、奇数 a の 2^64 を法とする逆元を返します。
+func inverse(a uint64) uint64 {
+	// ニュートン法で正しいビット数が各回 2 倍になる (a*a ≡ 1 mod 8 から始めて 3, 6, ..., 96 ビット)
+	x := a
+	for i := 0; i < 5; i++ {
+		x *= 2 - a*x
+	}
+	return x
+}
+
+// conjuncts は、&& で結合された制約を個々の制約に分解します。
+func conjuncts(value interface{}) []interface{} {
+	value = unwrapValue(value)
+	if expr, ok := value.(SymbolicExpr); ok && expr.Op == "&&" {
+		var result []interface{}
+		for _, operand := range expr.Operands {
+			result = append(result, conjuncts(operand)...)
+		}
+		return result
+	}
+	return []interface{}{value}
+}
+
+// linearRelationsInconsistent は、比較の原子式 atoms のうち一次の等式を 2^64 を法としてガウスの消去法で解き、
+// 等式だけで解を持たない場合や、等式から a == b が導かれるのに a != b が含まれる場合に true を返します。
+// 行に別の行の定数倍を加えても解の集合は変わらないため、2^64 を法としても Unsat の判定は正しいです。
+func linearRelationsInconsistent(atoms []comparison) bool {
+	var rows, disequalities []linearForm
+	for _, atom := range atoms {
+		switch atom.op {
+		case "==":
+			rows = append(rows, linearize(atom.left).addScaled(linearize(atom.right), minusOne))
+		case "!=":
+			disequalities = append(disequalities, linearize(atom.left).addScaled(linearize(atom.right), minusOne))
+		}
+	}
+
+	pivots := make([]string, len(rows))
+	for i := range rows {
+		// 名前順で最初の奇数 (2^64 を法として逆元を持つ) の係数を持つ変数を軸にして、他の行から消去する
+		names := make([]string, 0, len(rows[i].coeffs))
+		for name, c := range rows[i].coeffs {
+			if c%2 == 1 {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		sort.Strings(names)
+		pivots[i] = names[0]
+		pivotInverse := inverse(rows[i].coeffs[pivots[i]])
+		for j := range rows {
+			if j == i {
+				continue
+			}
+			if c, ok := rows[j].coeffs[pivots[i]]; ok {
+				rows[j] = rows[j].addScaled(rows[i], -(c * pivotInverse))
+			}
+		}
+	}
+	for _, row := range rows {
+		if !row.solvable() {
+			return true
+		}
+	}
+
+	// 軸の変数は自分の行にしか現れないので、各行で軸の変数を消去して 0 になる不等式は等式から常に偽になる
+	for _, d := range disequalities {
+		for i, row := range rows {
+			if c, ok := d.coeffs[pivots[i]]; ok && pivots[i] != "" {
+				d = d.addScaled(row, -(c * inverse(row.coeffs[pivots[i]])))
+			}
+		}
+		if len(d.coeffs) == 0 && d.constant == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// solvable は、一次式 = 0 が 2^64 を法として解を持つかどうかを返します。
+// Σ c*x ≡ -constant は、すべての係数の 2 の指数の最小値を k としたとき、constant が 2^k で割り切れる場合に限り解を持ちます。
+func (l linearForm) solvable() bool {
+	zeros := 64
+	for _, c := range l.coeffs {
+		zeros = min(zeros, bits.TrailingZeros64(c))
+	}
+	return bits.TrailingZeros64(l.constant) >= zeros
+}
@@ -0,0 +1,217 @@
+package executor
+
+// comparison は、制約から取り出した left op right の形の比較を表す構造体 (op は "==", "!=", "<", "<=" のいずれか)
+type comparison struct {
+	op          string
+	left, right interface{}
+}
+
+// maxIteSplits は、relationsInconsistent が ite を条件で場合分けする深さの上限です。
+const maxIteSplits = 6
+
+// relationsInconsistent は、制約に含まれる比較の間の関係だけから矛盾が導けるかどうかを返します。
+// 制約に ite が含まれる場合は、条件が成り立つ場合と成り立たない場合に分けて、両方が矛盾するかを調べます
+// (シンボリックなアドレスからの読み取りで作られる ite など)。
+func relationsInconsistent(constraints []interface{}) bool {
+	return iteCasesInconsistent(constraints, maxIteSplits)
+}
+
+// iteCasesInconsistent は、constraints に含まれる ite を depth 回まで場合分けし、どの場合も矛盾するかどうかを返します。
+// 上限を超えて残った ite は、中身の分からない項として扱います。
+func iteCasesInconsistent(constraints []interface{}, depth int) bool {
+	if depth > 0 {
+		if cond, ok := findIte(constraints); ok {
+			for _, truth := range []bool{true, false} {
+				cases := []interface{}{cond.Operands[0]}
+				if !truth {
+					cases[0] = SymbolicExpr{Op: "!", Operands: []interface{}{cond.Operands[0]}}
+				}
+				branch := cond.Operands[2]
+				if truth {
+					branch = cond.Operands[1]
+				}
+				for _, c := range constraints {
+					cases = append(cases, replaceExpr(c, cond, branch))
+				}
+				if !iteCasesInconsistent(cases, depth-1) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return comparisonsInconsistent(constraints)
+}
+
+// findIte は、constraints に含まれる最初の ite 式を返します。
+func findIte(constraints []interface{}) (SymbolicExpr, bool) {
+	for _, c := range constraints {
+		expr, ok := unwrapValue(c).(SymbolicExpr)
+		if !ok {
+			continue
+		}
+		if expr.Op == "ite" && len(expr.Operands) == 3 {
+			return expr, true
+		}
+		if found, ok := findIte(expr.Operands); ok {
+			return found, true
+		}
+	}
+	return SymbolicExpr{}, false
+}
+
+// replaceExpr は、value に含まれる target と構造的に等しい部分式をすべて replacement に置き換えた値を返します。
+func replaceExpr(value interface{}, target SymbolicExpr, replacement interface{}) interface{} {
+	expr, ok := unwrapValue(value).(SymbolicExpr)
+	if !ok {
+		return value
+	}
+	if CompareSymbolicExpr(expr, target) {
+		return replacement
+	}
+	operands := make([]interface{}, len(expr.Operands))
+	for i, operand := range expr.Operands {
+		operands[i] = replaceExpr(operand, target, replacement)
+	}
+	return SymbolicExpr{Op: expr.Op, Operands: operands}
+}
+
+// comparisonsInconsistent は、ite を含まない制約について relationsInconsistent と同じ判定を行います。
+// && で結合された || は、どの選択肢を加えても矛盾する場合に矛盾とみなします (自己合成の「いずれかの観測が異なる」条件など)。
+func comparisonsInconsistent(constraints []interface{}) bool {
+	var base []interface{}
+	var disjunctions []SymbolicExpr
+	for _, c := range constraints {
+		for _, atom := range conjuncts(c) {
+			if expr, ok := atom.(SymbolicExpr); ok && expr.Op == "||" {
+				disjunctions = append(disjunctions, expr)
+			} else {
+				base = append(base, atom)
+			}
+		}
+	}
+
+	atoms := comparisonAtoms(base)
+	if atomsInconsistent(atoms) {
+		return true
+	}
+	for _, disjunction := range disjunctions {
+		refuted := true
+		for _, option := range disjunction.Operands {
+			if !atomsInconsistent(append(comparisonAtoms([]interface{}{option}), atoms...)) {
+				refuted = false
+				break
+			}
+		}
+		if refuted {
+			return true
+		}
+	}
+	return false
+}
+
+// atomsInconsistent は、比較の組が一次の等式・不等式または順序の関係から矛盾するかどうかを返します。
+func atomsInconsistent(atoms []comparison) bool {
+	return linearRelationsInconsistent(atoms) || orderInconsistent(atoms)
+}
+
+// comparisonAtoms は、&& で結合された制約を比較の原子式に分解します。
+// !, >, >= と、比較の結果と 0 の比較 ((a < b) == 0 など) は、== != < <= のいずれかに正規化します。
+func comparisonAtoms(constraints []interface{}) []comparison {
+	var atoms []comparison
+	for _, c := range constraints {
+		for _, atom := range conjuncts(c) {
+			if cmp, ok := toComparison(atom, true); ok {
+				atoms = append(atoms, cmp)
+			}
+		}
+	}
+	return atoms
+}
+
+// toComparison は、value が truth であるという制約を比較に変換します。比較として表せない場合は false を返します。
+func toComparison(value interface{}, truth bool) (comparison, bool) {
+	value = unwrapValue(value)
+	expr, ok := value.(SymbolicExpr)
+	if !ok || !isBooleanOp(expr.Op) {
+		// 比較でない値は value != 0 (偽の場合は value == 0) として扱う
+		if truth {
+			return comparison{op: "!=", left: value, right: 0}, true
+		}
+		return comparison{op: "==", left: value, right: 0}, true
+	}
+	if expr.Op == "!" && len(expr.Operands) == 1 {
+		return toComparison(expr.Operands[0], !truth)
+	}
+	if len(expr.Operands) != 2 || expr.Op == "&&" || expr.Op == "||" {
+		return comparison{}, false
+	}
+	left, right := expr.Operands[0], expr.Operands[1]
+
+	// (a < b) == 0 は a < b が偽、(a < b) != 0 は a < b が真であることを表す
+	if zero, ok := unwrapValue(right).(int); ok && zero == 0 && (expr.Op == "==" || expr.Op == "!=") {
+		if inner, ok := unwrapValue(left).(SymbolicExpr); ok && isBooleanOp(inner.Op) {
+			return toComparison(inner, truth == (expr.Op == "!="))
+		}
+	}
+
+	op := expr.Op
+	if !truth {
+		op = map[string]string{"==": "!=", "!=": "==", "<": ">=", ">=": "<", ">": "<=", "<=": ">"}[op]
+	}
+	// a > b は b < a として扱う
+	if op == ">" || op == ">=" {
+		left, right = right, left
+		op = map[string]string{">": "<", ">=": "<="}[op]
+	}
+	return comparison{op: op, left: left, right: right}, true
+}
+
+// orderInconsistent は、atoms の ==, <, <= を項の間の順序関係とみなし、
+// a < ... <= a のように狭義の不等号を含む循環がある場合に true を返します。
+// 比較は符号付き整数の比較で推移的なため、同じ式 (文字列表現が等しい項) を一つの点として扱えます。
+func orderInconsistent(atoms []comparison) bool {
+	// edges[a] は、a <= b (strict の場合は a < b) となる項 b の一覧
+	type edge struct {
+		to     string
+		strict bool
+	}
+	edges := make(map[string][]edge)
+	for _, atom := range atoms {
+		left, right := formatValue(unwrapValue(atom.left)), formatValue(unwrapValue(atom.right))
+		switch atom.op {
+		case "==":
+			edges[left] = append(edges[left], edge{to: right})
+			edges[right] = append(edges[right], edge{to: left})
+		case "<":
+			edges[left] = append(edges[left], edge{to: right, strict: true})
+		case "<=":
+			edges[left] = append(edges[left], edge{to: right})
+		}
+	}
+
+	// 狭義の辺 a < b ごとに、b から a に戻れるかを調べる
+	for from, out := range edges {
+		for _, e := range out {
+			if !e.strict {
+				continue
+			}
+			visited := map[string]bool{e.to: true}
+			stack := []string{e.to}
+			for len(stack) > 0 {
+				node := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if node == from {
+					return true
+				}
+				for _, next := range edges[node] {
+					if !visited[next.to] {
+						visited[next.to] = true
+						stack = append(stack, next.to)
+					}
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package executor_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/taisii/go-project/assembler"
+	"github.com/taisii/go-project/executor"
+)
+
+func sym(name string) executor.SymbolicExpr {
+	return executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{name}}
+}
+
+func bin(op string, left, right interface{}) executor.SymbolicExpr {
+	return executor.SymbolicExpr{Op: op, Operands: []interface{}{left, right}}
+}
+
+func TestSolve(t *testing.T) {
+	testCases := []struct {
+		Name           string
+		Constraint     executor.SymbolicExpr
+		ExpectedResult executor.SolveResult
+		ExpectedModel  executor.Model // nil の場合はモデルを確認しない
+	}{
+		{
+			Name:           "Empty path condition",
+			Constraint:     executor.SymbolicExpr{},
+			ExpectedResult: executor.Sat,
+			ExpectedModel:  executor.Model{},
+		},
+		{
+			Name:           "Contradiction",
+			Constraint:     bin("&&", bin("==", sym("x"), 0), bin("!=", sym("x"), 0)),
+			ExpectedResult: executor.Unsat,
+		},
+		{
+			Name:           "Lower bound",
+			Constraint:     bin(">", sym("x"), 5),
+			ExpectedResult: executor.Sat,
+			ExpectedModel:  executor.Model{"x": 6},
+		},
+		{
+			Name:           "Linear equation",
+			Constraint:     bin("==", bin("*", bin("+", sym("x"), 3), 2), 10),
+			ExpectedResult: executor.Sat,
+			ExpectedModel:  executor.Model{"x": 2},
+		},
+		{
+			Name:           "Linear equation without integer solution",
+			Constraint:     bin("==", bin("*", sym("x"), 2), 7),
+			ExpectedResult: executor.Unsat,
+		},
+		{
+			Name: "Chain of comparisons",
+			Constraint: bin("&&", bin("&&", bin("<", sym("x"), sym("y")), bin("<", sym("y"), 3)),
+				bin(">", sym("x"), 0)),
+			ExpectedResult: executor.Sat,
+			ExpectedModel:  executor.Model{"x": 1, "y": 2},
+		},
+		{
+			Name:           "Negated comparison from beqz",
+			Constraint:     bin("==", bin("<", sym("x"), 5), 0),
+			ExpectedResult: executor.Sat,
+			ExpectedModel:  executor.Model{"x": 5},
+		},
+		{
+			Name:           "Nonlinear",
+			Constraint:     bin("&&", bin("==", bin("*", sym("x"), sym("y")), 6), bin(">", sym("x"), 2)),
+			ExpectedResult: executor.Sat,
+			ExpectedModel:  executor.Model{"x": 3, "y": 2},
+		},
+		{
+			Name:           "Division by zero",
+			Constraint:     bin("==", bin("/", sym("x"), 0), 1),
+			ExpectedResult: executor.Unsat,
+		},
+		{
+			Name:           "Symbolic divisor",
+			Constraint:     bin("==", bin("%", sym("a"), sym("d")), sym("a")),
+			ExpectedResult: executor.Sat,
+			ExpectedModel:  executor.Model{"a": 0, "d": 1},
+		},
+		{
+			Name:           "Equal and not equal",
+			Constraint:     bin("&&", bin("==", sym("x"), sym("y")), bin("!=", sym("x"), sym("y"))),
+			ExpectedResult: executor.Unsat,
+		},
+		{
+			Name:           "Cyclic strict order",
+			Constraint:     bin("&&", bin("<", sym("x"), sym("y")), bin("<", sym("y"), sym("x"))),
+			ExpectedResult: executor.Unsat,
+		},
+		{
+			Name: "Self-composed nonlinear observation",
+			Constraint: bin("&&", bin("==", bin("*", sym("k"), sym("k")), bin("*", sym("k'"), sym("k'"))),
+				executor.SymbolicExpr{Op: "!", Operands: []interface{}{bin("==", bin("+", bin("*", sym("k"), sym("k")), 1), bin("+", bin("*", sym("k'"), sym("k'")), 1))}}),
+			ExpectedResult: executor.Unsat,
+		},
+		{
+			Name:           "Order through an equality",
+			Constraint:     bin("&&", bin("&&", bin("<", sym("x"), sym("y")), bin("==", sym("y"), sym("z"))), bin(">=", sym("x"), sym("z"))),
+			ExpectedResult: executor.Unsat,
+		},
+		{
+			Name: "Every option of a disjunction contradicts",
+			Constraint: bin("&&", bin("&&", bin("==", sym("a"), sym("a'")), bin("==", sym("b"), sym("b'"))),
+				bin("||", bin("!=", sym("a"), sym("a'")), bin("!=", sym("b"), sym("b'")))),
+			ExpectedResult: executor.Unsat,
+		},
+		{
+			Name:           "Chain of variable comparisons",
+			Constraint:     bin("&&", bin("<", sym("x"), sym("y")), bin("<", sym("y"), sym("z"))),
+			ExpectedResult: executor.Sat,
+		},
+		{
+			Name:           "Bound beyond 32 bits",
+			Constraint:     bin(">", sym("a"), 3000000000),
+			ExpectedResult: executor.Sat,
+			ExpectedModel:  executor.Model{"a": 3000000001},
+		},
+		{
+			Name:           "Multiplication wraps around like int",
+			Constraint:     bin("&&", bin("==", bin("*", sym("x"), 2), 0), bin("==", sym("x"), math.MinInt64)),
+			ExpectedResult: executor.Sat,
+			ExpectedModel:  executor.Model{"x": math.MinInt64},
+		},
+		{
+			Name:           "Contradiction through arithmetic",
+			Constraint:     bin("&&", bin("==", bin("+", sym("x"), 1), sym("y")), bin("==", bin("-", sym("y"), sym("x")), 2)),
+			ExpectedResult: executor.Unsat,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			result, model := executor.Solve(testCase.Constraint)
+			if result != testCase.ExpectedResult {
+				t.Fatalf("expected %v, but got %v", testCase.ExpectedResult, result)
+			}
+			if testCase.ExpectedModel == nil {
+				return
+			}
+			if len(model) != len(testCase.ExpectedModel) {
+				t.Fatalf("expected model %v, but got %v", testCase.ExpectedModel, model)
+			}
+			for name, value := range testCase.ExpectedModel {
+				if model[name] != value {
+					t.Errorf("expected model %v, but got %v", testCase.ExpectedModel, model)
+				}
+			}
+		})
+	}
+}
+
+func TestExecutePrunesInfeasibleBranches(t *testing.T) {
+	program := []assembler.OpCode{
+		{Mnemonic: "beqz", Operands: []string{"x", "4"}},
+		{Mnemonic: "beqz", Operands: []string{"x", "3"}}, // x != 0 なので分岐しない
+		{Mnemonic: "mov", Operands: []string{"y", "1"}},
+		{Mnemonic: "jmp", Operands: []string{"5"}},
+		{Mnemonic: "mov", Operands: []string{"y", "2"}},
+	}
+
+	finalConfigs, err := executor.ExecuteProgram(program, &executor.Configuration{Registers: map[string]interface{}{}}, 20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(finalConfigs) != 2 {
+		t.Fatalf("expected 2 feasible paths, but got %d", len(finalConfigs))
+	}
+	for _, conf := range finalConfigs {
+		model, ok := executor.Witness(*conf)
+		if !ok {
+			t.Fatalf("expected a witness for path condition %v", conf.Trace.PathCond)
+		}
+		wantY := 1
+		if model["x"] == 0 {
+			wantY = 2
+		}
+		if conf.Registers["y"] != wantY {
+			t.Errorf("witness x=%d does not lead to y=%v", model["x"], conf.Registers["y"])
+		}
+	}
+}
+
+func TestExecuteKeepsBranchesBeyond32Bits(t *testing.T) {
+	asm, err := assembler.ParseAsm(strings.NewReader("    x <- a > 3000000000\n    beqz x, L\n    y <- 1\nL:\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	finalConfigs, err := executor.RunAssembler(asm, &executor.Configuration{Registers: map[string]interface{}{}}, 20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(finalConfigs) != 2 {
+		t.Fatalf("expected 2 feasible paths, but got %d", len(finalConfigs))
+	}
+}
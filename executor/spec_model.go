@@ -0,0 +1,169 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/taisii/go-project/assembler"
+)
+
+// Successor は、命令を一つ実行した後の遷移先を表す構造体
+type Successor struct {
+	Conf *Configuration // 遷移先の状態
+	// Correct は、Conf が投機的な遷移先の場合に、ロールバック後に再開する正しい状態です。
+	// nil の場合、Conf は投機を伴わない通常の遷移先です。
+	Correct *Configuration
+	// Barrier は、命令が投機を止めるバリアであることを表します。
+	// 投機中に Barrier の遷移先が返された場合、実行ループは遷移せずに現在の投機のウィンドウを 0 にし、ロールバックします。
+	// 非投機的な実行では通常の遷移先として扱います。
+	Barrier bool
+}
+
+// Speculative は、遷移先が投機を開始するかどうかを返します。
+func (s Successor) Speculative() bool {
+	return s.Correct != nil
+}
+
+// SpecContext は、SpeculationModel に渡す実行パスの情報を表す構造体
+type SpecContext struct {
+	Depth          int // 現在の投機の入れ子の深さ (非投機的な実行では 0)
+	Mispredictions int // このパスでこれまでに開始した投機の数 (ロールバックしたものを含む)
+}
+
+// SpeculationModel は、投機実行で各命令がどの遷移先を生むかを決めるインターフェース
+// SpecExecute の実行ループは、このインターフェースを通してのみ命令を実行します。
+// 投機的な遷移先にはロールバック後に再開する正しい状態を対にして返すため、
+// 実行ループは正しい遷移先を別の関数で求める必要がありません。
+type SpeculationModel interface {
+	// Successors は、conf で inst を実行した後の遷移先を返します。conf は変更しません。
+	Successors(inst assembler.Stmt, conf *Configuration, ctx SpecContext) ([]Successor, error)
+}
+
+// NeverMispredict は、投機を行わず Step と同じ遷移先を返すモデル
+// spbarr の遷移先は Barrier とします。
+type NeverMispredict struct{}
+
+func (NeverMispredict) Successors(inst assembler.Stmt, conf *Configuration, ctx SpecContext) ([]Successor, error) {
+	confs, err := step(inst, conf)
+	if err != nil {
+		return nil, err
+	}
+	successors := make([]Successor, len(confs))
+	for i, c := range confs {
+		successors[i] = Successor{Conf: c, Barrier: isBarrier(inst)}
+	}
+	return successors, nil
+}
+
+// isBarrier は、inst が投機を止めるバリア (spbarr) かどうかを返します。
+func isBarrier(inst assembler.Stmt) bool {
+	_, ok := inst.(assembler.Spbarr)
+	return ok
+}
+
+// AlwaysMispredict は、すべての beqz を誤って予測するモデル (Spectector の always-mispredict セマンティクス)
+// 条件がシンボリックな場合は、条件が成り立つ場合と成り立たない場合の両方で誤った方向に進みます。
+type AlwaysMispredict struct{}
+
+func (AlwaysMispredict) Successors(inst assembler.Stmt, conf *Configuration, ctx SpecContext) ([]Successor, error) {
+	beqz, ok := inst.(assembler.Beqz)
+	if !ok {
+		return NeverMispredict{}.Successors(inst, conf, ctx)
+	}
+	target, err := evalAST(beqz.Target, conf)
+	if err != nil {
+		return nil, err
+	}
+	targetPC, err := jumpAddress(target)
+	if err != nil {
+		return nil, err
+	}
+	reg, err := evalAST(beqz.Cond, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	var outcomes []bool // 実際に分岐するかどうか
+	switch condValue := reg.(type) {
+	case int:
+		outcomes = []bool{condValue == 0}
+	case SymbolicExpr:
+		outcomes = []bool{true, false}
+	default:
+		return nil, fmt.Errorf("unexpected type for condition: %T", condValue)
+	}
+
+	var successors []Successor
+	for _, taken := range outcomes {
+		successors = append(successors, Successor{
+			Conf:    branchSuccessor(conf, reg, targetPC, taken, !taken),
+			Correct: branchSuccessor(conf, reg, targetPC, taken, taken),
+		})
+	}
+	return successors, nil
+}
+
+// branchSuccessor は、条件 reg == 0 が taken のときに、follow の方向へ進んだ beqz の遷移先を返します。
+// パス条件には実際の条件を、観測には進んだ方向の条件を記録します。
+func branchSuccessor(conf *Configuration, reg interface{}, targetPC int, taken bool, follow bool) *Configuration {
+	next := copyConfiguration(*conf)
+	op, observed := "!=", "!="
+	if taken {
+		op = "=="
+	}
+	if follow {
+		observed = "=="
+		next.PC = targetPC
+	} else {
+		next.PC++
+	}
+	next.Trace.PathCond = updatePathCond(next.Trace.PathCond, op, reg)
+	next.Trace.Observations = append(next.Trace.Observations, Observation{
+		PC:    conf.PC,
+		Type:  ObsTypePC,
+		Value: SymbolicExpr{Op: observed, Operands: []interface{}{reg, 0}},
+	})
+	return &next
+}
+
+// BoundedMispredict は、投機の入れ子の深さが MaxDepth 未満の場合だけ beqz を誤って予測するモデル
+// MaxDepth が 1 の場合、投機中の分岐は正しく予測されます。
+type BoundedMispredict struct {
+	MaxDepth int
+}
+
+func (m BoundedMispredict) Successors(inst assembler.Stmt, conf *Configuration, ctx SpecContext) ([]Successor, error) {
+	if ctx.Depth < m.MaxDepth {
+		return AlwaysMispredict{}.Successors(inst, conf, ctx)
+	}
+	return NeverMispredict{}.Successors(inst, conf, ctx)
+}
+
+// MispredictionBudget は、各実行パスで開始する投機を Max 回までに制限するモデル
+// 予算が残っている間は、Model が投機を開始する命令で正しく予測する遷移先にも分岐するため、
+// 高々 Max 個の任意の命令の組を誤って予測するパスがすべて探索されます。
+// 予算を使い切った後の命令は、すべて正しい方向に進みます (NeverMispredict)。
+type MispredictionBudget struct {
+	Max   int
+	Model SpeculationModel // 予算が残っている間に使うモデル
+}
+
+func (m MispredictionBudget) Successors(inst assembler.Stmt, conf *Configuration, ctx SpecContext) ([]Successor, error) {
+	if ctx.Mispredictions >= m.Max {
+		return NeverMispredict{}.Successors(inst, conf, ctx)
+	}
+	successors, err := m.Model.Successors(inst, conf, ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, successor := range successors {
+		if successor.Speculative() {
+			// 予算を使わずに正しく予測する遷移先も加える
+			correct, err := NeverMispredict{}.Successors(inst, conf, ctx)
+			if err != nil {
+				return nil, err
+			}
+			return append(successors, correct...), nil
+		}
+	}
+	return successors, nil
+}
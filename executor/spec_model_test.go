@@ -0,0 +1,271 @@
+package executor_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/taisii/go-project/assembler"
+	"github.com/taisii/go-project/executor"
+)
+
+// firstBranchOnly は、PC 0 の分岐だけを誤って予測するテスト用のモデル
+type firstBranchOnly struct{}
+
+func (firstBranchOnly) Successors(inst assembler.Stmt, conf *executor.Configuration, ctx executor.SpecContext) ([]executor.Successor, error) {
+	if conf.PC == 0 {
+		return executor.AlwaysMispredict{}.Successors(inst, conf, ctx)
+	}
+	return executor.NeverMispredict{}.Successors(inst, conf, ctx)
+}
+
+func TestSpeculationModels(t *testing.T) {
+	// x, y はシンボリックなので、各分岐で両方向に進む
+	source := "    beqz x,L1\n    a<-1\nL1:\n    beqz y,L2\n    b<-1\nL2:\n"
+
+	testCases := []struct {
+		Name           string
+		Model          executor.SpeculationModel
+		ExpectedPaths  int
+		ExpectedStarts int // すべてのパスの start の観測の数
+		ExpectedDepth  int // 投機の入れ子の最大の深さ
+	}{
+		{Name: "Always mispredict", Model: executor.AlwaysMispredict{}, ExpectedPaths: 4, ExpectedStarts: 12, ExpectedDepth: 2},
+		{Name: "Never mispredict", Model: executor.NeverMispredict{}, ExpectedPaths: 4, ExpectedStarts: 0, ExpectedDepth: 0},
+		{Name: "Bounded mispredict", Model: executor.BoundedMispredict{MaxDepth: 1}, ExpectedPaths: 4, ExpectedStarts: 8, ExpectedDepth: 1},
+		{Name: "Custom model", Model: firstBranchOnly{}, ExpectedPaths: 4, ExpectedStarts: 4, ExpectedDepth: 1},
+		// 4 つの方向の組ごとに、誤って予測しない・1 つ目だけ・2 つ目だけを誤って予測するパスがある
+		{Name: "Misprediction budget", Model: executor.MispredictionBudget{Max: 1, Model: executor.AlwaysMispredict{}}, ExpectedPaths: 12, ExpectedStarts: 8, ExpectedDepth: 1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			asm, err := assembler.ParseAsm(strings.NewReader(source))
+			if err != nil {
+				t.Fatalf("failed to parse program: %v", err)
+			}
+			opts := executor.SpecOptions{Window: executor.UnitWindow(10), Model: testCase.Model}
+			finalConfigs, err := executor.SpecRunAssemblerWithOptions(asm, &executor.Configuration{}, 200, opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(finalConfigs) != testCase.ExpectedPaths {
+				t.Errorf("expected %d paths, got %d", testCase.ExpectedPaths, len(finalConfigs))
+			}
+
+			starts, maxDepth := 0, 0
+			for _, conf := range finalConfigs {
+				depth := 0
+				for _, obs := range conf.Trace.Observations {
+					switch obs.Type {
+					case executor.ObsTypeStart:
+						starts++
+						depth++
+						maxDepth = max(maxDepth, depth)
+					case executor.ObsTypeRollback:
+						depth--
+					}
+				}
+			}
+			if starts != testCase.ExpectedStarts {
+				t.Errorf("expected %d speculations, got %d", testCase.ExpectedStarts, starts)
+			}
+			if maxDepth != testCase.ExpectedDepth {
+				t.Errorf("expected maximum depth %d, got %d", testCase.ExpectedDepth, maxDepth)
+			}
+		})
+	}
+}
+
+func TestMaxMispredictions(t *testing.T) {
+	// 3 つのシンボリックな分岐を持つプログラム
+	source := "    beqz x,L1\n    a<-1\nL1:\n    beqz y,L2\n    b<-1\nL2:\n    beqz z,L3\n    c<-1\nL3:\n"
+
+	testCases := []struct {
+		Name              string
+		MaxMispredictions int
+		ExpectedPaths     int // 予算がある場合は、誤って予測する分岐の選び方ごとにパスが分かれる
+		ExpectedStarts    int // すべてのパスの start の観測の数
+	}{
+		{Name: "Unlimited", MaxMispredictions: 0, ExpectedPaths: 8, ExpectedStarts: 56},
+		{Name: "One misprediction", MaxMispredictions: 1, ExpectedPaths: 32, ExpectedStarts: 24},
+		{Name: "Two mispredictions", MaxMispredictions: 2, ExpectedPaths: 80, ExpectedStarts: 120},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			asm, err := assembler.ParseAsm(strings.NewReader(source))
+			if err != nil {
+				t.Fatalf("failed to parse program: %v", err)
+			}
+			opts := executor.SpecOptions{Window: executor.UnitWindow(10), MaxMispredictions: testCase.MaxMispredictions}
+			finalConfigs, err := executor.SpecRunAssemblerWithOptions(asm, &executor.Configuration{}, 500, opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(finalConfigs) != testCase.ExpectedPaths {
+				t.Errorf("expected %d paths, got %d", testCase.ExpectedPaths, len(finalConfigs))
+			}
+
+			starts := 0
+			for _, conf := range finalConfigs {
+				pathStarts := 0
+				for _, obs := range conf.Trace.Observations {
+					if obs.Type == executor.ObsTypeStart {
+						pathStarts++
+					}
+				}
+				if testCase.MaxMispredictions > 0 && pathStarts > testCase.MaxMispredictions {
+					t.Errorf("path mispredicted %d times, expected at most %d", pathStarts, testCase.MaxMispredictions)
+				}
+				starts += pathStarts
+			}
+			if starts != testCase.ExpectedStarts {
+				t.Errorf("expected %d speculations, got %d", testCase.ExpectedStarts, starts)
+			}
+		})
+	}
+}
+
+func TestAlwaysMispredictSuccessors(t *testing.T) {
+	program := []assembler.OpCode{{Mnemonic: "beqz", Operands: []string{"x", "5"}}}
+
+	testCases := []struct {
+		Name      string
+		Registers map[string]interface{}
+	}{
+		{Name: "Concrete taken", Registers: map[string]interface{}{"x": 0}},
+		{Name: "Concrete not taken", Registers: map[string]interface{}{"x": 1}},
+		{Name: "Symbolic", Registers: map[string]interface{}{}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			conf := &executor.Configuration{Registers: testCase.Registers, Memory: map[int]interface{}{}}
+			decoded, err := executor.DecodeInstruction(program[0])
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			successors, err := executor.AlwaysMispredict{}.Successors(decoded, conf, executor.SpecContext{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// 誤った遷移先は AlwaysMispredictStep と、正しい遷移先は Step と同じになる
+			mispredicted, isSpeculative, err := executor.AlwaysMispredictStep(program[0], conf)
+			if err != nil || !isSpeculative {
+				t.Fatalf("unexpected result of AlwaysMispredictStep: %v, %v", isSpeculative, err)
+			}
+			correct, err := executor.Step(program[0], conf)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(successors) != len(mispredicted) || len(successors) != len(correct) {
+				t.Fatalf("expected %d successors, got %d", len(mispredicted), len(successors))
+			}
+			for i, successor := range successors {
+				if !successor.Speculative() {
+					t.Errorf("successor %d is not speculative", i)
+					continue
+				}
+				if !executor.CompareConfiguration(*mispredicted[i], *successor.Conf) {
+					t.Errorf("mispredicted successor %d differs:\n%s", i, executor.FormatConfigDifferences(*mispredicted[i], *successor.Conf))
+				}
+				if !executor.CompareConfiguration(*correct[i], *successor.Correct) {
+					t.Errorf("correct successor %d differs:\n%s", i, executor.FormatConfigDifferences(*correct[i], *successor.Correct))
+				}
+			}
+		})
+	}
+}
+
+func TestSpeculationModelsRunEveryInstruction(t *testing.T) {
+	// cmov と skip を含むプログラムを、すべての投機のモデルで実行できることを確認する
+	source := "    skip\n    cmov c, x <- 1\n    store x, 4\n    beqz x, End\n    load y, 4\nEnd:\n"
+
+	testCases := []struct {
+		Name  string
+		Model executor.SpeculationModel
+	}{
+		{Name: "Never mispredict", Model: executor.NeverMispredict{}},
+		{Name: "Always mispredict", Model: executor.AlwaysMispredict{}},
+		{Name: "Bounded mispredict", Model: executor.BoundedMispredict{MaxDepth: 1}},
+		{Name: "Misprediction budget", Model: executor.MispredictionBudget{Max: 1, Model: executor.AlwaysMispredict{}}},
+		{Name: "Store bypass", Model: executor.SemanticsStoreBypass.Model(0)},
+		{Name: "All", Model: executor.SemanticsAll.Model(0)},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			asm, err := assembler.ParseAsm(strings.NewReader(source))
+			if err != nil {
+				t.Fatalf("failed to parse program: %v", err)
+			}
+			initialConfig := &executor.Configuration{Registers: map[string]interface{}{"x": 0}, Memory: map[int]interface{}{4: 7}}
+			opts := executor.SpecOptions{Window: executor.UnitWindow(10), Model: testCase.Model}
+			finalConfigs, err := executor.SpecRunAssemblerWithOptions(asm, initialConfig, 200, opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(finalConfigs) == 0 {
+				t.Fatalf("expected at least one path")
+			}
+			for _, conf := range finalConfigs {
+				if conf.PC != len(asm.Program) {
+					t.Errorf("expected the path to end at %d, got PC %d", len(asm.Program), conf.PC)
+				}
+			}
+		})
+	}
+}
+
+// ignoreBarriers は、spbarr を投機のバリアとして扱わないテスト用のモデル
+type ignoreBarriers struct{}
+
+func (ignoreBarriers) Successors(inst assembler.Stmt, conf *executor.Configuration, ctx executor.SpecContext) ([]executor.Successor, error) {
+	successors, err := executor.AlwaysMispredict{}.Successors(inst, conf, ctx)
+	for i := range successors {
+		successors[i].Barrier = false
+	}
+	return successors, err
+}
+
+func TestSpeculationModelBarrier(t *testing.T) {
+	// バリアかどうかはモデルが決め、実行ループは Successor.Barrier に従う
+	source := "    beqz c, End\n    spbarr\n    load s, 5\nEnd:\n"
+
+	testCases := []struct {
+		Name          string
+		Model         executor.SpeculationModel
+		ExpectedLoads int // 投機中の load の観測の数
+	}{
+		{Name: "Always mispredict stops at spbarr", Model: executor.AlwaysMispredict{}, ExpectedLoads: 0},
+		{Name: "Model without barriers", Model: ignoreBarriers{}, ExpectedLoads: 1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			asm, err := assembler.ParseAsm(strings.NewReader(source))
+			if err != nil {
+				t.Fatalf("failed to parse program: %v", err)
+			}
+			initialConfig := &executor.Configuration{Registers: map[string]interface{}{"c": 0}, Memory: map[int]interface{}{5: 0}}
+			opts := executor.SpecOptions{Window: executor.UnitWindow(10), Model: testCase.Model}
+			finalConfigs, err := executor.SpecRunAssemblerWithOptions(asm, initialConfig, 100, opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			loads := 0
+			for _, conf := range finalConfigs {
+				_, spec := executor.SplitTrace(conf.Trace)
+				for _, obs := range spec {
+					if obs.Type == executor.ObsTypeLoad {
+						loads++
+					}
+				}
+			}
+			if loads != testCase.ExpectedLoads {
+				t.Errorf("expected %d speculative loads, got %d", testCase.ExpectedLoads, loads)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package executor
 import (
 	"fmt"
 	"strconv"
+
+	"github.com/taisii/go-project/assembler"
 )
 
 // NewConfiguration creates a new Configuration
@@ -68,25 +70,56 @@ func evalExpr(expr interface{}, conf *Configuration) (interface{}, error) {
 			evaluatedOperands[i] = evalOperand
 		}
 
-		// オペランドがすべて具体値なら結果を計算
-		if allConcrete(evaluatedOperands) {
-			result, err := computeConcrete(expression.Op, evaluatedOperands)
-			if err != nil {
-				return nil, err
-			}
-			return result, nil
-		}
-
-		// オペランドにシンボリックな値が含まれる場合、シンボリック式として返す
-		return SymbolicExpr{
-			Op:       expression.Op,
-			Operands: evaluatedOperands,
-		}, nil
+		return applyOp(expression.Op, evaluatedOperands)
 	default:
 		return nil, fmt.Errorf("unsupported expression type: %T", expression)
 	}
 }
 
+// evalAST は、アセンブラの式 expr を conf で評価します。
+// レジスタは evalExpr と同様に値を評価し、値のないレジスタはシンボリック変数になります。
+// evalExpr と異なり、部分式の評価に失敗した場合 (0 による除算など) はエラーを返します。
+func evalAST(expr assembler.Expr, conf *Configuration) (interface{}, error) {
+	switch e := expr.(type) {
+	case assembler.Immediate:
+		return e.Value, nil
+	case assembler.Register:
+		return evalExpr(e.Name, conf)
+	case assembler.UnaryExpr:
+		operand, err := evalAST(e.Operand, conf)
+		if err != nil {
+			return nil, err
+		}
+		return applyOp(unaryOp(e.Op), []interface{}{operand})
+	case assembler.BinaryExpr:
+		left, err := evalAST(e.Left, conf)
+		if err != nil {
+			return nil, err
+		}
+		right, err := evalAST(e.Right, conf)
+		if err != nil {
+			return nil, err
+		}
+		return applyOp(e.Op, []interface{}{left, right})
+	default:
+		// ラベルは実行前にアドレスに解決される
+		return nil, fmt.Errorf("unresolved expression %s", expr)
+	}
+}
+
+// applyOp は、評価済みのオペランドに演算子 op を適用します。
+// オペランドがすべて具体値なら結果を計算し、シンボリックな値が含まれる場合は正規化したシンボリック式を返します。
+func applyOp(op string, operands []interface{}) (interface{}, error) {
+	if allConcrete(operands) {
+		result, err := computeConcrete(op, operands)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	return Simplify(SymbolicExpr{Op: op, Operands: operands}), nil
+}
+
 // Helper function to check if all elements in the slice are concrete (int)
 func allConcrete(operands []interface{}) bool {
 	for _, operand := range operands {
@@ -99,50 +132,113 @@ func allConcrete(operands []interface{}) bool {
 
 // Helper function to compute the result of a concrete operation
 func computeConcrete(op string, operands []interface{}) (int, error) {
+	if op == "ite" {
+		if len(operands) != 3 {
+			return 0, fmt.Errorf("invalid number of operands for operator %s", op)
+		}
+		if operands[0].(int) != 0 {
+			return operands[1].(int), nil
+		}
+		return operands[2].(int), nil
+	}
+
+	// Unary operators
+	if op == "neg" || op == "~" || op == "!" {
+		if len(operands) != 1 {
+			return 0, fmt.Errorf("invalid number of operands for operator %s", op)
+		}
+		value := operands[0].(int)
+		switch op {
+		case "neg":
+			return -value, nil
+		case "~":
+			return ^value, nil
+		default:
+			return boolToInt(value == 0), nil
+		}
+	}
+
 	if len(operands) < 2 {
 		return 0, fmt.Errorf("invalid number of operands for operator %s", op)
 	}
 
+	// Flattened associative operators (a + b + c) are folded from the left
+	if len(operands) > 2 {
+		switch op {
+		case "+", "-", "*", "&", "|", "^", "&&", "||":
+			left, err := computeConcrete(op, operands[:len(operands)-1])
+			if err != nil {
+				return 0, err
+			}
+			return computeConcrete(op, []interface{}{left, operands[len(operands)-1]})
+		}
+		return 0, fmt.Errorf("invalid number of operands for operator %s", op)
+	}
+
 	// Convert operands to int
 	intOperands := make([]int, len(operands))
 	for i, operand := range operands {
 		intOperands[i] = operand.(int)
 	}
+	a, b := intOperands[0], intOperands[1]
 
 	// Perform the operation
 	switch op {
 	case "+":
-		return intOperands[0] + intOperands[1], nil
+		return a + b, nil
 	case "-":
-		return intOperands[0] - intOperands[1], nil
+		return a - b, nil
 	case "*":
-		return intOperands[0] * intOperands[1], nil
+		return a * b, nil
 	case "/":
-		if intOperands[1] == 0 {
+		if b == 0 {
 			return 0, fmt.Errorf("division by zero")
 		}
-		return intOperands[0] / intOperands[1], nil
-	case "<":
-		if intOperands[0] < intOperands[1] {
-			return 1, nil
-		}
-		return 0, nil
-	case ">":
-		if intOperands[0] > intOperands[1] {
-			return 1, nil
+		return a / b, nil
+	case "%", "mod":
+		if b == 0 {
+			return 0, fmt.Errorf("modulo by zero")
 		}
-		return 0, nil
-	case "==":
-		if intOperands[0] == intOperands[1] {
-			return 1, nil
+		return a % b, nil
+	case "&", "/\\":
+		return a & b, nil
+	case "|", "\\/":
+		return a | b, nil
+	case "^", "xor":
+		return a ^ b, nil
+	case "<<", ">>":
+		if b < 0 {
+			return 0, fmt.Errorf("negative shift count: %d", b)
 		}
-		return 0, nil
-	case "!=":
-		if intOperands[0] != intOperands[1] {
-			return 1, nil
+		if op == "<<" {
+			return a << b, nil
 		}
-		return 0, nil
+		return a >> b, nil
+	case "<":
+		return boolToInt(a < b), nil
+	case "<=", "=<":
+		return boolToInt(a <= b), nil
+	case ">":
+		return boolToInt(a > b), nil
+	case ">=":
+		return boolToInt(a >= b), nil
+	case "==", "=":
+		return boolToInt(a == b), nil
+	case "!=", "\\=":
+		return boolToInt(a != b), nil
+	case "&&":
+		return boolToInt(a != 0 && b != 0), nil
+	case "||":
+		return boolToInt(a != 0 || b != 0), nil
 	default:
 		return 0, fmt.Errorf("unsupported operator: %s", op)
 	}
 }
+
+// boolToInt converts a comparison result into the 1/0 encoding used by μAsm.
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
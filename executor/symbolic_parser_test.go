@@ -1,8 +1,11 @@
 package executor
 
 import (
+	"errors"
 	"reflect"
 	"testing"
+
+	"github.com/taisii/go-project/assembler"
 )
 
 func TestParseSymbolicExpr(t *testing.T) {
@@ -154,3 +157,91 @@ func TestParseSymbolicExpr(t *testing.T) {
 		})
 	}
 }
+
+func TestParseSymbolicExprPrecedence(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{input: "a - b - c", expected: "((a - b) - c)"},
+		{input: "a / b * c", expected: "((a / b) * c)"},
+		{input: "x >= 1", expected: "(x >= 1)"},
+		{input: "x =< 1", expected: "(x <= 1)"},
+		{input: "x = 0", expected: "(x == 0)"},
+		{input: "x \\= 0", expected: "(x != 0)"},
+		{input: "a + b << 2", expected: "((a + b) << 2)"},
+		{input: "a << 1 < b", expected: "((a << 1) < b)"},
+		{input: "a < b & c", expected: "((a < b) & c)"},
+		{input: "a & b xor c | d", expected: "(((a & b) ^ c) | d)"},
+		{input: "a /\\ b \\/ c", expected: "((a & b) | c)"},
+		{input: "a mod b + c", expected: "((a mod b) + c)"},
+		{input: "a | b && c || d", expected: "(((a | b) && c) || d)"},
+		{input: "-x + 1", expected: "(-x + 1)"},
+		{input: "x - -1", expected: "(x - -1)"},
+		{input: "~(a + b)", expected: "~(a + b)"},
+		{input: "!x && y", expected: "(!x && y)"},
+		{input: "-(x * 2)", expected: "-(x * 2)"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.input, func(t *testing.T) {
+			result, err := ParseSymbolicExpr(testCase.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := formatSymbolicExpr(*result); got != testCase.expected {
+				t.Errorf("expected %s, got %s", testCase.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseSymbolicExprErrors(t *testing.T) {
+	for _, input := range []string{"", "x +", "x y", "(x))", "x ! y", "* x"} {
+		t.Run(input, func(t *testing.T) {
+			_, err := ParseSymbolicExpr(input)
+			if err == nil {
+				t.Fatalf("expected error for %q", input)
+			}
+			// エラーはアセンブラの式パーサーのもので、エラー位置を含む
+			var exprErr *assembler.ExprError
+			if !errors.As(err, &exprErr) {
+				t.Errorf("expected an *assembler.ExprError, got %T", err)
+			}
+		})
+	}
+}
+
+// formatSymbolicExpr の出力を再び解析すると同じ式になることを確認する
+func TestParseSymbolicExprRoundTrip(t *testing.T) {
+	inputs := []string{
+		"10 + x * 2",
+		"a - b - c",
+		"a - (b - c)",
+		"x >= 1 && y <= 2 || z != 3",
+		"a << 2 >> b",
+		"a & b ^ c | d",
+		"a mod 4 / 2",
+		"-x * ~y",
+		"!(x = 0)",
+		"-(a + -3)",
+		"~~x",
+	}
+
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			first, err := ParseSymbolicExpr(input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			formatted := formatSymbolicExpr(*first)
+			second, err := ParseSymbolicExpr(formatted)
+			if err != nil {
+				t.Fatalf("failed to parse formatted expression %q: %v", formatted, err)
+			}
+			if !reflect.DeepEqual(first, second) {
+				t.Errorf("round trip of %q via %q changed the expression: %+v != %+v", input, formatted, first, second)
+			}
+		})
+	}
+}
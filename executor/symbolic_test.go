@@ -1,6 +1,7 @@
 package executor
 
 import (
+	"fmt"
 	"testing"
 )
 
@@ -311,3 +312,49 @@ func TestComputeConcrete(t *testing.T) {
 		t.Errorf("Expected error for invalid operator")
 	}
 }
+
+func TestComputeConcreteOperators(t *testing.T) {
+	testCases := []struct {
+		op       string
+		operands []interface{}
+		expected int
+		wantErr  bool
+	}{
+		{op: "%", operands: []interface{}{7, 3}, expected: 1},
+		{op: "%", operands: []interface{}{-7, 3}, expected: -1},
+		{op: "%", operands: []interface{}{7, 0}, wantErr: true},
+		{op: "&", operands: []interface{}{6, 3}, expected: 2},
+		{op: "|", operands: []interface{}{6, 3}, expected: 7},
+		{op: "^", operands: []interface{}{6, 3}, expected: 5},
+		{op: "<<", operands: []interface{}{3, 2}, expected: 12},
+		{op: ">>", operands: []interface{}{-8, 1}, expected: -4},
+		{op: "<<", operands: []interface{}{1, -1}, wantErr: true},
+		{op: "<=", operands: []interface{}{2, 2}, expected: 1},
+		{op: "<=", operands: []interface{}{3, 2}, expected: 0},
+		{op: ">=", operands: []interface{}{2, 3}, expected: 0},
+		{op: ">=", operands: []interface{}{3, 3}, expected: 1},
+		{op: "=", operands: []interface{}{0, 0}, expected: 1},
+		{op: "&&", operands: []interface{}{2, 0}, expected: 0},
+		{op: "||", operands: []interface{}{2, 0}, expected: 1},
+		{op: "neg", operands: []interface{}{5}, expected: -5},
+		{op: "~", operands: []interface{}{5}, expected: -6},
+		{op: "!", operands: []interface{}{0}, expected: 1},
+		{op: "!", operands: []interface{}{3}, expected: 0},
+		{op: "neg", operands: []interface{}{1, 2}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s%v", tc.op, tc.operands), func(t *testing.T) {
+			result, err := computeConcrete(tc.op, tc.operands)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got result: %v", result)
+				}
+				return
+			}
+			if err != nil || result != tc.expected {
+				t.Errorf("Expected %d, got %v (err: %v)", tc.expected, result, err)
+			}
+		})
+	}
+}
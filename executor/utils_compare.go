@@ -33,8 +33,9 @@ func CompareSymbolicExpr(expected, actual interface{}) bool {
 		return true
 	}
 
-	// 型アサーションが失敗した場合、直接値として比較（文字列や整数など）
-	return reflect.DeepEqual(expected, actual)
+	// 型アサーションが失敗した場合、正規化した値として比較（文字列や整数、SymbolicExpr など）
+	// x + 1 と 1 + x のように正規形が同じ式は一致とみなす
+	return reflect.DeepEqual(Simplify(expected), Simplify(actual))
 }
 
 func CompareTraces(expected, actual Trace) bool {
@@ -79,6 +80,11 @@ func CompareConfiguration(expected, actual Configuration) bool {
 		return false
 	}
 
+	// 書き込みの履歴の比較
+	if !CompareWrites(expected.Writes, actual.Writes) {
+		return false
+	}
+
 	// トレースの比較
 	if !CompareTraces(expected.Trace, actual.Trace) {
 		return false
@@ -118,3 +124,18 @@ func CompareMemory(expected, actual map[int]interface{}) bool {
 
 	return true
 }
+
+// シンボリックなアドレスへの書き込みを比較
+func CompareWrites(expected, actual []MemoryWrite) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+
+	for i, expWrite := range expected {
+		if !CompareSymbolicExpr(expWrite.Address, actual[i].Address) || !CompareSymbolicExpr(expWrite.Value, actual[i].Value) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -16,6 +16,24 @@ func copyMemory(memory map[int]interface{}) map[int]interface{} {
 	return newMemory
 }
 
+func copyWrites(writes []MemoryWrite) []MemoryWrite {
+	if writes == nil {
+		return nil
+	}
+	newWrites := make([]MemoryWrite, len(writes))
+	copy(newWrites, writes)
+	return newWrites
+}
+
+func copyStoreBuffer(buffer []PendingStore) []PendingStore {
+	if buffer == nil {
+		return nil
+	}
+	newBuffer := make([]PendingStore, len(buffer))
+	copy(newBuffer, buffer)
+	return newBuffer
+}
+
 func copyConfiguration(conf Configuration) Configuration {
 	newRegisters := copyRegisters(conf.Registers)
 	newMemory := copyMemory(conf.Memory)
@@ -30,11 +48,15 @@ func copyConfiguration(conf Configuration) Configuration {
 	}
 
 	return Configuration{
-		PC:        conf.PC,
-		Registers: newRegisters,
-		Memory:    newMemory,
-		Trace:     newTrace,
-		StepCount: conf.StepCount,
+		PC:           conf.PC,
+		Registers:    newRegisters,
+		Memory:       newMemory,
+		Writes:       copyWrites(conf.Writes),
+		InitialReads: copyWrites(conf.InitialReads),
+		MemoryPolicy: conf.MemoryPolicy,
+		StoreBuffer:  copyStoreBuffer(conf.StoreBuffer),
+		Trace:        newTrace,
+		StepCount:    conf.StepCount,
 	}
 }
 
@@ -68,6 +90,7 @@ func copyObservation(obs Observation) Observation {
 		Address:   obs.Address, // `interface{}` 型だが値型の可能性が高い
 		Value:     obs.Value,   // 同上
 		SpecState: newSpecState,
+		Step:      obs.Step,
 	}
 }
 
@@ -90,5 +113,6 @@ func copyExecutionPath(path ExecutionPath) ExecutionPath {
 	return ExecutionPath{
 		CurrentConf:      copyConfiguration(path.CurrentConf),
 		SpeculativeStack: newStack,
+		Mispredictions:   path.Mispredictions,
 	}
 }
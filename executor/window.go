@@ -0,0 +1,141 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WindowMode は、入れ子になった投機実行の予算の扱いを表す型
+type WindowMode string
+
+const (
+	// WindowNested では、入れ子の投機は親の残りから分岐のコストを引いた独自の予算を持ちます (Spectector と同じ)。
+	// 内側の投機で消費した分は親の予算から引かれません。
+	WindowNested WindowMode = "nested"
+	// WindowGlobal では、すべての投機がリオーダーバッファ (ROB) のように一つの予算を共有します。
+	// 内側の投機で実行した命令は外側の投機の予算も消費します。
+	WindowGlobal WindowMode = "global"
+)
+
+// ParseWindowMode は、文字列 (nested, global) を WindowMode に変換します。
+func ParseWindowMode(name string) (WindowMode, error) {
+	switch mode := WindowMode(name); mode {
+	case WindowNested, WindowGlobal:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown window mode %q (expected nested or global)", name)
+}
+
+// WindowModel は、投機実行できる命令数 (投機ウィンドウ) のモデルを表す構造体
+// 投機中に命令を実行するたびに命令のコストを残りのウィンドウから引き、0 以下になるとロールバックします。
+type WindowModel struct {
+	Size  int            // 最も外側の投機のウィンドウの大きさ (μop 数)
+	Mode  WindowMode     // 入れ子の投機の扱い (空の場合は WindowNested)
+	Costs map[string]int // 命令ごとのコスト (含まれない命令のコストは 1)
+}
+
+// UnitWindow は、すべての命令のコストが 1 の入れ子のウィンドウを返します。
+// SpecExecute の remainingWindow はこのモデルとして扱われます。
+func UnitWindow(size int) WindowModel {
+	return WindowModel{Size: size, Mode: WindowNested}
+}
+
+// LatencyCosts は、メモリアクセスを ALU 命令より長く数える命令ごとのコストの例です。
+func LatencyCosts() map[string]int {
+	return map[string]int{
+		"skip":   1,
+		"<-":     1,
+		"cmov":   1,
+		"beqz":   1,
+		"jmp":    1,
+		"spbarr": 1,
+		"load":   4,
+		"store":  2,
+	}
+}
+
+// Cost は、命令 mnemonic が消費するウィンドウの大きさを返します。
+func (w WindowModel) Cost(mnemonic string) int {
+	if cost, ok := w.Costs[mnemonic]; ok {
+		return cost
+	}
+	return 1
+}
+
+// validate は、モデルの設定が正しいかを確認します。
+func (w WindowModel) validate() error {
+	if w.Mode != "" && w.Mode != WindowNested && w.Mode != WindowGlobal {
+		return fmt.Errorf("unknown window mode %q", w.Mode)
+	}
+	for mnemonic, cost := range w.Costs {
+		if cost < 0 {
+			return fmt.Errorf("window cost of %s must not be negative, got %d", mnemonic, cost)
+		}
+	}
+	return nil
+}
+
+// startWindow は、スタック stack の上で新しく始まる投機のウィンドウを返します。
+// branch は投機を始めた分岐命令です。
+func (w WindowModel) startWindow(stack []SpeculativeState, branch string) int {
+	if len(stack) == 0 {
+		return w.Size
+	}
+	return stack[len(stack)-1].RemainingWin - w.Cost(branch)
+}
+
+// charge は、投機中に命令 mnemonic を実行した分をウィンドウから引きます。
+func (w WindowModel) charge(stack []SpeculativeState, mnemonic string) {
+	if len(stack) == 0 {
+		return
+	}
+	cost := w.Cost(mnemonic)
+	if w.Mode == WindowGlobal {
+		for i := range stack {
+			stack[i].RemainingWin -= cost
+		}
+		return
+	}
+	stack[len(stack)-1].RemainingWin -= cost
+}
+
+// ParseWindowCosts は、"load=4,store=2" の形式の文字列を命令ごとのコストに変換します。
+func ParseWindowCosts(spec string) (map[string]int, error) {
+	costs := make(map[string]int)
+	if strings.TrimSpace(spec) == "" {
+		return costs, nil
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		mnemonic, value, ok := strings.Cut(entry, "=")
+		mnemonic = strings.TrimSpace(mnemonic)
+		if !ok || mnemonic == "" {
+			return nil, fmt.Errorf("invalid window cost %q (expected mnemonic=cost)", entry)
+		}
+		cost, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || cost < 0 {
+			return nil, fmt.Errorf("invalid window cost for %s: %q", mnemonic, value)
+		}
+		costs[mnemonic] = cost
+	}
+	return costs, nil
+}
+
+// String は、モデルを "size=20 mode=nested costs=load=4,store=2" の形式で返します。
+func (w WindowModel) String() string {
+	mode := w.Mode
+	if mode == "" {
+		mode = WindowNested
+	}
+	s := fmt.Sprintf("size=%d mode=%s", w.Size, mode)
+	if len(w.Costs) > 0 {
+		entries := make([]string, 0, len(w.Costs))
+		for mnemonic, cost := range w.Costs {
+			entries = append(entries, fmt.Sprintf("%s=%d", mnemonic, cost))
+		}
+		sort.Strings(entries)
+		s += " costs=" + strings.Join(entries, ",")
+	}
+	return s
+}
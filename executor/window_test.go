@@ -0,0 +1,143 @@
+package executor_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/taisii/go-project/assembler"
+	"github.com/taisii/go-project/executor"
+)
+
+func TestSpecWindowModel(t *testing.T) {
+	testCases := []struct {
+		Name          string
+		Source        string
+		Registers     map[string]interface{}
+		Window        executor.WindowModel
+		ExpectedLoads int // 投機中に実行された load の数
+	}{
+		{
+			Name:          "Unit costs",
+			Source:        "    beqz x,End\n    load a,0\n    load b,1\n    load c,2\nEnd:\n",
+			Registers:     map[string]interface{}{"x": 0},
+			Window:        executor.UnitWindow(6),
+			ExpectedLoads: 3,
+		},
+		{
+			Name:          "Loads cost more than ALU operations",
+			Source:        "    beqz x,End\n    load a,0\n    load b,1\n    load c,2\nEnd:\n",
+			Registers:     map[string]interface{}{"x": 0},
+			Window:        executor.WindowModel{Size: 6, Costs: executor.LatencyCosts()},
+			ExpectedLoads: 2,
+		},
+		{
+			Name:          "Zero cost instructions do not consume the window",
+			Source:        "    beqz x,End\n    a<-1\n    a<-2\n    load b,0\nEnd:\n",
+			Registers:     map[string]interface{}{"x": 0},
+			Window:        executor.WindowModel{Size: 1, Costs: map[string]int{"<-": 0}},
+			ExpectedLoads: 1,
+		},
+		{
+			Name:          "Nested windows",
+			Source:        "    beqz x,End\n    beqz y,L\n    load a,0\nL:\n    load b,1\nEnd:\n",
+			Registers:     map[string]interface{}{"x": 0, "y": 0},
+			Window:        executor.WindowModel{Size: 3, Mode: executor.WindowNested},
+			ExpectedLoads: 3, // 内側で 2 つ、ロールバック後に外側で 1 つ
+		},
+		{
+			Name:          "Global ROB budget",
+			Source:        "    beqz x,End\n    beqz y,L\n    load a,0\nL:\n    load b,1\nEnd:\n",
+			Registers:     map[string]interface{}{"x": 0, "y": 0},
+			Window:        executor.WindowModel{Size: 3, Mode: executor.WindowGlobal},
+			ExpectedLoads: 2, // 内側の投機が外側の予算も使い切る
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			asm, err := assembler.ParseAsm(strings.NewReader(testCase.Source))
+			if err != nil {
+				t.Fatalf("failed to parse program: %v", err)
+			}
+			conf := &executor.Configuration{Registers: testCase.Registers, Memory: map[int]interface{}{0: 0, 1: 1, 2: 2}}
+			finalConfigs, err := executor.SpecRunAssemblerWithOptions(asm, conf, 100, executor.SpecOptions{Window: testCase.Window})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(finalConfigs) != 1 {
+				t.Fatalf("expected 1 final configuration, got %d", len(finalConfigs))
+			}
+
+			_, spec := executor.SplitTrace(finalConfigs[0].Trace)
+			loads := 0
+			for _, obs := range spec {
+				if obs.Type == executor.ObsTypeLoad {
+					loads++
+				}
+			}
+			if loads != testCase.ExpectedLoads {
+				t.Errorf("expected %d speculative loads, got %d", testCase.ExpectedLoads, loads)
+				executor.PrintTrace(finalConfigs[0].Trace)
+			}
+
+			// ロールバックの観測には、ロールバックが起きたステップが記録される
+			lastStep := 0
+			for _, obs := range finalConfigs[0].Trace.Observations {
+				if obs.Type != executor.ObsTypeRollback {
+					continue
+				}
+				if obs.Step <= lastStep {
+					t.Errorf("rollback step %d is not after the previous step %d", obs.Step, lastStep)
+				}
+				lastStep = obs.Step
+			}
+			if lastStep == 0 {
+				t.Errorf("expected a rollback observation")
+			}
+		})
+	}
+}
+
+func TestRollbackStep(t *testing.T) {
+	asm, err := assembler.ParseAsm(strings.NewReader("    beqz x,End\n    a<-1\n    a<-2\nEnd:\n"))
+	if err != nil {
+		t.Fatalf("failed to parse program: %v", err)
+	}
+	conf := &executor.Configuration{Registers: map[string]interface{}{"x": 0}}
+	finalConfigs, err := executor.SpecRunAssembler(asm, conf, 100, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// ステップ 1: beqz (投機開始), ステップ 2: a<-1, ステップ 3: ウィンドウを使い切ってロールバック
+	for _, obs := range finalConfigs[0].Trace.Observations {
+		if obs.Type == executor.ObsTypeRollback {
+			if obs.Step != 3 || obs.PC != 2 {
+				t.Errorf("expected rollback at step 3 and PC 2, got step %d and PC %d", obs.Step, obs.PC)
+			}
+			return
+		}
+	}
+	t.Fatalf("expected a rollback observation")
+}
+
+func TestParseWindowCosts(t *testing.T) {
+	costs, err := executor.ParseWindowCosts("load=4, store = 2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := map[string]int{"load": 4, "store": 2}; !reflect.DeepEqual(costs, expected) {
+		t.Errorf("expected %v, got %v", expected, costs)
+	}
+
+	for _, spec := range []string{"load", "load=x", "=3", "load=-1"} {
+		if _, err := executor.ParseWindowCosts(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+
+	if _, err := executor.ParseWindowMode("rob"); err == nil {
+		t.Errorf("expected error for unknown window mode")
+	}
+}
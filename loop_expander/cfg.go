@@ -2,6 +2,8 @@ package loop_expander
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"sort"
 	"strings"
 
@@ -49,7 +51,7 @@ func splitToBasicBlocks(assembler *assembler.Assembler) ([]*BasicBlock, error) {
 		block.EndAddress = instruction.Addr
 
 		// ジャンプ命令または分岐命令の場合、新しいブロックを開始
-		if instruction.OpCode.Mnemonic == "jmp" || instruction.OpCode.Mnemonic == "beqz" {
+		if _, ok := instruction.JumpTarget(); ok {
 			blocks = append(blocks, block)
 			block = &BasicBlock{StartAddress: instruction.Addr + 1}
 		}
@@ -66,8 +68,8 @@ func buildCFGEdges(cfg *ControlFlowGraph, asm *assembler.Assembler) {
 		// 最後の命令がジャンプ命令または分岐命令の場合
 		if len(block.Instructions) > 0 {
 			lastInst := block.Instructions[len(block.Instructions)-1]
-			if lastInst.OpCode.Mnemonic == "jmp" || lastInst.OpCode.Mnemonic == "beqz" {
-				labelName := lastInst.OpCode.Operands[len(lastInst.OpCode.Operands)-1]
+			if target, ok := lastInst.JumpTarget(); ok {
+				labelName := target.String()
 				labelAddr, ok := asm.Labels[labelName]
 				if ok {
 					// ジャンプ先のブロック番号を後続ブロックに追加
@@ -80,11 +82,12 @@ func buildCFGEdges(cfg *ControlFlowGraph, asm *assembler.Assembler) {
 						block.Succs = []int{}
 					}
 				} else {
-					// ラベルが見つからない場合はエラー処理
-					fmt.Printf("ラベル %s が見つかりません\n", labelName)
+					// ラベルが見つからない場合 (jmp x のようなレジスタ経由のジャンプ) は後続ブロックを追加しない。
+					// 診断は呼び出し側が表示できるよう Warnings に記録する
+					cfg.Warnings = append(cfg.Warnings, fmt.Sprintf("ラベル %s が見つかりません", labelName))
 				}
 			}
-			if lastInst.OpCode.Mnemonic != "jmp" && i < len(cfg.Blocks)-1 {
+			if _, ok := lastInst.Stmt.(assembler.Jmp); !ok && i < len(cfg.Blocks)-1 {
 				// 次のブロック番号を後続ブロックに追加
 				block.Succs = append(block.Succs, findBlockIndexByAddr(cfg, cfg.Blocks[i+1].StartAddress))
 			}
@@ -107,23 +110,28 @@ func findBlockIndexByAddr(cfg *ControlFlowGraph, addr int) int {
 
 // PrintCFG は、ControlFlowGraph を見やすい形で出力する関数です。
 func PrintCFG(cfg *ControlFlowGraph, asm *assembler.Assembler) {
+	FprintCFG(os.Stdout, cfg, asm)
+}
+
+// FprintCFG は、PrintCFG と同じ形式で ControlFlowGraph を w に出力します。
+func FprintCFG(w io.Writer, cfg *ControlFlowGraph, asm *assembler.Assembler) {
 	for i, block := range cfg.Blocks {
-		fmt.Printf("Block %d (Addr: %d-%d):\n", i, block.StartAddress, block.EndAddress)
+		fmt.Fprintf(w, "Block %d (Addr: %d-%d):\n", i, block.StartAddress, block.EndAddress)
 		for _, inst := range block.Instructions {
-			fmt.Printf("  %s\n", inst.String())
+			fmt.Fprintf(w, "  %s\n", inst.String())
 		}
-		fmt.Printf("  Succs: ")
+		fmt.Fprintf(w, "  Succs: ")
 		for _, succAddr := range block.Succs {
-			fmt.Printf("%d ", succAddr)
+			fmt.Fprintf(w, "%d ", succAddr)
 			// 後続ブロックがラベルの場合、ラベル名を表示
 			for labelName, labelAddr := range asm.Labels {
 				if labelAddr == succAddr {
-					fmt.Printf("(%s) ", labelName)
+					fmt.Fprintf(w, "(%s) ", labelName)
 					break
 				}
 			}
 		}
-		fmt.Println()
+		fmt.Fprintln(w)
 	}
 }
 
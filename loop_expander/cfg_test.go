@@ -16,11 +16,11 @@ func TestBuildControlFlowGraph(t *testing.T) {
 			name: "Simple program",
 			assembly: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "L1"}}},
-					{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"z", "2"}}},
-					{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"w", "3"}}},
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 2, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "L1"}}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "z"}, Addr: assembler.Immediate{Value: 2}}},
+					{Addr: 4, Stmt: assembler.Load{Dest: assembler.Register{Name: "w"}, Addr: assembler.Immediate{Value: 3}}},
 				},
 				Labels: map[string]int{
 					"L1": 4,
@@ -32,9 +32,9 @@ func TestBuildControlFlowGraph(t *testing.T) {
 						StartAddress: 0,
 						EndAddress:   2,
 						Instructions: []assembler.Instruction{
-							{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-							{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-							{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "L1"}}},
+							{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+							{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+							{Addr: 2, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "L1"}}},
 						},
 						Succs: []int{1, 2},
 					},
@@ -42,7 +42,7 @@ func TestBuildControlFlowGraph(t *testing.T) {
 						StartAddress: 3,
 						EndAddress:   3,
 						Instructions: []assembler.Instruction{
-							{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"z", "2"}}},
+							{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "z"}, Addr: assembler.Immediate{Value: 2}}},
 						},
 						Succs: []int{2},
 					},
@@ -50,7 +50,7 @@ func TestBuildControlFlowGraph(t *testing.T) {
 						StartAddress: 4,
 						EndAddress:   4,
 						Instructions: []assembler.Instruction{
-							{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"w", "3"}}},
+							{Addr: 4, Stmt: assembler.Load{Dest: assembler.Register{Name: "w"}, Addr: assembler.Immediate{Value: 3}}},
 						},
 						Succs: []int{},
 					},
@@ -61,13 +61,13 @@ func TestBuildControlFlowGraph(t *testing.T) {
 			name: "Program with loop",
 			assembly: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "L1"}}},
-					{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"z", "2"}}},
-					{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"L2"}}},
-					{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"w", "3"}}},
-					{Addr: 6, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"v", "4"}}},
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 2, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "L1"}}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "z"}, Addr: assembler.Immediate{Value: 2}}},
+					{Addr: 4, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "L2"}}},
+					{Addr: 5, Stmt: assembler.Load{Dest: assembler.Register{Name: "w"}, Addr: assembler.Immediate{Value: 3}}},
+					{Addr: 6, Stmt: assembler.Load{Dest: assembler.Register{Name: "v"}, Addr: assembler.Immediate{Value: 4}}},
 				},
 				Labels: map[string]int{
 					"L1": 5,
@@ -80,8 +80,8 @@ func TestBuildControlFlowGraph(t *testing.T) {
 						StartAddress: 0,
 						EndAddress:   1,
 						Instructions: []assembler.Instruction{
-							{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-							{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
+							{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+							{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
 						},
 						Succs: []int{1},
 					},
@@ -89,7 +89,7 @@ func TestBuildControlFlowGraph(t *testing.T) {
 						StartAddress: 2,
 						EndAddress:   2,
 						Instructions: []assembler.Instruction{
-							{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "L1"}}},
+							{Addr: 2, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "L1"}}},
 						},
 						Succs: []int{2, 3},
 					},
@@ -97,8 +97,8 @@ func TestBuildControlFlowGraph(t *testing.T) {
 						StartAddress: 3,
 						EndAddress:   4,
 						Instructions: []assembler.Instruction{
-							{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"z", "2"}}},
-							{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"L2"}}},
+							{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "z"}, Addr: assembler.Immediate{Value: 2}}},
+							{Addr: 4, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "L2"}}},
 						},
 						Succs: []int{1},
 					},
@@ -106,8 +106,8 @@ func TestBuildControlFlowGraph(t *testing.T) {
 						StartAddress: 5,
 						EndAddress:   6,
 						Instructions: []assembler.Instruction{
-							{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"w", "3"}}},
-							{Addr: 6, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"v", "4"}}},
+							{Addr: 5, Stmt: assembler.Load{Dest: assembler.Register{Name: "w"}, Addr: assembler.Immediate{Value: 3}}},
+							{Addr: 6, Stmt: assembler.Load{Dest: assembler.Register{Name: "v"}, Addr: assembler.Immediate{Value: 4}}},
 						},
 						Succs: []int{},
 					},
@@ -118,15 +118,15 @@ func TestBuildControlFlowGraph(t *testing.T) {
 			name: "loop_expander",
 			assembly: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"InnerLoop"}}},
-					{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-					{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"y", "InnerLoop_0"}}},
-					{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
-					{Addr: 6, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-					{Addr: 7, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"y", "InnerLoop_1"}}},
-					{Addr: 8, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
+					{Addr: 0, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "OuterLoop"}}},
+					{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 2, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "InnerLoop"}}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 4, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "InnerLoop_0"}}},
+					{Addr: 5, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "OuterLoop"}}},
+					{Addr: 6, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 7, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "InnerLoop_1"}}},
+					{Addr: 8, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "OuterLoop"}}},
 				},
 				Labels: map[string]int{
 					"OuterLoop":   1,
@@ -141,7 +141,7 @@ func TestBuildControlFlowGraph(t *testing.T) {
 						StartAddress: 0,
 						EndAddress:   0,
 						Instructions: []assembler.Instruction{
-							{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
+							{Addr: 0, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "OuterLoop"}}},
 						},
 						Succs: []int{1},
 					},
@@ -149,8 +149,8 @@ func TestBuildControlFlowGraph(t *testing.T) {
 						StartAddress: 1,
 						EndAddress:   2,
 						Instructions: []assembler.Instruction{
-							{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-							{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"InnerLoop"}}},
+							{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+							{Addr: 2, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "InnerLoop"}}},
 						},
 						Succs: []int{2},
 					},
@@ -158,8 +158,8 @@ func TestBuildControlFlowGraph(t *testing.T) {
 						StartAddress: 3,
 						EndAddress:   4,
 						Instructions: []assembler.Instruction{
-							{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-							{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"y", "InnerLoop_0"}}},
+							{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+							{Addr: 4, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "InnerLoop_0"}}},
 						},
 						Succs: []int{3, 4},
 					},
@@ -167,7 +167,7 @@ func TestBuildControlFlowGraph(t *testing.T) {
 						StartAddress: 5,
 						EndAddress:   5,
 						Instructions: []assembler.Instruction{
-							{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
+							{Addr: 5, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "OuterLoop"}}},
 						},
 						Succs: []int{1},
 					},
@@ -175,8 +175,8 @@ func TestBuildControlFlowGraph(t *testing.T) {
 						StartAddress: 6,
 						EndAddress:   7,
 						Instructions: []assembler.Instruction{
-							{Addr: 6, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-							{Addr: 7, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"y", "InnerLoop_1"}}},
+							{Addr: 6, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+							{Addr: 7, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "InnerLoop_1"}}},
 						},
 						Succs: []int{5},
 					},
@@ -184,7 +184,7 @@ func TestBuildControlFlowGraph(t *testing.T) {
 						StartAddress: 8,
 						EndAddress:   8,
 						Instructions: []assembler.Instruction{
-							{Addr: 8, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
+							{Addr: 8, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "OuterLoop"}}},
 						},
 						Succs: []int{1},
 					},
@@ -246,3 +246,24 @@ func TestBuildControlFlowGraph(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildControlFlowGraphWarnings(t *testing.T) {
+	asm := &assembler.Assembler{
+		Program: []assembler.Instruction{
+			{Addr: 0, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "r"}}},
+			{Addr: 1, Stmt: assembler.Skip{}},
+		},
+		Labels: map[string]int{},
+	}
+	cfg, err := BuildControlFlowGraph(asm)
+	if err != nil {
+		t.Fatalf("BuildControlFlowGraph() error = %v", err)
+	}
+	// レジスタ経由のジャンプ先は後続ブロックにせず、警告として返す
+	if len(cfg.Warnings) != 1 || cfg.Warnings[0] != "ラベル r が見つかりません" {
+		t.Errorf("unexpected warnings: %v", cfg.Warnings)
+	}
+	if len(cfg.Blocks[0].Succs) != 0 {
+		t.Errorf("unexpected successors of the jump: %v", cfg.Blocks[0].Succs)
+	}
+}
@@ -1,33 +1,80 @@
 package loop_expander
 
-// detectLoops は、制御フローグラフに対してDFSを行い、ループを検出します。
-func DetectLoops(cfg *ControlFlowGraph) [][]int {
-	visited := make(map[int]bool) // 訪問済みノードを記録するマップ
-	stack := make([]int, 0)       // DFSのためのスタック
-	loops := make([][]int, 0)     // 検出されたループを格納するリスト
-	for i := range cfg.Blocks {   // 各ブロックを始点としてDFS
-		detectLoopsDFS(cfg, i, visited, stack, &loops)
+import "sort"
+
+// Edge は、制御フローグラフのエッジ (ブロックのインデックスの組) を表す構造体
+type Edge struct {
+	From int // 遷移元ブロックのインデックス
+	To   int // 遷移先ブロックのインデックス
+}
+
+// Loop は、バックエッジ一本に対応する自然ループを表す構造体
+type Loop struct {
+	Header int    // ループヘッダ (バックエッジの遷移先) のブロック
+	Latch  int    // バックエッジの遷移元のブロック
+	Blocks []int  // ループ本体のブロック (ヘッダを含み昇順)
+	Exits  []Edge // ループ本体からループ外へ出るエッジ
+}
+
+// DetectLoops は、支配木からバックエッジを求め、バックエッジごとの自然ループを検出します。
+// ループはヘッダ、ラッチの順に昇順で返します。
+func DetectLoops(cfg *ControlFlowGraph) []Loop {
+	domTree := BuildDominatorTree(cfg)
+	preds := predecessors(cfg)
+
+	loops := make([]Loop, 0)
+	for latch, block := range cfg.Blocks {
+		for _, header := range block.Succs {
+			// ヘッダがラッチを支配している場合、latch -> header はバックエッジ
+			if !domTree.Dominates(header, latch) {
+				continue
+			}
+			loops = append(loops, naturalLoop(cfg, preds, header, latch))
+		}
 	}
+
+	sort.Slice(loops, func(i, j int) bool {
+		if loops[i].Header != loops[j].Header {
+			return loops[i].Header < loops[j].Header
+		}
+		return loops[i].Latch < loops[j].Latch
+	})
 	return loops
 }
 
-// detectLoopsDFS は、detectLoops のための深さ優先探索を行う補助関数です。
-func detectLoopsDFS(cfg *ControlFlowGraph, blockIndex int, visited map[int]bool, stack []int, loops *[][]int) {
-	if visited[blockIndex] { // 既に訪問済み
-		return
+// naturalLoop は、バックエッジ latch -> header に対応する自然ループを求めます。
+// ヘッダを通らずにラッチへ到達できるブロックがループ本体となります。
+func naturalLoop(cfg *ControlFlowGraph, preds [][]int, header, latch int) Loop {
+	inLoop := map[int]bool{header: true}
+	stack := make([]int, 0)
+	if !inLoop[latch] {
+		inLoop[latch] = true
+		stack = append(stack, latch)
+	}
+	for len(stack) > 0 {
+		block := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, pred := range preds[block] {
+			if !inLoop[pred] {
+				inLoop[pred] = true
+				stack = append(stack, pred)
+			}
+		}
+	}
+
+	loop := Loop{Header: header, Latch: latch, Blocks: make([]int, 0, len(inLoop)), Exits: make([]Edge, 0)}
+	for block := range inLoop {
+		loop.Blocks = append(loop.Blocks, block)
 	}
-	visited[blockIndex] = true
-	stack = append(stack, blockIndex)
-
-	for _, succIndex := range cfg.Blocks[blockIndex].Succs {
-		if i := indexOf(stack, succIndex); i != -1 { // スタックに含まれている場合、ループを検出
-			loop := stack[i:] // ループを構成するブロックのインデックスを抽出
-			*loops = append(*loops, loop)
-		} else {
-			detectLoopsDFS(cfg, succIndex, visited, stack, loops)
+	sort.Ints(loop.Blocks)
+	for _, block := range loop.Blocks {
+		for _, succ := range cfg.Blocks[block].Succs {
+			if !inLoop[succ] {
+				loop.Exits = append(loop.Exits, Edge{From: block, To: succ})
+			}
 		}
 	}
-	stack = stack[:len(stack)-1] // スタックから現在のブロックを削除
+	return loop
 }
 
 // indexOf は、スライス内で指定した要素が最初に出現するインデックスを返します。
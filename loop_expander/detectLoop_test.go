@@ -13,58 +13,58 @@ func TestDetectLoops(t *testing.T) {
 	testCases := []struct {
 		name     string
 		assembly *assembler.Assembler
-		expected [][]int
+		expected []loop_expander.Loop
 	}{
 		{
 			name: "No loops",
 			assembly: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "L1"}}},
-					{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"z", "2"}}},
-					{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"w", "3"}}},
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 2, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "L1"}}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "z"}, Addr: assembler.Immediate{Value: 2}}},
+					{Addr: 4, Stmt: assembler.Load{Dest: assembler.Register{Name: "w"}, Addr: assembler.Immediate{Value: 3}}},
 				},
 				Labels: map[string]int{
 					"L1": 4,
 				},
 			},
-			expected: [][]int{}, // ループなし
+			expected: []loop_expander.Loop{}, // ループなし
 		},
 		{
 			name: "Single loop",
 			assembly: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "L1"}}},
-					{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"z", "2"}}},
-					{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"L2"}}},
-					{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"w", "3"}}},
-					{Addr: 6, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"v", "4"}}},
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 2, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "L1"}}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "z"}, Addr: assembler.Immediate{Value: 2}}},
+					{Addr: 4, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "L2"}}},
+					{Addr: 5, Stmt: assembler.Load{Dest: assembler.Register{Name: "w"}, Addr: assembler.Immediate{Value: 3}}},
+					{Addr: 6, Stmt: assembler.Load{Dest: assembler.Register{Name: "v"}, Addr: assembler.Immediate{Value: 4}}},
 				},
 				Labels: map[string]int{
 					"L1": 5,
 					"L2": 2,
 				},
 			},
-			expected: [][]int{
-				{1, 2}, // 1 -> 2 -> 1 のループ
+			expected: []loop_expander.Loop{
+				{Header: 1, Latch: 2, Blocks: []int{1, 2}, Exits: []loop_expander.Edge{{From: 1, To: 3}}}, // 1 -> 2 -> 1 のループ
 			},
 		},
 		{
 			name: "Multiple loops",
 			assembly: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "L1"}}},
-					{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"z", "2"}}},
-					{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"L2"}}},
-					{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"w", "3"}}},
-					{Addr: 6, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"y", "L3"}}},
-					{Addr: 7, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"v", "4"}}},
-					{Addr: 8, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"L4"}}},
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 2, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "L1"}}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "z"}, Addr: assembler.Immediate{Value: 2}}},
+					{Addr: 4, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "L2"}}},
+					{Addr: 5, Stmt: assembler.Load{Dest: assembler.Register{Name: "w"}, Addr: assembler.Immediate{Value: 3}}},
+					{Addr: 6, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "L3"}}},
+					{Addr: 7, Stmt: assembler.Load{Dest: assembler.Register{Name: "v"}, Addr: assembler.Immediate{Value: 4}}},
+					{Addr: 8, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "L4"}}},
 				},
 				Labels: map[string]int{
 					"L1": 5,
@@ -73,23 +73,23 @@ func TestDetectLoops(t *testing.T) {
 					"L4": 5,
 				},
 			},
-			expected: [][]int{
-				{1, 2},    // 1 -> 2 -> 1 のループ
-				{3, 4, 5}, // 3 -> 4 -> 5 -> 3 のループ
+			expected: []loop_expander.Loop{
+				{Header: 1, Latch: 2, Blocks: []int{1, 2}, Exits: []loop_expander.Edge{{From: 1, To: 3}}}, // 1 -> 2 -> 1 のループ
+				{Header: 3, Latch: 5, Blocks: []int{3, 4, 5}, Exits: []loop_expander.Edge{}},              // 3 -> 4 -> 5 -> 3 のループ
 			},
 		},
 		{
 			name: "Nested loops",
 			assembly: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"L5"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-					{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"L5"}}},
-					{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"z", "2"}}},
-					{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"L1"}}},
-					{Addr: 6, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"w", "3"}}},
-					{Addr: 7, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"L1"}}},
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "L5"}}},
+					{Addr: 2, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 3, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "L5"}}},
+					{Addr: 4, Stmt: assembler.Load{Dest: assembler.Register{Name: "z"}, Addr: assembler.Immediate{Value: 2}}},
+					{Addr: 5, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "z"}, Target: assembler.LabelRef{Name: "L1"}}},
+					{Addr: 6, Stmt: assembler.Load{Dest: assembler.Register{Name: "w"}, Addr: assembler.Immediate{Value: 3}}},
+					{Addr: 7, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "L1"}}},
 				},
 				Labels: map[string]int{
 					"L1": 1,
@@ -100,30 +100,30 @@ func TestDetectLoops(t *testing.T) {
 					"L6": 6,
 				},
 			},
-			expected: [][]int{ // ループが少なくとも一つ検出できていればよい
-				{1, 2, 3, 4, 5},
-				{1, 2, 3, 4, 5, 6},
+			expected: []loop_expander.Loop{ // 同じヘッダを持つバックエッジごとにループを検出する
+				{Header: 1, Latch: 5, Blocks: []int{1, 2, 3, 4, 5}, Exits: []loop_expander.Edge{{From: 5, To: 6}}},
+				{Header: 1, Latch: 6, Blocks: []int{1, 2, 3, 4, 5, 6}, Exits: []loop_expander.Edge{}},
 			},
 		},
 		{
-			name: "nested loop (not supported)",
+			name: "nested loop",
 			assembly: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"InnerLoop"}}},
-					{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-					{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"y", "InnerLoop"}}},
-					{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
+					{Addr: 0, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "OuterLoop"}}},
+					{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 2, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "InnerLoop"}}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 4, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "InnerLoop"}}},
+					{Addr: 5, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "OuterLoop"}}},
 				},
 				Labels: map[string]int{
 					"OuterLoop": 1,
 					"InnerLoop": 3,
 				},
 			},
-			expected: [][]int{ // ループが少なくとも一つ検出できていればよい
-				{2},
-				{1, 2, 3},
+			expected: []loop_expander.Loop{
+				{Header: 1, Latch: 3, Blocks: []int{1, 2, 3}, Exits: []loop_expander.Edge{}},
+				{Header: 2, Latch: 2, Blocks: []int{2}, Exits: []loop_expander.Edge{{From: 2, To: 3}}},
 			},
 		},
 		// nestedなloop用
@@ -131,15 +131,15 @@ func TestDetectLoops(t *testing.T) {
 		// 	name: "loop_expander",
 		// 	assembly: &assembler.Assembler{
 		// 		Program: []assembler.Instruction{
-		// 			{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
-		// 			{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-		// 			{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"InnerLoop"}}},
-		// 			{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-		// 			{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"y", "InnerLoop_0"}}},
-		// 			{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
-		// 			{Addr: 6, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-		// 			{Addr: 7, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"y", "InnerLoop_1"}}},
-		// 			{Addr: 8, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
+		// 			{Addr: 0, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "OuterLoop"}}},
+		// 			{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+		// 			{Addr: 2, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "InnerLoop"}}},
+		// 			{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+		// 			{Addr: 4, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "InnerLoop_0"}}},
+		// 			{Addr: 5, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "OuterLoop"}}},
+		// 			{Addr: 6, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+		// 			{Addr: 7, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "InnerLoop_1"}}},
+		// 			{Addr: 8, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "OuterLoop"}}},
 		// 		},
 		// 		Labels: map[string]int{
 		// 			"OuterLoop":   1,
@@ -0,0 +1,115 @@
+package loop_expander
+
+// DominatorTree は、制御フローグラフの支配木を表す構造体
+type DominatorTree struct {
+	Idom []int // 各ブロックの直接支配ブロックのインデックス (入口ブロックは自分自身、到達不能なブロックは -1)
+}
+
+// BuildDominatorTree は、ブロック 0 を入口として制御フローグラフの支配木を構築します。
+// Cooper, Harvey, Kennedy の反復アルゴリズム ("A Simple, Fast Dominance Algorithm") を用います。
+func BuildDominatorTree(cfg *ControlFlowGraph) *DominatorTree {
+	idom := make([]int, len(cfg.Blocks))
+	for i := range idom {
+		idom[i] = -1
+	}
+	if len(cfg.Blocks) == 0 {
+		return &DominatorTree{Idom: idom}
+	}
+
+	order := reversePostorder(cfg)
+	orderIndex := make([]int, len(cfg.Blocks)) // 逆後順での位置
+	for i := range orderIndex {
+		orderIndex[i] = -1
+	}
+	for i, block := range order {
+		orderIndex[block] = i
+	}
+	preds := predecessors(cfg)
+
+	idom[0] = 0
+	changed := true
+	for changed {
+		changed = false
+		for _, block := range order[1:] {
+			newIdom := -1
+			for _, pred := range preds[block] {
+				if idom[pred] == -1 {
+					continue // 未処理または到達不能な先行ブロック
+				}
+				if newIdom == -1 {
+					newIdom = pred
+				} else {
+					newIdom = intersectDominators(idom, orderIndex, pred, newIdom)
+				}
+			}
+			if idom[block] != newIdom {
+				idom[block] = newIdom
+				changed = true
+			}
+		}
+	}
+	return &DominatorTree{Idom: idom}
+}
+
+// Dominates は、ブロック a がブロック b を支配しているかどうかを返します。
+func (dt *DominatorTree) Dominates(a, b int) bool {
+	if dt.Idom[b] == -1 {
+		return false // 到達不能なブロックはどのブロックにも支配されない
+	}
+	for {
+		if a == b {
+			return true
+		}
+		if dt.Idom[b] == b {
+			return false // 入口ブロックまで辿った
+		}
+		b = dt.Idom[b]
+	}
+}
+
+// intersectDominators は、支配木上で 2 つのブロックに共通する最も近い支配ブロックを返します。
+func intersectDominators(idom, orderIndex []int, a, b int) int {
+	for a != b {
+		for orderIndex[a] > orderIndex[b] {
+			a = idom[a]
+		}
+		for orderIndex[b] > orderIndex[a] {
+			b = idom[b]
+		}
+	}
+	return a
+}
+
+// reversePostorder は、入口ブロックから到達可能なブロックを逆後順で返します。
+func reversePostorder(cfg *ControlFlowGraph) []int {
+	visited := make([]bool, len(cfg.Blocks))
+	postorder := make([]int, 0, len(cfg.Blocks))
+	var visit func(block int)
+	visit = func(block int) {
+		visited[block] = true
+		for _, succ := range cfg.Blocks[block].Succs {
+			if !visited[succ] {
+				visit(succ)
+			}
+		}
+		postorder = append(postorder, block)
+	}
+	visit(0)
+
+	order := make([]int, len(postorder))
+	for i, block := range postorder {
+		order[len(postorder)-1-i] = block
+	}
+	return order
+}
+
+// predecessors は、各ブロックの先行ブロックのリストを返します。
+func predecessors(cfg *ControlFlowGraph) [][]int {
+	preds := make([][]int, len(cfg.Blocks))
+	for i, block := range cfg.Blocks {
+		for _, succ := range block.Succs {
+			preds[succ] = append(preds[succ], i)
+		}
+	}
+	return preds
+}
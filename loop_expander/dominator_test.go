@@ -0,0 +1,76 @@
+package loop_expander_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/taisii/go-project/assembler"
+	"github.com/taisii/go-project/loop_expander"
+)
+
+func TestBuildDominatorTree(t *testing.T) {
+	testCases := []struct {
+		name     string
+		assembly *assembler.Assembler
+		expected []int
+	}{
+		{
+			name: "If-else diamond",
+			assembly: &assembler.Assembler{
+				Program: []assembler.Instruction{
+					{Addr: 0, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "Else"}}},
+					{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 2, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "End"}}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 4, Stmt: assembler.Load{Dest: assembler.Register{Name: "z"}, Addr: assembler.Register{Name: "y"}}},
+				},
+				Labels: map[string]int{
+					"Else": 3,
+					"End":  4,
+				},
+			},
+			expected: []int{0, 0, 0, 0}, // 合流点 (ブロック 3) は分岐元のブロック 0 に直接支配される
+		},
+		{
+			name: "Loop with unreachable block",
+			assembly: &assembler.Assembler{
+				Program: []assembler.Instruction{
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "Loop"}}},
+					{Addr: 2, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "End"}}},
+					{Addr: 3, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "Loop"}}},
+					{Addr: 4, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Register{Name: "x"}}},
+				},
+				Labels: map[string]int{
+					"Loop": 1,
+					"End":  4,
+				},
+			},
+			expected: []int{0, 0, 1, -1, 2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := loop_expander.BuildControlFlowGraph(tc.assembly)
+			if err != nil {
+				t.Fatalf("BuildControlFlowGraph() error = %v", err)
+			}
+			domTree := loop_expander.BuildDominatorTree(cfg)
+			if !reflect.DeepEqual(domTree.Idom, tc.expected) {
+				t.Errorf("Unexpected immediate dominators: got %v, want %v\n%s", domTree.Idom, tc.expected, loop_expander.ToDOT(cfg))
+			}
+			for block, idom := range domTree.Idom {
+				if idom == -1 {
+					continue
+				}
+				if !domTree.Dominates(0, block) {
+					t.Errorf("entry block should dominate block %d", block)
+				}
+				if !domTree.Dominates(idom, block) {
+					t.Errorf("block %d should dominate block %d", idom, block)
+				}
+			}
+		})
+	}
+}
@@ -12,5 +12,6 @@ type BasicBlock struct {
 
 // ControlFlowGraph は、制御フローグラフを表す構造体
 type ControlFlowGraph struct {
-	Blocks []*BasicBlock // 基本ブロックのリスト
+	Blocks   []*BasicBlock // 基本ブロックのリスト
+	Warnings []string      // 構築中の診断 (ジャンプ先のラベルが見つからない場合など)
 }
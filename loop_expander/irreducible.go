@@ -0,0 +1,170 @@
+package loop_expander
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/taisii/go-project/assembler"
+)
+
+// IrreducibleRegion は、複数の入口を持つ強連結成分 (既約でない制御フロー) を表す構造体
+type IrreducibleRegion struct {
+	Blocks  []int // 強連結成分を構成するブロック (昇順)
+	Entries []int // 成分の外、またはプログラムの入口から直接到達するブロック (昇順)
+}
+
+// IrreducibleLoopError は、ループの途中へ外から飛び込む制御フローが見つかったことを表すエラー
+type IrreducibleLoopError struct {
+	Entries []string // 入口となるブロックのラベル名
+}
+
+func (e *IrreducibleLoopError) Error() string {
+	return fmt.Sprintf("irreducible loop with multiple entries: %s", strings.Join(e.Entries, ", "))
+}
+
+// FindIrreducibleRegions は、制御フローグラフから複数の入口を持つ強連結成分を探します。
+// 入口が一つの強連結成分については、入口を取り除いた内側の成分を再帰的に調べます。
+func FindIrreducibleRegions(cfg *ControlFlowGraph) []IrreducibleRegion {
+	nodes := make(map[int]bool, len(cfg.Blocks))
+	for i := range cfg.Blocks {
+		nodes[i] = true
+	}
+	preds := predecessors(cfg)
+
+	regions := make([]IrreducibleRegion, 0)
+	var search func(nodes map[int]bool)
+	search = func(nodes map[int]bool) {
+		for _, scc := range stronglyConnectedComponents(cfg, nodes) {
+			if !isCyclic(cfg, scc) {
+				continue
+			}
+			inSCC := make(map[int]bool, len(scc))
+			for _, block := range scc {
+				inSCC[block] = true
+			}
+			entries := make([]int, 0)
+			for _, block := range scc {
+				isEntry := block == 0
+				for _, pred := range preds[block] {
+					if !inSCC[pred] {
+						isEntry = true
+					}
+				}
+				if isEntry {
+					entries = append(entries, block)
+				}
+			}
+
+			if len(entries) > 1 {
+				regions = append(regions, IrreducibleRegion{Blocks: scc, Entries: entries})
+				continue
+			}
+			if len(entries) == 0 {
+				continue // どこからも到達しない成分は展開の対象にならない
+			}
+			// ループヘッダを取り除き、内側のループを調べる
+			delete(inSCC, entries[0])
+			search(inSCC)
+		}
+	}
+	search(nodes)
+
+	sort.Slice(regions, func(i, j int) bool {
+		return regions[i].Blocks[0] < regions[j].Blocks[0]
+	})
+	return regions
+}
+
+// checkReducible は、既約でない制御フローがあればその入口のラベル名を含むエラーを返します。
+func checkReducible(cfg *ControlFlowGraph, asm *assembler.Assembler) error {
+	regions := FindIrreducibleRegions(cfg)
+	if len(regions) == 0 {
+		return nil
+	}
+
+	entries := make([]string, 0, len(regions[0].Entries))
+	for _, entry := range regions[0].Entries {
+		entries = append(entries, blockName(cfg.Blocks[entry], asm))
+	}
+	return &IrreducibleLoopError{Entries: entries}
+}
+
+// blockName は、ブロックの先頭に付いたラベル名を返します。ラベルがない場合はアドレスを返します。
+func blockName(block *BasicBlock, asm *assembler.Assembler) string {
+	names := make([]string, 0)
+	for label, addr := range asm.Labels {
+		if addr == block.StartAddress {
+			names = append(names, label)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("addr %d", block.StartAddress)
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// isCyclic は、強連結成分が閉路を含むか (複数のブロックからなるか自己ループを持つか) を返します。
+func isCyclic(cfg *ControlFlowGraph, scc []int) bool {
+	return len(scc) > 1 || indexOf(cfg.Blocks[scc[0]].Succs, scc[0]) != -1
+}
+
+// stronglyConnectedComponents は、nodes に含まれるブロックだけからなる部分グラフの強連結成分を Tarjan のアルゴリズムで求めます。
+// 各成分のブロックは昇順に並べて返します。
+func stronglyConnectedComponents(cfg *ControlFlowGraph, nodes map[int]bool) [][]int {
+	index := 0
+	indices := make(map[int]int)
+	lowlink := make(map[int]int)
+	onStack := make(map[int]bool)
+	stack := make([]int, 0)
+	components := make([][]int, 0)
+
+	var strongConnect func(block int)
+	strongConnect = func(block int) {
+		indices[block] = index
+		lowlink[block] = index
+		index++
+		stack = append(stack, block)
+		onStack[block] = true
+
+		for _, succ := range cfg.Blocks[block].Succs {
+			if !nodes[succ] {
+				continue
+			}
+			if _, visited := indices[succ]; !visited {
+				strongConnect(succ)
+				lowlink[block] = min(lowlink[block], lowlink[succ])
+			} else if onStack[succ] {
+				lowlink[block] = min(lowlink[block], indices[succ])
+			}
+		}
+
+		if lowlink[block] == indices[block] {
+			component := make([]int, 0)
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component = append(component, top)
+				if top == block {
+					break
+				}
+			}
+			sort.Ints(component)
+			components = append(components, component)
+		}
+	}
+
+	ordered := make([]int, 0, len(nodes))
+	for block := range nodes {
+		ordered = append(ordered, block)
+	}
+	sort.Ints(ordered)
+	for _, block := range ordered {
+		if _, visited := indices[block]; !visited {
+			strongConnect(block)
+		}
+	}
+	return components
+}
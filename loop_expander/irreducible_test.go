@@ -0,0 +1,103 @@
+package loop_expander_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/taisii/go-project/assembler"
+	"github.com/taisii/go-project/loop_expander"
+)
+
+func TestFindIrreducibleRegions(t *testing.T) {
+	testCases := []struct {
+		name            string
+		assembly        *assembler.Assembler
+		expected        []loop_expander.IrreducibleRegion
+		expectedEntries []string // Loop_expander のエラーに含まれる入口ラベル (nil の場合はエラーなし)
+	}{
+		{
+			name: "Reducible loop",
+			assembly: &assembler.Assembler{
+				Program: []assembler.Instruction{
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Register{Name: "x"}}},
+					{Addr: 2, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "Loop"}}},
+				},
+				Labels: map[string]int{
+					"Loop": 1,
+				},
+			},
+			expected: []loop_expander.IrreducibleRegion{},
+		},
+		{
+			name: "Jump into the middle of a loop",
+			assembly: &assembler.Assembler{
+				Program: []assembler.Instruction{
+					{Addr: 0, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "Middle"}}},
+					{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 2, Stmt: assembler.Load{Dest: assembler.Register{Name: "z"}, Addr: assembler.Register{Name: "y"}}},
+					{Addr: 3, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "z"}, Target: assembler.LabelRef{Name: "Loop"}}},
+				},
+				Labels: map[string]int{
+					"Loop":   1,
+					"Middle": 2,
+				},
+			},
+			expected: []loop_expander.IrreducibleRegion{
+				{Blocks: []int{1, 2}, Entries: []int{1, 2}},
+			},
+			expectedEntries: []string{"Loop", "Middle"},
+		},
+		{
+			name: "Irreducible region inside a reducible loop",
+			assembly: &assembler.Assembler{
+				Program: []assembler.Instruction{
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "B"}}},
+					{Addr: 2, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "z"}, Addr: assembler.Register{Name: "y"}}},
+					{Addr: 4, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "z"}, Target: assembler.LabelRef{Name: "A"}}},
+					{Addr: 5, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "Outer"}}},
+				},
+				Labels: map[string]int{
+					"Outer": 0,
+					"A":     2,
+					"B":     3,
+				},
+			},
+			expected: []loop_expander.IrreducibleRegion{
+				{Blocks: []int{1, 2}, Entries: []int{1, 2}},
+			},
+			expectedEntries: []string{"A", "B"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := loop_expander.BuildControlFlowGraph(tc.assembly)
+			if err != nil {
+				t.Fatalf("BuildControlFlowGraph() error = %v", err)
+			}
+			regions := loop_expander.FindIrreducibleRegions(cfg)
+			if !reflect.DeepEqual(regions, tc.expected) {
+				t.Errorf("Unexpected irreducible regions: got %v, want %v\n%s", regions, tc.expected, loop_expander.ToDOT(cfg))
+			}
+
+			_, err = loop_expander.Loop_expander(tc.assembly, 2)
+			if tc.expectedEntries == nil {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var irreducibleErr *loop_expander.IrreducibleLoopError
+			if !errors.As(err, &irreducibleErr) {
+				t.Fatalf("expected IrreducibleLoopError, but got %v", err)
+			}
+			if !reflect.DeepEqual(irreducibleErr.Entries, tc.expectedEntries) {
+				t.Errorf("Unexpected entry labels: got %v, want %v", irreducibleErr.Entries, tc.expectedEntries)
+			}
+		})
+	}
+}
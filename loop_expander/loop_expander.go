@@ -3,14 +3,31 @@ package loop_expander
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 
 	"github.com/taisii/go-project/assembler"
 )
 
+// ExpandOptions は、ループ展開の設定を表す構造体
+type ExpandOptions struct {
+	UnrollCount      int // 最も外側のループの展開回数
+	InnerUnrollCount int // 他のループの内側にあるループの展開回数 (0 の場合は UnrollCount と同じ)
+}
+
 // Loop_expander関数
+// プログラム中のすべてのループを、それぞれ maxUnrollCount 回ずつ展開します。
 func Loop_expander(asm *assembler.Assembler, maxUnrollCount int) (*assembler.Assembler, error) {
-	if asm == nil || maxUnrollCount <= 0 {
+	return ExpandLoops(asm, ExpandOptions{UnrollCount: maxUnrollCount})
+}
+
+// ExpandLoops は、プログラム中のすべてのループを内側から順に展開します。
+// 最も外側のループは opts.UnrollCount 回、ネストしたループは opts.InnerUnrollCount 回展開します。
+func ExpandLoops(asm *assembler.Assembler, opts ExpandOptions) (*assembler.Assembler, error) {
+	if opts.InnerUnrollCount == 0 {
+		opts.InnerUnrollCount = opts.UnrollCount
+	}
+	if asm == nil || opts.UnrollCount <= 0 || opts.InnerUnrollCount <= 0 {
 		return nil, errors.New("invalid arguments")
 	}
 
@@ -18,98 +35,170 @@ func Loop_expander(asm *assembler.Assembler, maxUnrollCount int) (*assembler.Ass
 	if err != nil {
 		return nil, fmt.Errorf("failed to build CFG: %w", err)
 	}
+	// 入口が複数あるループは展開できないため、壊れたプログラムを出力する前に拒否する
+	if err := checkReducible(cfg, asm); err != nil {
+		return nil, err
+	}
 
-	loops := DetectLoops(cfg)
+	expandedAsm := asm
+	for {
+		cfg, err := BuildControlFlowGraph(expandedAsm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build CFG: %w", err)
+		}
 
-	if len(loops) == 0 {
-		return asm, nil
-	}
+		forest := BuildLoopForest(cfg, DetectLoops(cfg))
+		innermost := InnermostLoops(forest)
+		if len(innermost) == 0 {
+			return expandedAsm, nil
+		}
 
-	// ループ展開前のプログラムの最後を取得
-	programEndAddress := len(asm.Program)
+		// 後ろのループから展開することで、それより前のループのアドレスを変えずに済む
+		loop := innermost[len(innermost)-1]
+		unrollCount := opts.UnrollCount
+		if loop.Depth > 0 {
+			unrollCount = opts.InnerUnrollCount
+		}
+		expandedAsm = expandLoop(expandedAsm, loop, unrollCount)
 
-	// ジャンプ命令用のラベルを作成
-	endLabel := "programEnd"
-	asm.Labels[endLabel] = programEndAddress
+		// 展開によってループが減らない場合は無限に繰り返してしまうのでエラーとする
+		nextCFG, err := BuildControlFlowGraph(expandedAsm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build CFG: %w", err)
+		}
+		if countLoops(BuildLoopForest(nextCFG, DetectLoops(nextCFG))) >= countLoops(forest) {
+			return nil, fmt.Errorf("failed to expand loop at address %d", loop.StartAddress)
+		}
+	}
+}
 
-	// ジャンプ命令を生成
-	jmpInstruction := assembler.Instruction{
-		Addr:   programEndAddress,
-		OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{endLabel}},
+// countLoops は、ループフォレストに含まれるループの数を返します。
+func countLoops(roots []*LoopNode) int {
+	count := 0
+	for _, root := range roots {
+		count += 1 + countLoops(root.Children)
 	}
+	return count
+}
 
-	// ジャンプ命令をプログラムの最後に追加
-	asm.Program = append(asm.Program, jmpInstruction)
+// expandLoop は、loop が示すループを unrollCount 回展開した新しい Assembler を返します。
+// 各展開の末尾にはループ出口へのジャンプ命令を追加し、ループより後ろの命令とラベルは展開で増えた分だけずらします。
+func expandLoop(asm *assembler.Assembler, loop *LoopNode, unrollCount int) *assembler.Assembler {
+	loopProgram := asm.Program[loop.StartAddress : loop.EndAddress+1]
+	loopLength := len(loopProgram) + 1 // 出口へのジャンプ命令の分を含める
+	shift := loopLength*unrollCount - len(loopProgram)
+	exitAddress := loop.StartAddress + loopLength*unrollCount
 
-	StartAddress := cfg.Blocks[loops[0][0]].StartAddress
-	loopEndAddress := cfg.Blocks[loops[0][len(loops[0])-1]].EndAddress
-	loopProgram := asm.Program[StartAddress:]
-	loopLength := len(loopProgram)
+	// ループがプログラムの末尾にある場合は programEnd を出口とする
+	isTail := loop.EndAddress+1 >= len(asm.Program)
+	endLabel := "programEnd"
+	if !isTail {
+		endLabel = loopExitLabel(asm, loop)
+	}
 
-	expandedAsm := assembler.CopyAssembler(asm)
-	expandedAsm.Program = expandedAsm.Program[:StartAddress]
+	// ループ内のラベルを抽出
+	loopLabels := make(map[string]int)
+	for label, addr := range asm.Labels {
+		if addr >= loop.StartAddress && addr <= loop.EndAddress {
+			loopLabels[label] = addr
+		}
+	}
 
-	for i := 0; i < maxUnrollCount; i++ {
-		for instIndex, inst := range loopProgram {
-			var nextAddr int
-			if len(expandedAsm.Program) > 0 {
-				nextAddr = expandedAsm.Program[len(expandedAsm.Program)-1].Addr + 1
-			} else {
-				nextAddr = 0 // プログラムの先頭のアドレスを設定
-			}
+	separator := labelSeparator(asm, loopLabels, unrollCount)
 
-			newInst := assembler.Instruction{
-				Addr: nextAddr,
-				OpCode: assembler.OpCode{
-					Mnemonic: inst.OpCode.Mnemonic,
-					Operands: make([]string, len(inst.OpCode.Operands)),
-				},
-			}
-			copy(newInst.OpCode.Operands, inst.OpCode.Operands)
-
-			// 新しいラベル名とアドレスを生成()
-			newLabels := make(map[string]int)
-			for label, addr := range asm.Labels {
-				newLabelName := label
-				newLabelAddr := addr
-				if addr >= StartAddress && addr <= loopEndAddress {
-					newLabelName = fmt.Sprintf("%s_%d", label, i)
-					newLabelAddr = addr - StartAddress + (loopLength * (i + 1))
-					newLabels[newLabelName] = newLabelAddr
-				}
-			}
+	expandedAsm := &assembler.Assembler{
+		Program: make([]assembler.Instruction, 0, len(asm.Program)+shift),
+		Labels:  make(map[string]int, len(asm.Labels)+len(loopLabels)*unrollCount+1),
+	}
+	expandedAsm.Program = append(expandedAsm.Program, asm.Program[:loop.StartAddress]...)
 
-			// 元のラベルを新しいラベルに置き換え
-			for j, operand := range inst.OpCode.Operands {
-				for originalLabel := range asm.Labels {
-					if operand == originalLabel {
-						// programEndラベルの場合は特別処理
-						if originalLabel == "programEnd" {
-							newInst.OpCode.Operands[j] = originalLabel
-						} else {
-							if instIndex+StartAddress >= expandedAsm.Labels[originalLabel] {
-								newInst.OpCode.Operands[j] = operand + "_" + strconv.Itoa(i)
-							} else {
-								if i > 0 {
-									newInst.OpCode.Operands[j] = operand + "_" + strconv.Itoa(i-1)
-								} else {
-									newInst.OpCode.Operands[j] = operand
-								}
-							}
-						}
+	// ラベルのアドレスを更新
+	for label, addr := range asm.Labels {
+		if addr > loop.EndAddress {
+			addr += shift
+		}
+		expandedAsm.Labels[label] = addr
+	}
+	programEndAddress := len(asm.Program) + shift
+	for label, addr := range loopLabels {
+		for i := 0; i < unrollCount; i++ {
+			newLabelAddr := addr + loopLength*(i+1)
+			// 最後の展開のラベルは展開回数を超えた繰り返しを表すため、ループの後ろの命令ではなくプログラムの末尾へ向けて実行を終える
+			if i == unrollCount-1 {
+				newLabelAddr = programEndAddress
+			}
+			expandedAsm.Labels[label+separator+strconv.Itoa(i)] = newLabelAddr
+		}
+	}
+	expandedAsm.Labels[endLabel] = exitAddress
+
+	for i := 0; i < unrollCount; i++ {
+		for _, inst := range loopProgram {
+			newInst := inst
+			newInst.Addr = len(expandedAsm.Program)
+
+			// ジャンプ先がループ内のラベルであれば展開ごとのラベルに置き換え
+			// (同名のレジスタを誤って書き換えないよう、ジャンプ先のオペランドだけを対象にする)
+			if label, ok := inst.JumpLabel(); ok {
+				if labelAddr, ok := loopLabels[label]; ok {
+					if header, ok := loop.BackEdges[inst.Addr]; ok && header == labelAddr {
+						// バックエッジは次の展開の先頭へ
+						newInst = newInst.WithJumpLabel(label + separator + strconv.Itoa(i))
+					} else if i > 0 {
+						// それ以外のループ内へのジャンプは、後方へのジャンプも含めて同じ展開の中へ
+						newInst = newInst.WithJumpLabel(label + separator + strconv.Itoa(i-1))
 					}
 				}
 			}
-			// 新しいラベルをexpandedAsmに追加
-			for newLabelName, newLabelAddr := range newLabels {
-				expandedAsm.Labels[newLabelName] = newLabelAddr + StartAddress
-			}
 			expandedAsm.Program = append(expandedAsm.Program, newInst)
-
 		}
+
+		// ループを抜けた場合は出口へジャンプ
+		expandedAsm.Program = append(expandedAsm.Program, assembler.Instruction{
+			Addr: len(expandedAsm.Program),
+			Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: endLabel}},
+		})
+	}
+
+	// ループより後ろの命令をずらして追加
+	for _, inst := range asm.Program[loop.EndAddress+1:] {
+		newInst := *assembler.CopyInstructionValue(&inst)
+		newInst.Addr += shift
+		expandedAsm.Program = append(expandedAsm.Program, newInst)
 	}
 
-	expandedAsm.Labels[endLabel] = len(expandedAsm.Program)
+	return expandedAsm
+}
 
-	return expandedAsm, nil
+// loopExitLabel は、プログラムの途中にあるループの出口に付けるラベル名を返します。
+func loopExitLabel(asm *assembler.Assembler, loop *LoopNode) string {
+	headers := make([]string, 0)
+	for label, addr := range asm.Labels {
+		if addr == loop.StartAddress {
+			headers = append(headers, label)
+		}
+	}
+	if len(headers) == 0 {
+		return fmt.Sprintf("loop%d_exit", loop.StartAddress)
+	}
+	sort.Strings(headers)
+	return headers[0] + "_exit"
+}
+
+// labelSeparator は、展開ごとのラベル名 (ラベル名 + 区切り文字 + 展開番号) が既存のラベルと衝突しない区切り文字を返します。
+// 内側のループを展開した後に外側のループを展開すると、"L" の展開ラベルと既存の "L_0" が衝突するため区切り文字を伸ばします。
+func labelSeparator(asm *assembler.Assembler, loopLabels map[string]int, unrollCount int) string {
+	separator := "_"
+	for {
+		collides := false
+		for label := range loopLabels {
+			for i := 0; i < unrollCount && !collides; i++ {
+				_, collides = asm.Labels[label+separator+strconv.Itoa(i)]
+			}
+		}
+		if !collides {
+			return separator
+		}
+		separator += "_"
+	}
 }
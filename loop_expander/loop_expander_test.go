@@ -3,6 +3,7 @@ package loop_expander_test
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/taisii/go-project/assembler"
@@ -10,11 +11,12 @@ import (
 )
 
 type testCase struct {
-	name           string
-	inputAsm       *assembler.Assembler
-	maxUnrollCount int
-	expectedAsm    *assembler.Assembler
-	expectedError  error
+	name             string
+	inputAsm         *assembler.Assembler
+	maxUnrollCount   int
+	innerUnrollCount int // 0 の場合は Loop_expander を使う
+	expectedAsm      *assembler.Assembler
+	expectedError    error
 }
 
 func TestLoop_expander(t *testing.T) {
@@ -23,14 +25,14 @@ func TestLoop_expander(t *testing.T) {
 			name: "No Loop", // ループがない場合
 			inputAsm: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
 				},
 				Labels: map[string]int{},
 			},
 			maxUnrollCount: 2,
 			expectedAsm: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
 				},
 				Labels: map[string]int{},
 			},
@@ -39,23 +41,23 @@ func TestLoop_expander(t *testing.T) {
 			name: "Simple Loop", // 簡単なループ
 			inputAsm: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"LoopStart"}}},
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "LoopStart"}}},
 				},
 				Labels: map[string]int{"LoopStart": 0},
 			},
 			maxUnrollCount: 3,
 			expectedAsm: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"LoopStart_0"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"programEnd"}}},
-					{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"LoopStart_1"}}},
-					{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"programEnd"}}},
-					{Addr: 6, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 7, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"LoopStart_2"}}},
-					{Addr: 8, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"programEnd"}}},
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "LoopStart_0"}}},
+					{Addr: 2, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 4, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "LoopStart_1"}}},
+					{Addr: 5, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
+					{Addr: 6, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 7, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "LoopStart_2"}}},
+					{Addr: 8, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
 				},
 				Labels: map[string]int{
 					"LoopStart":   0,
@@ -69,9 +71,9 @@ func TestLoop_expander(t *testing.T) {
 			name: "basic loop",
 			inputAsm: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"LoopStart"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"LoopStart"}}},
+					{Addr: 0, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "LoopStart"}}},
+					{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 2, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "LoopStart"}}},
 				},
 				Labels: map[string]int{
 					"LoopStart": 1,
@@ -80,16 +82,16 @@ func TestLoop_expander(t *testing.T) {
 			maxUnrollCount: 3,
 			expectedAsm: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"LoopStart"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"LoopStart_0"}}},
-					{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"programEnd"}}},
-					{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"LoopStart_1"}}},
-					{Addr: 6, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"programEnd"}}},
-					{Addr: 7, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 8, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"LoopStart_2"}}},
-					{Addr: 9, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"programEnd"}}},
+					{Addr: 0, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "LoopStart"}}},
+					{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 2, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "LoopStart_0"}}},
+					{Addr: 3, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
+					{Addr: 4, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 5, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "LoopStart_1"}}},
+					{Addr: 6, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
+					{Addr: 7, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 8, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "LoopStart_2"}}},
+					{Addr: 9, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
 				},
 				Labels: map[string]int{
 					"LoopStart":   1,
@@ -105,10 +107,10 @@ func TestLoop_expander(t *testing.T) {
 			name: "loop start from 0",
 			inputAsm: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"LoopStart"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "add", Operands: []string{"x", "1"}}},
-					{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"LoopStart"}}},
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "LoopStart"}}},
+					{Addr: 2, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "+", Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 3, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "LoopStart"}}},
 				},
 				Labels: map[string]int{
 					"LoopStart": 0,
@@ -117,21 +119,21 @@ func TestLoop_expander(t *testing.T) {
 			maxUnrollCount: 3,
 			expectedAsm: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"LoopStart_0"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "add", Operands: []string{"x", "1"}}},
-					{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"LoopStart_0"}}},
-					{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"programEnd"}}},
-					{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 6, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"LoopStart_1"}}},
-					{Addr: 7, OpCode: assembler.OpCode{Mnemonic: "add", Operands: []string{"x", "1"}}},
-					{Addr: 8, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"LoopStart_1"}}},
-					{Addr: 9, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"programEnd"}}},
-					{Addr: 10, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 11, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"LoopStart_2"}}},
-					{Addr: 12, OpCode: assembler.OpCode{Mnemonic: "add", Operands: []string{"x", "1"}}},
-					{Addr: 13, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"LoopStart_2"}}},
-					{Addr: 14, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"programEnd"}}},
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "LoopStart_0"}}},
+					{Addr: 2, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "+", Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 3, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "LoopStart_0"}}},
+					{Addr: 4, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
+					{Addr: 5, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 6, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "LoopStart_1"}}},
+					{Addr: 7, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "+", Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 8, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "LoopStart_1"}}},
+					{Addr: 9, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
+					{Addr: 10, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 11, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "LoopStart_2"}}},
+					{Addr: 12, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "+", Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 13, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "LoopStart_2"}}},
+					{Addr: 14, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
 				},
 				Labels: map[string]int{
 					"LoopStart":   0,
@@ -147,9 +149,9 @@ func TestLoop_expander(t *testing.T) {
 			name: "Loop with beqz",
 			inputAsm: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "add", Operands: []string{"x", "1"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "LoopStart"}}},
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "+", Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 2, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "LoopStart"}}},
 				},
 				Labels: map[string]int{
 					"LoopStart": 1,
@@ -158,16 +160,16 @@ func TestLoop_expander(t *testing.T) {
 			maxUnrollCount: 3,
 			expectedAsm: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "add", Operands: []string{"x", "1"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "LoopStart_0"}}},
-					{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"programEnd"}}},
-					{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "add", Operands: []string{"x", "1"}}},
-					{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "LoopStart_1"}}},
-					{Addr: 6, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"programEnd"}}},
-					{Addr: 7, OpCode: assembler.OpCode{Mnemonic: "add", Operands: []string{"x", "1"}}},
-					{Addr: 8, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "LoopStart_2"}}},
-					{Addr: 9, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"programEnd"}}},
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "+", Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 2, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "LoopStart_0"}}},
+					{Addr: 3, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
+					{Addr: 4, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "+", Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 5, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "LoopStart_1"}}},
+					{Addr: 6, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
+					{Addr: 7, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "+", Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 8, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "LoopStart_2"}}},
+					{Addr: 9, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
 				},
 				Labels: map[string]int{
 					"LoopStart":   1,
@@ -186,11 +188,11 @@ func TestLoop_expander(t *testing.T) {
 					"End": 5,
 				},
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "<-", Operands: []string{"x", "v<y"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "End"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "spbarr", Operands: []string{""}}},
-					{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"v", "v"}}},
-					{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"v", "v"}}},
+					{Addr: 0, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "<", Left: assembler.Register{Name: "v"}, Right: assembler.Register{Name: "y"}}}},
+					{Addr: 1, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "End"}}},
+					{Addr: 2, Stmt: assembler.Spbarr{}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "v"}, Addr: assembler.Register{Name: "v"}}},
+					{Addr: 4, Stmt: assembler.Load{Dest: assembler.Register{Name: "v"}, Addr: assembler.Register{Name: "v"}}},
 				},
 			},
 			maxUnrollCount: 3,
@@ -199,11 +201,11 @@ func TestLoop_expander(t *testing.T) {
 					"End": 5,
 				},
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "<-", Operands: []string{"x", "v<y"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "End"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "spbarr", Operands: []string{""}}},
-					{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"v", "v"}}},
-					{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"v", "v"}}},
+					{Addr: 0, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "<", Left: assembler.Register{Name: "v"}, Right: assembler.Register{Name: "y"}}}},
+					{Addr: 1, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "End"}}},
+					{Addr: 2, Stmt: assembler.Spbarr{}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "v"}, Addr: assembler.Register{Name: "v"}}},
+					{Addr: 4, Stmt: assembler.Load{Dest: assembler.Register{Name: "v"}, Addr: assembler.Register{Name: "v"}}},
 				},
 			},
 			expectedError: nil,
@@ -212,13 +214,13 @@ func TestLoop_expander(t *testing.T) {
 			name: "Complex Loop with Multiple Internal Labels",
 			inputAsm: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "<-", Operands: []string{"w", "0"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "<-", Operands: []string{"x", "in>=bound"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "L3"}}},
-					{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"L10"}}},
-					{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"secret", "in"}}},
-					{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"z", "secret"}}},
-					{Addr: 6, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"y", "Loop"}}},
+					{Addr: 0, Stmt: assembler.Assign{Dest: assembler.Register{Name: "w"}, Value: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: ">=", Left: assembler.Register{Name: "in"}, Right: assembler.Register{Name: "bound"}}}},
+					{Addr: 2, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "L3"}}},
+					{Addr: 3, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "L10"}}},
+					{Addr: 4, Stmt: assembler.Load{Dest: assembler.Register{Name: "secret"}, Addr: assembler.Register{Name: "in"}}},
+					{Addr: 5, Stmt: assembler.Load{Dest: assembler.Register{Name: "z"}, Addr: assembler.Register{Name: "secret"}}},
+					{Addr: 6, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "Loop"}}},
 				},
 				Labels: map[string]int{
 					"Loop": 1,
@@ -229,125 +231,194 @@ func TestLoop_expander(t *testing.T) {
 			maxUnrollCount: 2,
 			expectedAsm: &assembler.Assembler{
 				Program: []assembler.Instruction{
-					{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "<-", Operands: []string{"w", "0"}}},
-					{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "<-", Operands: []string{"x", "in>=bound"}}},
-					{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "L3"}}},
-					{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"L10"}}},
-					{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"secret", "in"}}},
-					{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"z", "secret"}}},
-					{Addr: 6, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"y", "Loop_0"}}},
-					{Addr: 7, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"programEnd"}}},
-					{Addr: 8, OpCode: assembler.OpCode{Mnemonic: "<-", Operands: []string{"x", "in>=bound"}}},
-					{Addr: 9, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"x", "L3_0"}}},
-					{Addr: 10, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"L10_0"}}},
-					{Addr: 11, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"secret", "in"}}},
-					{Addr: 12, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"z", "secret"}}},
-					{Addr: 13, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"y", "Loop_1"}}},
-					{Addr: 14, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"programEnd"}}},
+					{Addr: 0, Stmt: assembler.Assign{Dest: assembler.Register{Name: "w"}, Value: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: ">=", Left: assembler.Register{Name: "in"}, Right: assembler.Register{Name: "bound"}}}},
+					{Addr: 2, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "L3"}}},
+					{Addr: 3, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "L10"}}},
+					{Addr: 4, Stmt: assembler.Load{Dest: assembler.Register{Name: "secret"}, Addr: assembler.Register{Name: "in"}}},
+					{Addr: 5, Stmt: assembler.Load{Dest: assembler.Register{Name: "z"}, Addr: assembler.Register{Name: "secret"}}},
+					{Addr: 6, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "Loop_0"}}},
+					{Addr: 7, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
+					{Addr: 8, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: ">=", Left: assembler.Register{Name: "in"}, Right: assembler.Register{Name: "bound"}}}},
+					{Addr: 9, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "L3_0"}}},
+					{Addr: 10, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "L10_0"}}},
+					{Addr: 11, Stmt: assembler.Load{Dest: assembler.Register{Name: "secret"}, Addr: assembler.Register{Name: "in"}}},
+					{Addr: 12, Stmt: assembler.Load{Dest: assembler.Register{Name: "z"}, Addr: assembler.Register{Name: "secret"}}},
+					{Addr: 13, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "Loop_1"}}},
+					{Addr: 14, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
 				},
 				Labels: map[string]int{
 					"programEnd": 15,
-					"L3":       4,
+					"L3":         4,
 					"L3_0":       11,
-					"L10":      6,
+					"L10":        6,
 					"L10_0":      13,
 					"Loop":       1,
 					"Loop_0":     8,
 					"Loop_1":     15,
-					"L3_1":       18,
-					"L10_1":      20,
+					"L3_1":       15,
+					"L10_1":      15,
+				},
+			},
+			expectedError: nil,
+		},
+		{
+			name: "Register named like a label", // ジャンプ先以外のオペランドはラベル名と同じでも置き換えない
+			inputAsm: &assembler.Assembler{
+				Program: []assembler.Instruction{
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "L"}, Addr: assembler.BinaryExpr{Op: "+", Left: assembler.Register{Name: "L"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 1, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "L"}}},
+				},
+				Labels: map[string]int{"L": 0},
+			},
+			maxUnrollCount: 2,
+			expectedAsm: &assembler.Assembler{
+				Program: []assembler.Instruction{
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "L"}, Addr: assembler.BinaryExpr{Op: "+", Left: assembler.Register{Name: "L"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 1, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "L_0"}}},
+					{Addr: 2, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "L"}, Addr: assembler.BinaryExpr{Op: "+", Left: assembler.Register{Name: "L"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 4, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "L_1"}}},
+					{Addr: 5, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
+				},
+				Labels: map[string]int{
+					"L":          0,
+					"L_0":        3,
+					"L_1":        6,
+					"programEnd": 6},
+			},
+		},
+		{
+			name: "Two sequential loops",
+			inputAsm: &assembler.Assembler{
+				Program: []assembler.Instruction{
+					{Addr: 0, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.Immediate{Value: 2}}},
+					{Addr: 1, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "-", Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 2, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "L1"}}},
+					{Addr: 3, Stmt: assembler.Assign{Dest: assembler.Register{Name: "y"}, Value: assembler.Immediate{Value: 3}}},
+					{Addr: 4, Stmt: assembler.Assign{Dest: assembler.Register{Name: "y"}, Value: assembler.BinaryExpr{Op: "-", Left: assembler.Register{Name: "y"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 5, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "L2"}}},
+				},
+				Labels: map[string]int{
+					"L1": 1,
+					"L2": 4,
+				},
+			},
+			maxUnrollCount: 2,
+			expectedAsm: &assembler.Assembler{
+				Program: []assembler.Instruction{
+					{Addr: 0, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.Immediate{Value: 2}}},
+					{Addr: 1, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "-", Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 2, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "L1_0"}}},
+					{Addr: 3, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "L1_exit"}}},
+					{Addr: 4, Stmt: assembler.Assign{Dest: assembler.Register{Name: "x"}, Value: assembler.BinaryExpr{Op: "-", Left: assembler.Register{Name: "x"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 5, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "L1_1"}}},
+					{Addr: 6, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "L1_exit"}}},
+					{Addr: 7, Stmt: assembler.Assign{Dest: assembler.Register{Name: "y"}, Value: assembler.Immediate{Value: 3}}},
+					{Addr: 8, Stmt: assembler.Assign{Dest: assembler.Register{Name: "y"}, Value: assembler.BinaryExpr{Op: "-", Left: assembler.Register{Name: "y"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 9, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "L2_0"}}},
+					{Addr: 10, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
+					{Addr: 11, Stmt: assembler.Assign{Dest: assembler.Register{Name: "y"}, Value: assembler.BinaryExpr{Op: "-", Left: assembler.Register{Name: "y"}, Right: assembler.Immediate{Value: 1}}}},
+					{Addr: 12, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "L2_1"}}},
+					{Addr: 13, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
+				},
+				Labels: map[string]int{
+					"L1":         1,
+					"L1_0":       4,
+					"L1_1":       14,
+					"L1_exit":    7,
+					"L2":         8,
+					"L2_0":       11,
+					"L2_1":       14,
+					"programEnd": 14,
+				},
+			},
+			expectedError: nil,
+		},
+		{
+			name: "Nested loop", // 内側のループを展開してから外側のループを展開する
+			inputAsm: &assembler.Assembler{
+				Program: []assembler.Instruction{
+					{Addr: 0, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "OuterLoop"}}},
+					{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 2, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "InnerLoop"}}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 4, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "InnerLoop"}}},
+					{Addr: 5, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "OuterLoop"}}},
+				},
+				Labels: map[string]int{
+					"OuterLoop": 1,
+					"InnerLoop": 3,
+				},
+			},
+			maxUnrollCount:   2,
+			innerUnrollCount: 3,
+			expectedAsm: &assembler.Assembler{
+				Program: []assembler.Instruction{
+					{Addr: 0, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "OuterLoop"}}},
+					{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 2, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "InnerLoop"}}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 4, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "InnerLoop_0"}}},
+					{Addr: 5, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "InnerLoop_exit"}}},
+					{Addr: 6, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 7, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "InnerLoop_1"}}},
+					{Addr: 8, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "InnerLoop_exit"}}},
+					{Addr: 9, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 10, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "InnerLoop_2"}}},
+					{Addr: 11, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "InnerLoop_exit"}}},
+					{Addr: 12, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "OuterLoop__0"}}},
+					{Addr: 13, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
+					{Addr: 14, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 15, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "InnerLoop__0"}}},
+					{Addr: 16, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 17, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "InnerLoop_0__0"}}},
+					{Addr: 18, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "InnerLoop_exit__0"}}},
+					{Addr: 19, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 20, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "InnerLoop_1__0"}}},
+					{Addr: 21, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "InnerLoop_exit__0"}}},
+					{Addr: 22, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 23, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "InnerLoop_2"}}},
+					{Addr: 24, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "InnerLoop_exit__0"}}},
+					{Addr: 25, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "OuterLoop__1"}}},
+					{Addr: 26, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "programEnd"}}},
+				},
+				Labels: map[string]int{
+					"OuterLoop":         1,
+					"InnerLoop":         3,
+					"InnerLoop_0":       6,
+					"InnerLoop_1":       9,
+					"InnerLoop_2":       27,
+					"InnerLoop_exit":    12,
+					"OuterLoop__0":      14,
+					"InnerLoop__0":      16,
+					"InnerLoop_0__0":    19,
+					"InnerLoop_1__0":    22,
+					"InnerLoop_exit__0": 25,
+					"OuterLoop__1":      27,
+					"programEnd":        27,
+					"InnerLoop__1":      27,
+					"InnerLoop_0__1":    27,
+					"InnerLoop_1__1":    27,
+					"InnerLoop_exit__1": 27,
 				},
 			},
 			expectedError: nil,
 		},
-		// ネストされたループのテストケース、今回の論文では対応しない
-		// {
-		// 	name: "nested loop (not supported)",
-		// 	inputAsm: &assembler.Assembler{
-		// 		Program: []assembler.Instruction{
-		// 			{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
-		// 			{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-		// 			{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"InnerLoop"}}},
-		// 			{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-		// 			{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"y", "InnerLoop"}}},
-		// 			{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
-		// 		},
-		// 		Labels: map[string]int{
-		// 			"OuterLoop": 1,
-		// 			"InnerLoop": 3,
-		// 		},
-		// 	},
-		// 	maxUnrollCount: 2,
-		// 	expectedAsm: &assembler.Assembler{
-		// 		Program: []assembler.Instruction{
-		// 			{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
-		// 			{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-		// 			{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"InnerLoop"}}},
-		// 			{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-		// 			{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"y", "InnerLoop_0"}}},
-		// 			{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
-		// 			{Addr: 6, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-		// 			{Addr: 7, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"y", "InnerLoop_1"}}},
-		// 			{Addr: 8, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
-		// 		},
-		// 		Labels: map[string]int{
-		// 			"OuterLoop":   1,
-		// 			"InnerLoop":   3,
-		// 			"InnerLoop_0": 6,
-		// 			"InnerLoop_1": 9,
-		// 		},
-		// 	},
-		// 	expectedError: nil,
-		// },
-		// ネストされたループのテストケース、今回の論文では対応しない
-		// 		{
-		// 	name: "loop_expander",
-		// 	inputAsm: &assembler.Assembler{
-		// 		Program: []assembler.Instruction{
-		// 			{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
-		// 			{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-		// 			{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"InnerLoop"}}},
-		// 			{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-		// 			{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"y", "InnerLoop_0"}}},
-		// 			{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
-		// 			{Addr: 6, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-		// 			{Addr: 7, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"y", "InnerLoop_1"}}},
-		// 			{Addr: 8, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
-		// 		},
-		// 		Labels: map[string]int{
-		// 			"OuterLoop":   1,
-		// 			"InnerLoop":   3,
-		// 			"InnerLoop_0": 6,
-		// 			"InnerLoop_1": 9,
-		// 		},
-		// 	},
-		// 	maxUnrollCount: 2,
-		// 	expectedAsm: &assembler.Assembler{
-		// 		Program: []assembler.Instruction{
-		// 			{Addr: 0, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
-		// 			{Addr: 1, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"x", "0"}}},
-		// 			{Addr: 2, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"InnerLoop"}}},
-		// 			{Addr: 3, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-		// 			{Addr: 4, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"y", "InnerLoop_0"}}},
-		// 			{Addr: 5, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
-		// 			{Addr: 6, OpCode: assembler.OpCode{Mnemonic: "load", Operands: []string{"y", "1"}}},
-		// 			{Addr: 7, OpCode: assembler.OpCode{Mnemonic: "beqz", Operands: []string{"y", "InnerLoop_1"}}},
-		// 			{Addr: 8, OpCode: assembler.OpCode{Mnemonic: "jmp", Operands: []string{"OuterLoop"}}},
-		// 		},
-		// 		Labels: map[string]int{
-		// 			"OuterLoop":   1,
-		// 			"InnerLoop":   3,
-		// 			"InnerLoop_0": 6,
-		// 			"InnerLoop_1": 9,
-		// 		},
-		// 	},
-		// 	expectedError: nil,
-		// },
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			resultAsm, err := loop_expander.Loop_expander(tc.inputAsm, tc.maxUnrollCount)
+			var resultAsm *assembler.Assembler
+			var err error
+			if tc.innerUnrollCount == 0 {
+				resultAsm, err = loop_expander.Loop_expander(tc.inputAsm, tc.maxUnrollCount)
+			} else {
+				resultAsm, err = loop_expander.ExpandLoops(tc.inputAsm, loop_expander.ExpandOptions{
+					UnrollCount:      tc.maxUnrollCount,
+					InnerUnrollCount: tc.innerUnrollCount,
+				})
+			}
 
 			if tc.expectedError != nil {
 				if !errors.Is(err, tc.expectedError) {
@@ -393,3 +464,28 @@ func TestLoop_expander(t *testing.T) {
 		})
 	}
 }
+
+func TestExpandLoopsKeepsStmt(t *testing.T) {
+	asm, err := assembler.ParseAsm(strings.NewReader("Outer:\n    x<-x-1\nInner:\n    y<-y-1\n    beqz y,Inner\n    beqz x,Outer\n    z<-1\n"))
+	if err != nil {
+		t.Fatalf("failed to parse program: %v", err)
+	}
+	expanded, err := loop_expander.Loop_expander(asm, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 展開後の命令はすべて Stmt を持ち、出力に使う Op は Stmt と一致することを確認
+	for _, inst := range expanded.Program {
+		if inst.Stmt == nil {
+			t.Fatalf("instruction %d has no Stmt", inst.Addr)
+		}
+		decoded, err := assembler.Decode(inst.Op())
+		if err != nil {
+			t.Fatalf("failed to decode instruction %d: %v", inst.Addr, err)
+		}
+		if inst.Stmt.String() != decoded.String() {
+			t.Errorf("instruction %d: Stmt %q does not match Op %q", inst.Addr, inst.Stmt, decoded)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package loop_expander
+
+import "sort"
+
+// LoopNode は、ループの入れ子構造 (ループフォレスト) の節点を表す構造体
+type LoopNode struct {
+	StartAddress int         // ループ先頭の命令のアドレス
+	EndAddress   int         // ループ末尾の命令のアドレス
+	Depth        int         // 入れ子の深さ (最も外側のループは 0)
+	Parent       *LoopNode   // 外側のループ (最も外側の場合は nil)
+	Children     []*LoopNode // 直接内側にあるループのリスト
+	// BackEdges は、バックエッジとなるジャンプ命令のアドレスから、ジャンプ先のループヘッダのアドレスへの対応
+	// 展開では、これらのジャンプだけを次の繰り返しへのジャンプとして扱います。
+	BackEdges map[int]int
+}
+
+// BuildLoopForest は、検出されたループからループフォレストを構築し、最も外側のループを開始アドレス順に返します。
+// 同じヘッダを持つループや、包含関係にないまま重なり合うループは、一つのループとしてまとめます。
+func BuildLoopForest(cfg *ControlFlowGraph, loops []Loop) []*LoopNode {
+	nodes := make([]*LoopNode, 0, len(loops))
+	for _, loop := range loops {
+		nodes = append(nodes, loopRange(cfg, loop))
+	}
+	nodes = mergeOverlappingLoops(nodes)
+
+	// 開始アドレスの昇順、同じ場合は範囲の広い順に並べると、外側のループが先に来る
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].StartAddress != nodes[j].StartAddress {
+			return nodes[i].StartAddress < nodes[j].StartAddress
+		}
+		return nodes[i].EndAddress > nodes[j].EndAddress
+	})
+
+	roots := make([]*LoopNode, 0)
+	stack := make([]*LoopNode, 0) // 現在のノードを含みうる外側のループ
+	for _, node := range nodes {
+		for len(stack) > 0 && stack[len(stack)-1].EndAddress < node.StartAddress {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, node)
+		} else {
+			parent := stack[len(stack)-1]
+			node.Parent = parent
+			node.Depth = parent.Depth + 1
+			parent.Children = append(parent.Children, node)
+		}
+		stack = append(stack, node)
+	}
+	return roots
+}
+
+// InnermostLoops は、ループフォレストのうち内側にループを持たないループを開始アドレス順に返します。
+func InnermostLoops(roots []*LoopNode) []*LoopNode {
+	leaves := make([]*LoopNode, 0)
+	for _, root := range roots {
+		if len(root.Children) == 0 {
+			leaves = append(leaves, root)
+			continue
+		}
+		leaves = append(leaves, InnermostLoops(root.Children)...)
+	}
+	return leaves
+}
+
+// loopRange は、ループ本体のブロックからループのアドレス範囲を求めます。
+func loopRange(cfg *ControlFlowGraph, loop Loop) *LoopNode {
+	header := cfg.Blocks[loop.Header]
+	node := &LoopNode{
+		StartAddress: header.StartAddress,
+		EndAddress:   header.EndAddress,
+		BackEdges:    map[int]int{cfg.Blocks[loop.Latch].EndAddress: header.StartAddress},
+	}
+	for _, blockIndex := range loop.Blocks {
+		block := cfg.Blocks[blockIndex]
+		if block.StartAddress < node.StartAddress {
+			node.StartAddress = block.StartAddress
+		}
+		if block.EndAddress > node.EndAddress {
+			node.EndAddress = block.EndAddress
+		}
+	}
+	// ループヘッダへ後方ジャンプするブロックは、到達不能であってもループの繰り返しとみなして範囲に含める
+	for _, block := range cfg.Blocks {
+		if block.StartAddress >= header.StartAddress && block.EndAddress > node.EndAddress && indexOf(block.Succs, loop.Header) != -1 {
+			node.EndAddress = block.EndAddress
+			node.BackEdges[block.EndAddress] = header.StartAddress
+		}
+	}
+	return node
+}
+
+// mergeOverlappingLoops は、同じ範囲のループを一つにし、包含関係にないまま重なり合うループを結合します。
+func mergeOverlappingLoops(nodes []*LoopNode) []*LoopNode {
+	merged := make([]*LoopNode, 0, len(nodes))
+	for _, node := range nodes {
+		for {
+			overlapIndex := -1
+			for i, other := range merged {
+				if node.StartAddress == other.StartAddress && node.EndAddress == other.EndAddress {
+					overlapIndex = i
+					break
+				}
+				overlaps := node.StartAddress <= other.EndAddress && other.StartAddress <= node.EndAddress
+				nested := (node.StartAddress <= other.StartAddress && other.EndAddress <= node.EndAddress) ||
+					(other.StartAddress <= node.StartAddress && node.EndAddress <= other.EndAddress)
+				if overlaps && !nested {
+					overlapIndex = i
+					break
+				}
+			}
+			if overlapIndex == -1 {
+				break
+			}
+			// 重なったループを取り除き、和集合の範囲で再度調べる
+			other := merged[overlapIndex]
+			merged = append(merged[:overlapIndex], merged[overlapIndex+1:]...)
+			backEdges := make(map[int]int, len(node.BackEdges)+len(other.BackEdges))
+			for _, edges := range []map[int]int{node.BackEdges, other.BackEdges} {
+				for from, to := range edges {
+					backEdges[from] = to
+				}
+			}
+			node = &LoopNode{
+				StartAddress: min(node.StartAddress, other.StartAddress),
+				EndAddress:   max(node.EndAddress, other.EndAddress),
+				BackEdges:    backEdges,
+			}
+		}
+		merged = append(merged, node)
+	}
+	return merged
+}
@@ -0,0 +1,83 @@
+package loop_expander_test
+
+import (
+	"testing"
+
+	"github.com/taisii/go-project/assembler"
+	"github.com/taisii/go-project/loop_expander"
+)
+
+func TestBuildLoopForest(t *testing.T) {
+	type expectedLoop struct {
+		start, end, depth int
+	}
+
+	testCases := []struct {
+		name              string
+		assembly          *assembler.Assembler
+		expectedRoots     []expectedLoop
+		expectedInnermost []expectedLoop
+	}{
+		{
+			name: "Sequential loops",
+			assembly: &assembler.Assembler{
+				Program: []assembler.Instruction{
+					{Addr: 0, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 1, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "x"}, Target: assembler.LabelRef{Name: "L1"}}},
+					{Addr: 2, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 3, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "L2"}}},
+				},
+				Labels: map[string]int{
+					"L1": 0,
+					"L2": 2,
+				},
+			},
+			expectedRoots:     []expectedLoop{{0, 1, 0}, {2, 3, 0}},
+			expectedInnermost: []expectedLoop{{0, 1, 0}, {2, 3, 0}},
+		},
+		{
+			name: "Nested loops",
+			assembly: &assembler.Assembler{
+				Program: []assembler.Instruction{
+					{Addr: 0, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "OuterLoop"}}},
+					{Addr: 1, Stmt: assembler.Load{Dest: assembler.Register{Name: "x"}, Addr: assembler.Immediate{Value: 0}}},
+					{Addr: 2, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "InnerLoop"}}},
+					{Addr: 3, Stmt: assembler.Load{Dest: assembler.Register{Name: "y"}, Addr: assembler.Immediate{Value: 1}}},
+					{Addr: 4, Stmt: assembler.Beqz{Cond: assembler.Register{Name: "y"}, Target: assembler.LabelRef{Name: "InnerLoop"}}},
+					{Addr: 5, Stmt: assembler.Jmp{Target: assembler.LabelRef{Name: "OuterLoop"}}},
+				},
+				Labels: map[string]int{
+					"OuterLoop": 1,
+					"InnerLoop": 3,
+				},
+			},
+			expectedRoots:     []expectedLoop{{1, 5, 0}},
+			expectedInnermost: []expectedLoop{{3, 4, 1}},
+		},
+	}
+
+	check := func(t *testing.T, kind string, got []*loop_expander.LoopNode, want []expectedLoop) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("unexpected number of %s loops: got %d, want %d", kind, len(got), len(want))
+		}
+		for i, node := range got {
+			if node.StartAddress != want[i].start || node.EndAddress != want[i].end || node.Depth != want[i].depth {
+				t.Errorf("%s loop %d: got (%d-%d, depth %d), want (%d-%d, depth %d)", kind, i,
+					node.StartAddress, node.EndAddress, node.Depth, want[i].start, want[i].end, want[i].depth)
+			}
+		}
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := loop_expander.BuildControlFlowGraph(tc.assembly)
+			if err != nil {
+				t.Fatalf("BuildControlFlowGraph() error = %v", err)
+			}
+			roots := loop_expander.BuildLoopForest(cfg, loop_expander.DetectLoops(cfg))
+			check(t, "root", roots, tc.expectedRoots)
+			check(t, "innermost", loop_expander.InnermostLoops(roots), tc.expectedInnermost)
+		})
+	}
+}
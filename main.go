@@ -1,68 +1,95 @@
 package main
 
 import (
-	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+)
 
-	"github.com/taisii/go-project/assembler"
-	"github.com/taisii/go-project/loop_expander"
+// 終了コード (すべてのサブコマンドで共通)
+const (
+	exitOK        = 0 // 成功 (check ではリークが見つからなかった)
+	exitError     = 1 // 入力の読み込み、解析、展開、実行のいずれかに失敗した
+	exitUsage     = 2 // コマンドライン引数が正しくない
+	exitLeak      = 3 // check でリークが見つかった
+	exitUndecided = 4 // check でリークは見つからなかったが、判定できなかったパスがある
 )
 
-func main() {
-	var inputFile string
-	var outputFile string
-	var unrollCount int
+// command は、サブコマンドを表す構造体
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
 
-	flag.StringVar(&inputFile, "i", "", "入力アセンブリファイル")
-	flag.StringVar(&outputFile, "o", "", "出力アセンブリファイル (指定しない場合は標準出力)")
-	flag.IntVar(&unrollCount, "n", 2, "ループ展開回数")
-	flag.Parse()
+var commands = []command{
+	{name: "expand", summary: "ループを展開したアセンブリコードを出力します", run: runExpand},
+	{name: "cfg", summary: "制御フローグラフと検出したループを出力します (--dot で DOT 形式)", run: runCFG},
+	{name: "exec", summary: "投機なしでシンボリック実行し、最終状態を出力します", run: runExec},
+	{name: "spec", summary: "投機実行し、最終状態を出力します", run: runSpec},
+	{name: "check", summary: "投機的非干渉性を検査し、リークを報告します", run: runCheck},
+	{name: "batch", summary: "ディレクトリやグロブの複数のファイルを並列に展開、解析し、一覧を出力します", run: runBatch},
+}
 
-	if inputFile == "" {
-		fmt.Println("入力ファイルを指定してください (-i オプション)")
-		os.Exit(1)
-	}
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
 
-	if unrollCount <= 0 {
-		fmt.Println("展開回数は正の整数である必要があります")
-		os.Exit(1)
+// run は、args の最初の引数のサブコマンドを実行して終了コードを返します。
+// 最初の引数がオプションの場合、または引数がなく標準入力が端末でない場合は、expand として扱います。
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		// 標準入力がパイプやファイルの場合は、expand として標準入力のプログラムを展開する
+		if !isTerminal(stdin) {
+			return runExpand(args, stdin, stdout, stderr)
+		}
+		usage(stderr)
+		return exitUsage
 	}
-
-	file, err := os.Open(inputFile)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "入力ファイルのオープンに失敗しました: %v\n", err)
-		os.Exit(1)
+	if strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "-help" && args[0] != "--help" {
+		return runExpand(args, stdin, stdout, stderr)
 	}
-	defer file.Close()
 
-	asm, err := assembler.ParseAsm(file)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "アセンブリコードのパースに失敗しました: %v\n", err)
-		os.Exit(1)
+	name := args[0]
+	switch name {
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return exitOK
 	}
-
-	expandedAsm, err := loop_expander.Loop_expander(asm, unrollCount)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "ループ展開に失敗しました: %v\n", err)
-		os.Exit(1)
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(args[1:], stdin, stdout, stderr)
+		}
 	}
+	fmt.Fprintf(stderr, "不明なサブコマンドです: %s\n", name)
+	usage(stderr)
+	return exitUsage
+}
 
-	// GenerateAsm を使用してアセンブリコードを文字列に変換
-	output, err := assembler.GenerateAsm(expandedAsm)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "アセンブリコードの生成に失敗しました: %v\n", err)
-		os.Exit(1)
+// usage は、サブコマンドの一覧を w に出力します。
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "使い方: go-project <サブコマンド> [オプション]")
+	fmt.Fprintln(w, "-i を指定しない場合、または -i - の場合は標準入力からプログラムを読み込みます。")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "サブコマンド:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.name, cmd.summary)
 	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "各サブコマンドのオプションは go-project <サブコマンド> -h で表示します。")
+	fmt.Fprintf(w, "終了コード: %d 成功, %d 実行時のエラー, %d 引数の誤り, %d リークあり (check), %d 判定できないパスあり (check)\n", exitOK, exitError, exitUsage, exitLeak, exitUndecided)
+}
 
-	if outputFile != "" {
-		err = os.WriteFile(outputFile, []byte(output), 0644)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "出力ファイルへの書き込みに失敗しました: %v\n", err)
-			os.Exit(1)
-		}
-		fmt.Printf("ループ展開されたアセンブリコードを %s に書き込みました\n", outputFile)
-	} else {
-		fmt.Println(output)
+// isTerminal は、r が端末 (キャラクタデバイス) の場合に true を返します。
+func isTerminal(r io.Reader) bool {
+	file, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return false
 	}
+	return info.Mode()&os.ModeCharDevice != 0
 }
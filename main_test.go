@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	loop := filepath.Join(dir, "loop.muasm")
+	gadget := filepath.Join(dir, "gadget.muasm")
+	undecided := filepath.Join(dir, "undecided.muasm")
+	files := map[string]string{
+		loop:      "    x<-5\nLoop:\n    x<-x-1\n    beqz x,Loop\n",
+		gadget:    "%! public y\n    x<-v<y\n    beqz x,End\n    load v,v\n    load v,v\nEnd:\n",
+		undecided: "%! public c\n    a <- k*k\n    load t, a\n    beqz c, End\n    load t, k\nEnd:\n",
+	}
+	for path, source := range files {
+		if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		Name           string
+		Args           []string
+		Stdin          string
+		ExpectedCode   int
+		ExpectedStdout string // 標準出力に含まれる文字列
+		ExpectedStderr string // 標準エラー出力に含まれる文字列
+	}{
+		{Name: "No arguments with stdin", Args: nil, Stdin: "Loop:\n    x<-x-1\n    beqz x,Loop\n", ExpectedCode: exitOK, ExpectedStdout: "beqz x, Loop"},
+		{Name: "Unknown subcommand", Args: []string{"run"}, ExpectedCode: exitUsage, ExpectedStderr: "不明なサブコマンドです: run"},
+		{Name: "Legacy expand", Args: []string{"-i", loop, "-n", "1"}, ExpectedCode: exitOK, ExpectedStdout: "beqz x, Loop"},
+		{Name: "Expand", Args: []string{"expand", "-i", loop, "-n", "2"}, ExpectedCode: exitOK, ExpectedStdout: "x <- x - 1"},
+		{Name: "Expand from stdin", Args: []string{"expand", "-n", "1"}, Stdin: "Loop:\n    x<-x-1\n    beqz x,Loop\n", ExpectedCode: exitOK, ExpectedStdout: "beqz x, Loop"},
+		{Name: "Legacy expand from stdin", Args: []string{"-i", "-", "-n", "1"}, Stdin: "Loop:\n    beqz x,Loop\n", ExpectedCode: exitOK, ExpectedStdout: "beqz x, Loop"},
+		{Name: "Parse error on stdin", Args: []string{"exec"}, Stdin: "    foo x\n", ExpectedCode: exitError, ExpectedStderr: "<stdin>:1:"},
+		{Name: "Check with directives on stdin", Args: []string{"check"}, Stdin: "%! public v\n%! memory zero\n" + files[gadget], ExpectedCode: exitOK, ExpectedStdout: "Result: secure"},
+		{Name: "JSON from stdin", Args: []string{"cfg", "-json"}, Stdin: "    x<-1\n", ExpectedCode: exitOK, ExpectedStdout: `"source": "<stdin>"`},
+		{Name: "Missing file", Args: []string{"exec", "-i", filepath.Join(dir, "missing.muasm")}, ExpectedCode: exitError, ExpectedStderr: "入力ファイルのオープンに失敗しました"},
+		{Name: "Invalid flag", Args: []string{"cfg", "-i", loop, "-window", "5"}, ExpectedCode: exitUsage, ExpectedStderr: "flag provided but not defined"},
+		{Name: "CFG", Args: []string{"cfg", "-i", loop}, ExpectedCode: exitOK, ExpectedStdout: "Header: 1, Latch: 1"},
+		{Name: "CFG in DOT", Args: []string{"cfg", "--dot", "-i", loop}, ExpectedCode: exitOK, ExpectedStdout: "digraph CFG {"},
+		{Name: "Exec", Args: []string{"exec", "-i", loop, "-n", "6"}, ExpectedCode: exitOK, ExpectedStdout: "Paths: 1"},
+		{Name: "Spec", Args: []string{"spec", "-i", gadget, "--window", "3", "--max-steps", "50"}, ExpectedCode: exitOK, ExpectedStdout: "Type: start"},
+		{Name: "Exec drops paths over the step limit", Args: []string{"exec", "-i", loop, "-n", "6", "--max-steps", "3"}, ExpectedCode: exitOK, ExpectedStdout: "Paths: 0"},
+		{Name: "Spec over the step budget", Args: []string{"spec", "-i", gadget, "--max-steps", "5"}, ExpectedCode: exitError, ExpectedStderr: "execution reached maximum step limit"},
+		{Name: "Invalid semantics", Args: []string{"spec", "-i", gadget, "-semantics", "v2"}, ExpectedCode: exitUsage, ExpectedStderr: "unknown speculation semantics"},
+		{Name: "Check finds a leak", Args: []string{"check", "-i", gadget}, ExpectedCode: exitLeak, ExpectedStdout: "Result: insecure"},
+		{Name: "Check with an undecided path", Args: []string{"check", "-i", undecided}, ExpectedCode: exitUndecided, ExpectedStdout: "Result: inconclusive (1 undecided paths)"},
+		{Name: "Check without misprediction", Args: []string{"check", "-i", gadget, "-window", "0"}, ExpectedCode: exitOK, ExpectedStdout: "Result: secure"},
+		{Name: "Expand in JSON", Args: []string{"expand", "-json", "-i", loop, "-n", "1"}, ExpectedCode: exitOK, ExpectedStdout: `"kind": "program"`},
+		{Name: "CFG in JSON", Args: []string{"cfg", "-json", "-i", loop}, ExpectedCode: exitOK, ExpectedStdout: `"loops": [`},
+		{Name: "CFG in DOT and JSON", Args: []string{"cfg", "-json", "-dot", "-i", loop}, ExpectedCode: exitUsage, ExpectedStderr: "-dot と -json は同時に指定できません"},
+		{Name: "Exec in JSON", Args: []string{"exec", "-json", "-i", loop, "-n", "6"}, ExpectedCode: exitOK, ExpectedStdout: `"kind": "configurations"`},
+		{Name: "Check in JSON", Args: []string{"check", "-json", "-i", gadget}, ExpectedCode: exitLeak, ExpectedStdout: `"secure": false`},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(testCase.Args, strings.NewReader(testCase.Stdin), &stdout, &stderr)
+			if code != testCase.ExpectedCode {
+				t.Errorf("expected exit code %d, got %d\nstdout:\n%s\nstderr:\n%s", testCase.ExpectedCode, code, stdout.String(), stderr.String())
+			}
+			if !strings.Contains(stdout.String(), testCase.ExpectedStdout) {
+				t.Errorf("expected stdout to contain %q, got:\n%s", testCase.ExpectedStdout, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), testCase.ExpectedStderr) {
+				t.Errorf("expected stderr to contain %q, got:\n%s", testCase.ExpectedStderr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunWritesOutputFile(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "loop.muasm")
+	output := filepath.Join(dir, "expanded.muasm")
+	if err := os.WriteFile(input, []byte("Loop:\n    x<-x-1\n    beqz x,Loop\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"expand", "-i", input, "-o", output}, strings.NewReader(""), &stdout, &stderr); code != exitOK {
+		t.Fatalf("expected exit code %d, got %d: %s", exitOK, code, stderr.String())
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "x <- x - 1") {
+		t.Errorf("expected the expanded program in %s, got:\n%s", output, data)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("expected nothing on stdout, got %q", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), output) {
+		t.Errorf("expected a status message naming %s on stderr, got %q", output, stderr.String())
+	}
+
+	stderr.Reset()
+	if code := run([]string{"expand", "-q", "-i", input, "-o", output}, strings.NewReader(""), &stdout, &stderr); code != exitOK {
+		t.Fatalf("expected exit code %d, got %d: %s", exitOK, code, stderr.String())
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("expected -q to suppress the status message, got %q", stderr.String())
+	}
+}
+
+func TestRunKeepsDiagnosticsOffStdout(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"expand", "-n", "1"}, strings.NewReader("jmp r\nx <- 1\n"), &stdout, &stderr); code != exitOK {
+		t.Fatalf("expected exit code %d, got %d: %s", exitOK, code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "jmp r\n") {
+		t.Errorf("expected only the expanded program on stdout, got:\n%s", stdout.String())
+	}
+	// 警告は一度だけ、run の stderr に表示する
+	if expected := "<stdin>: ラベル r が見つかりません\n"; stderr.String() != expected {
+		t.Errorf("expected stderr %q, got %q", expected, stderr.String())
+	}
+
+	stderr.Reset()
+	stdout.Reset()
+	if code := run([]string{"expand", "-n", "1", "-q"}, strings.NewReader("jmp r\nx <- 1\n"), &stdout, &stderr); code != exitOK {
+		t.Fatalf("expected exit code %d, got %d: %s", exitOK, code, stderr.String())
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("expected -q to suppress the warning, got %q", stderr.String())
+	}
+}
@@ -0,0 +1,351 @@
+// Package report は、展開したプログラム、制御フローグラフ、実行結果を
+// バージョン付きの JSON スキーマに変換します。
+//
+// すべての出力は Document をトップレベルとし、schema_version が変わらない限り
+// フィールドの削除や意味の変更は行いません (フィールドの追加はあり得ます)。
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/taisii/go-project/assembler"
+	"github.com/taisii/go-project/executor"
+	"github.com/taisii/go-project/loop_expander"
+)
+
+// SchemaVersion は、このパッケージが出力する JSON スキーマのバージョンです。
+const SchemaVersion = 1
+
+// Kind は、Document に含まれる結果の種類を表す型
+type Kind string
+
+const (
+	KindProgram        Kind = "program"        // Program を含む (expand)
+	KindCFG            Kind = "cfg"            // Program と CFG を含む (cfg)
+	KindConfigurations Kind = "configurations" // Paths を含む (exec, spec)
+	KindCheck          Kind = "check"          // Paths と Check を含む (check)
+	KindBatch          Kind = "batch"          // Batch を含む (batch)
+)
+
+// Document は、JSON 出力のトップレベルの構造体
+type Document struct {
+	SchemaVersion int             `json:"schema_version"`
+	Kind          Kind            `json:"kind"`
+	Source        string          `json:"source,omitempty"` // 入力ファイル名
+	Program       *Program        `json:"program,omitempty"`
+	CFG           *CFG            `json:"cfg,omitempty"`
+	Paths         []Configuration `json:"paths,omitempty"`
+	Check         *Check          `json:"check,omitempty"`
+	Batch         *Batch          `json:"batch,omitempty"`
+}
+
+// Program は、命令列とラベルの対応を表す構造体
+type Program struct {
+	Instructions []Instruction  `json:"instructions"`
+	Labels       map[string]int `json:"labels"` // ラベル名からアドレス
+}
+
+// Instruction は、一つの命令を表す構造体
+type Instruction struct {
+	Address  int      `json:"address"`
+	Mnemonic string   `json:"mnemonic"`
+	Operands []string `json:"operands"`
+}
+
+// CFG は、制御フローグラフと検出したループを表す構造体
+type CFG struct {
+	Blocks []Block `json:"blocks"`
+	Loops  []Loop  `json:"loops"`
+}
+
+// Block は、基本ブロックを表す構造体
+type Block struct {
+	Index        int   `json:"index"`
+	StartAddress int   `json:"start_address"`
+	EndAddress   int   `json:"end_address"`
+	Successors   []int `json:"successors"` // 後続ブロックのインデックス
+}
+
+// Loop は、バックエッジ一本に対応する自然ループを表す構造体
+type Loop struct {
+	Header int      `json:"header"`
+	Latch  int      `json:"latch"`
+	Blocks []int    `json:"blocks"`
+	Exits  [][2]int `json:"exits"` // ループ外へ出るエッジ (遷移元と遷移先のブロック)
+}
+
+// Configuration は、実行パスの最終状態を表す構造体
+type Configuration struct {
+	PC           int             `json:"pc"`
+	StepCount    int             `json:"step_count"`
+	Registers    map[string]Expr `json:"registers"`
+	Memory       []MemoryCell    `json:"memory"`           // アドレスの昇順
+	Writes       []MemoryWrite   `json:"writes,omitempty"` // シンボリックなアドレスへの書き込みの履歴
+	Observations []Observation   `json:"observations"`
+	PathCond     *Expr           `json:"path_cond"` // 条件がない (常に真) の場合は null
+}
+
+// MemoryCell は、具体的なアドレスのメモリの値を表す構造体
+type MemoryCell struct {
+	Address int  `json:"address"`
+	Value   Expr `json:"value"`
+}
+
+// MemoryWrite は、Configuration.Writes の一つの書き込みを表す構造体
+type MemoryWrite struct {
+	Address Expr `json:"address"`
+	Value   Expr `json:"value"`
+}
+
+// Observation は、トレースの一つの観測を表す構造体
+type Observation struct {
+	PC      int    `json:"pc"`
+	Type    string `json:"type"`
+	Address *Expr  `json:"address,omitempty"`
+	Value   *Expr  `json:"value,omitempty"`
+	Step    int    `json:"step,omitempty"` // rollback の場合のみ
+}
+
+// Expr は、具体値またはシンボリック式の木を表す構造体
+//
+//	{"kind": "int", "value": 3}
+//	{"kind": "symbol", "name": "x"}
+//	{"kind": "op", "op": "+", "args": [...]}
+//
+// kind は int (具体値)、symbol (入力のシンボル)、var (レジスタ名)、op (演算) のいずれかです。
+// text は木の根にだけ設定され、式全体を executor.FormatValue で文字列にしたものです。
+type Expr struct {
+	Kind  string `json:"kind"`
+	Value *int   `json:"value,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Op    string `json:"op,omitempty"`
+	Args  []Expr `json:"args,omitempty"`
+	Text  string `json:"text,omitempty"`
+}
+
+// Check は、投機的非干渉性の検査結果を表す構造体
+type Check struct {
+	Secure       bool   `json:"secure"`
+	Paths        int    `json:"paths"`
+	Leaks        []Leak `json:"leaks"`
+	Inconclusive []int  `json:"inconclusive"` // ソルバーが判定できなかったパスの Document.Paths でのインデックス
+}
+
+// Leak は、リークが見つかった実行パスを表す構造体
+type Leak struct {
+	Path        int         `json:"path"` // Document.Paths でのインデックス
+	Observation Observation `json:"observation"`
+	Secrets     []string    `json:"secrets"`
+}
+
+// Batch は、複数のファイルをまとめて処理した結果の一覧を表す構造体
+type Batch struct {
+	Analysis string      `json:"analysis"` // none, exec, spec, check のいずれか
+	Files    []BatchFile `json:"files"`    // 入力ファイル名の昇順
+}
+
+// BatchFile は、一つの入力ファイルの処理結果を表す構造体
+type BatchFile struct {
+	Source         string   `json:"source"`
+	Outputs        []string `json:"outputs"`
+	Loops          int      `json:"loops"`       // 展開前のプログラムで検出したループの数
+	SizeBefore     int      `json:"size_before"` // 展開前の命令数
+	SizeAfter      int      `json:"size_after"`  // 展開後の命令数
+	Paths          int      `json:"paths"`       // 探索した実行パスの数 (analysis が none の場合は 0)
+	Secure         *bool    `json:"secure,omitempty"`
+	ElapsedSeconds float64  `json:"elapsed_seconds"`
+	Error          string   `json:"error,omitempty"`
+}
+
+// NewProgram は、asm を Program に変換します。
+func NewProgram(asm *assembler.Assembler) *Program {
+	program := &Program{
+		Instructions: make([]Instruction, 0, len(asm.Program)),
+		Labels:       make(map[string]int, len(asm.Labels)),
+	}
+	for _, inst := range asm.Program {
+		op := inst.Op()
+		operands := append([]string{}, op.Operands...)
+		program.Instructions = append(program.Instructions, Instruction{
+			Address:  inst.Addr,
+			Mnemonic: op.Mnemonic,
+			Operands: operands,
+		})
+	}
+	for name, addr := range asm.Labels {
+		program.Labels[name] = addr
+	}
+	return program
+}
+
+// NewCFG は、制御フローグラフと DetectLoops で検出したループを CFG に変換します。
+func NewCFG(cfg *loop_expander.ControlFlowGraph) *CFG {
+	result := &CFG{
+		Blocks: make([]Block, 0, len(cfg.Blocks)),
+		Loops:  make([]Loop, 0),
+	}
+	for i, block := range cfg.Blocks {
+		result.Blocks = append(result.Blocks, Block{
+			Index:        i,
+			StartAddress: block.StartAddress,
+			EndAddress:   block.EndAddress,
+			Successors:   append([]int{}, block.Succs...),
+		})
+	}
+	for _, loop := range loop_expander.DetectLoops(cfg) {
+		exits := make([][2]int, 0, len(loop.Exits))
+		for _, exit := range loop.Exits {
+			exits = append(exits, [2]int{exit.From, exit.To})
+		}
+		result.Loops = append(result.Loops, Loop{
+			Header: loop.Header,
+			Latch:  loop.Latch,
+			Blocks: append([]int{}, loop.Blocks...),
+			Exits:  exits,
+		})
+	}
+	return result
+}
+
+// NewConfigurations は、実行パスの最終状態を Configuration に変換します。
+func NewConfigurations(finalConfigs []*executor.Configuration) []Configuration {
+	paths := make([]Configuration, 0, len(finalConfigs))
+	for _, conf := range finalConfigs {
+		paths = append(paths, NewConfiguration(conf))
+	}
+	return paths
+}
+
+// NewConfiguration は、一つの実行パスの最終状態を Configuration に変換します。
+func NewConfiguration(conf *executor.Configuration) Configuration {
+	result := Configuration{
+		PC:           conf.PC,
+		StepCount:    conf.StepCount,
+		Registers:    make(map[string]Expr, len(conf.Registers)),
+		Memory:       make([]MemoryCell, 0, len(conf.Memory)),
+		Observations: make([]Observation, 0, len(conf.Trace.Observations)),
+	}
+	for name, value := range conf.Registers {
+		result.Registers[name] = NewExpr(value)
+	}
+	addrs := make([]int, 0, len(conf.Memory))
+	for addr := range conf.Memory {
+		addrs = append(addrs, addr)
+	}
+	sort.Ints(addrs)
+	for _, addr := range addrs {
+		result.Memory = append(result.Memory, MemoryCell{Address: addr, Value: NewExpr(conf.Memory[addr])})
+	}
+	for _, write := range conf.Writes {
+		result.Writes = append(result.Writes, MemoryWrite{Address: NewExpr(write.Address), Value: NewExpr(write.Value)})
+	}
+	for _, obs := range conf.Trace.Observations {
+		result.Observations = append(result.Observations, NewObservation(obs))
+	}
+	if pathCond := conf.Trace.PathCond; pathCond.Op != "" || len(pathCond.Operands) > 0 {
+		expr := NewExpr(pathCond)
+		result.PathCond = &expr
+	}
+	return result
+}
+
+// NewObservation は、観測を Observation に変換します。
+func NewObservation(obs executor.Observation) Observation {
+	result := Observation{PC: obs.PC, Type: string(obs.Type)}
+	if obs.Address != nil {
+		expr := NewExpr(obs.Address)
+		result.Address = &expr
+	}
+	if obs.Value != nil {
+		expr := NewExpr(obs.Value)
+		result.Value = &expr
+	}
+	if obs.Type == executor.ObsTypeRollback {
+		result.Step = obs.Step
+	}
+	return result
+}
+
+// NewCheck は、検査結果を Check に変換します。finalConfigs は Document.Paths に出力した順の最終状態です。
+func NewCheck(result *executor.SNIResult, finalConfigs []*executor.Configuration) *Check {
+	check := &Check{
+		Secure:       result.Secure,
+		Paths:        result.Paths,
+		Leaks:        make([]Leak, 0, len(result.Leaks)),
+		Inconclusive: make([]int, 0, len(result.Inconclusive)),
+	}
+	for _, leak := range result.Leaks {
+		check.Leaks = append(check.Leaks, Leak{
+			Path:        pathIndex(finalConfigs, leak.Config),
+			Observation: NewObservation(leak.Observation),
+			Secrets:     append([]string{}, leak.Secrets...),
+		})
+	}
+	for _, conf := range result.Inconclusive {
+		check.Inconclusive = append(check.Inconclusive, pathIndex(finalConfigs, conf))
+	}
+	return check
+}
+
+// pathIndex は、finalConfigs での conf のインデックスを返します。含まれない場合は -1 を返します。
+func pathIndex(finalConfigs []*executor.Configuration, conf *executor.Configuration) int {
+	for i, c := range finalConfigs {
+		if c == conf {
+			return i
+		}
+	}
+	return -1
+}
+
+// NewExpr は、具体値またはシンボリック式を Expr の木に変換します。
+func NewExpr(value interface{}) Expr {
+	expr := newExprNode(value)
+	expr.Text = executor.FormatValue(value)
+	return expr
+}
+
+// newExprNode は、text を設定せずに式を変換します (text は木の根だけに設定する)。
+func newExprNode(value interface{}) Expr {
+	switch v := value.(type) {
+	case int:
+		n := v
+		return Expr{Kind: "int", Value: &n}
+	case string:
+		return Expr{Kind: "symbol", Name: v}
+	case *executor.SymbolicExpr:
+		if v == nil {
+			return Expr{Kind: "op"}
+		}
+		return newExprNode(*v)
+	case executor.SymbolicExpr:
+		switch v.Op {
+		case "value":
+			if len(v.Operands) == 1 {
+				return newExprNode(v.Operands[0])
+			}
+		case "symbol", "var":
+			if len(v.Operands) == 1 {
+				if name, ok := v.Operands[0].(string); ok {
+					return Expr{Kind: v.Op, Name: name}
+				}
+			}
+		}
+		args := make([]Expr, 0, len(v.Operands))
+		for _, operand := range v.Operands {
+			args = append(args, newExprNode(operand))
+		}
+		return Expr{Kind: "op", Op: v.Op, Args: args}
+	}
+	return Expr{Kind: "unknown", Name: executor.FormatValue(value)}
+}
+
+// Write は、doc にスキーマのバージョンを設定し、インデントした JSON として w に書き込みます。
+func Write(w io.Writer, doc Document) error {
+	doc.SchemaVersion = SchemaVersion
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(doc)
+}
@@ -0,0 +1,153 @@
+package report_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/taisii/go-project/assembler"
+	"github.com/taisii/go-project/executor"
+	"github.com/taisii/go-project/loop_expander"
+	"github.com/taisii/go-project/report"
+)
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestNewExpr(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Value    interface{}
+		Expected report.Expr
+	}{
+		{
+			Name:     "Integer",
+			Value:    3,
+			Expected: report.Expr{Kind: "int", Value: intPtr(3), Text: "3"},
+		},
+		{
+			Name:     "Symbol",
+			Value:    executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"x"}},
+			Expected: report.Expr{Kind: "symbol", Name: "x", Text: "x"},
+		},
+		{
+			Name: "Nested expression",
+			Value: executor.SymbolicExpr{Op: "+", Operands: []interface{}{
+				executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"x"}},
+				executor.SymbolicExpr{Op: "*", Operands: []interface{}{
+					executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"y"}},
+					2,
+				}},
+			}},
+			Expected: report.Expr{Kind: "op", Op: "+", Text: "(x + (y * 2))", Args: []report.Expr{
+				{Kind: "symbol", Name: "x"},
+				{Kind: "op", Op: "*", Args: []report.Expr{
+					{Kind: "symbol", Name: "y"},
+					{Kind: "int", Value: intPtr(2)},
+				}},
+			}},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			actual := report.NewExpr(testCase.Value)
+			if !reflect.DeepEqual(actual, testCase.Expected) {
+				t.Errorf("expected %+v, got %+v", testCase.Expected, actual)
+			}
+		})
+	}
+}
+
+func TestNewProgramAndCFG(t *testing.T) {
+	asm, err := assembler.ParseAsm(strings.NewReader("    x<-5\nLoop:\n    x<-x-1\n    beqz x,Loop\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := report.NewProgram(asm)
+	if len(program.Instructions) != 3 {
+		t.Fatalf("expected 3 instructions, got %d", len(program.Instructions))
+	}
+	if inst := program.Instructions[2]; inst.Address != 2 || inst.Mnemonic != "beqz" || !reflect.DeepEqual(inst.Operands, []string{"x", "Loop"}) {
+		t.Errorf("unexpected instruction %+v", inst)
+	}
+	if program.Labels["Loop"] != 1 {
+		t.Errorf("expected label Loop at 1, got %v", program.Labels)
+	}
+
+	cfg, err := loop_expander.BuildControlFlowGraph(asm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph := report.NewCFG(cfg)
+	if len(graph.Blocks) != len(cfg.Blocks) {
+		t.Errorf("expected %d blocks, got %d", len(cfg.Blocks), len(graph.Blocks))
+	}
+	if len(graph.Loops) != 1 || graph.Loops[0].Header != 1 || graph.Loops[0].Latch != 1 {
+		t.Errorf("expected one self loop on block 1, got %+v", graph.Loops)
+	}
+}
+
+func TestNewConfiguration(t *testing.T) {
+	conf := executor.NewConfiguration(
+		map[int]interface{}{8: 2, 4: executor.SymbolicExpr{Op: "symbol", Operands: []interface{}{"m"}}},
+		map[string]interface{}{"x": 1},
+	)
+	actual := report.NewConfiguration(conf)
+	if actual.PathCond != nil {
+		t.Errorf("expected no path condition, got %+v", actual.PathCond)
+	}
+	if len(actual.Memory) != 2 || actual.Memory[0].Address != 4 || actual.Memory[1].Address != 8 {
+		t.Errorf("expected memory sorted by address, got %+v", actual.Memory)
+	}
+	if actual.Registers["x"].Text != "1" {
+		t.Errorf("expected x = 1, got %+v", actual.Registers["x"])
+	}
+}
+
+func TestWrite(t *testing.T) {
+	asm, err := assembler.ParseAsm(strings.NewReader("    x<-v<y\n    beqz x,End\n    load v,v\nEnd:\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := executor.ParsePolicy("test.policy", strings.NewReader("public y\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := executor.CheckSNI(asm, policy.Policy, policy.Configuration(), 100, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	doc := report.Document{
+		Kind:  report.KindCheck,
+		Paths: report.NewConfigurations(result.Configs),
+		Check: report.NewCheck(result, result.Configs),
+	}
+	if err := report.Write(&out, doc); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded report.Document
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("failed to decode %s: %v", out.String(), err)
+	}
+	if decoded.SchemaVersion != report.SchemaVersion || decoded.Kind != report.KindCheck {
+		t.Errorf("unexpected header %d %q", decoded.SchemaVersion, decoded.Kind)
+	}
+	if decoded.Check == nil || decoded.Check.Secure || len(decoded.Check.Leaks) == 0 {
+		t.Fatalf("expected a leak, got %+v", decoded.Check)
+	}
+	for _, leak := range decoded.Check.Leaks {
+		if leak.Path < 0 || leak.Path >= len(decoded.Paths) {
+			t.Errorf("leak refers to path %d of %d", leak.Path, len(decoded.Paths))
+		}
+	}
+	if strings.Contains(out.String(), `\u003c`) {
+		t.Errorf("expected operators not to be escaped:\n%s", out.String())
+	}
+}